@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const defaultSocket = "/run/gogcli-sandbox-admin.sock"
+
+var views = map[string]string{
+	"policy":     "/policy",
+	"labels":     "/labels",
+	"ratelimits": "/ratelimits",
+	"outbox":     "/outbox",
+	"denials":    "/denials",
+	"runners":    "/runners",
+	"switches":   "/switches",
+}
+
+func main() {
+	defaultSock := os.Getenv("GOGCLI_SANDBOX_ADMIN_SOCKET")
+	if defaultSock == "" {
+		defaultSock = defaultSocket
+	}
+	fs := flag.NewFlagSet("gogcli-sandbox-admin", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	socket := fs.String("socket", defaultSock, "admin unix socket path")
+	timeout := fs.Duration("timeout", 15*time.Second, "request timeout")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		fatal(err)
+	}
+	args := fs.Args()
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage()
+		return
+	}
+
+	method, path, body, err := parseCommand(args[0], args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	status, raw, err := call(ctx, *socket, method, path, body)
+	if err != nil {
+		fatal(err)
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, raw, "", "  ") == nil {
+		raw = pretty.Bytes()
+	}
+	os.Stdout.Write(raw)
+	if status != http.StatusOK {
+		os.Exit(1)
+	}
+}
+
+func parseCommand(cmd string, args []string) (string, string, any, error) {
+	if path, ok := views[cmd]; ok {
+		if len(args) > 0 {
+			return "", "", nil, fmt.Errorf("%s takes no arguments", cmd)
+		}
+		return http.MethodGet, path, nil, nil
+	}
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	switch cmd {
+	case "reload":
+		if err := fs.Parse(args); err != nil {
+			return "", "", nil, err
+		}
+		return http.MethodPost, "/reload", nil, nil
+	case "flush":
+		account := fs.String("account", "", "only flush this account's caches (default: all)")
+		if err := fs.Parse(args); err != nil {
+			return "", "", nil, err
+		}
+		return http.MethodPost, "/flush", map[string]string{"account": *account}, nil
+	case "disable", "enable":
+		account := fs.String("account", "", "account to switch")
+		action := fs.String("action", "", "action to switch")
+		var duration *time.Duration
+		var reason *string
+		if cmd == "disable" {
+			duration = fs.Duration("for", 0, "re-enable automatically after this long (default: until enable)")
+			reason = fs.String("reason", "", "reason returned to agents")
+		}
+		if err := fs.Parse(args); err != nil {
+			return "", "", nil, err
+		}
+		if (*account == "") == (*action == "") {
+			return "", "", nil, errors.New("set exactly one of --account and --action")
+		}
+		body := map[string]string{"account": *account, "action": *action}
+		if duration != nil && *duration > 0 {
+			body["for"] = duration.String()
+		}
+		if reason != nil {
+			body["reason"] = *reason
+		}
+		return http.MethodPost, "/" + cmd, body, nil
+	case "lockdown":
+		if len(args) == 0 || args[0] == "status" {
+			if len(args) > 1 {
+				return "", "", nil, errors.New("lockdown status takes no arguments")
+			}
+			return http.MethodGet, "/lockdown", nil, nil
+		}
+		if args[0] != "on" && args[0] != "off" {
+			return "", "", nil, fmt.Errorf("unknown lockdown command %q", args[0])
+		}
+		account := fs.String("account", "", "only lock down this account (default: whole broker)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return "", "", nil, err
+		}
+		return http.MethodPost, "/lockdown", map[string]any{"account": *account, "enabled": args[0] == "on"}, nil
+	}
+	return "", "", nil, fmt.Errorf("unknown command %q", cmd)
+}
+
+func call(ctx context.Context, socket, method, path string, body any) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://unix"+path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, raw, err
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gogcli-sandbox-admin [--socket PATH] <command> [flags]")
+	fmt.Println("")
+	fmt.Println("Global flags:")
+	fmt.Println("  --socket PATH     admin socket path (default: /run/gogcli-sandbox-admin.sock; env: GOGCLI_SANDBOX_ADMIN_SOCKET)")
+	fmt.Println("  --timeout DUR     request timeout (default: 15s)")
+	fmt.Println("")
+	fmt.Println("Views:")
+	fmt.Println("  policy       active policy source and hash, accounts and TLS clients")
+	fmt.Println("  labels       label cache status and contents per account")
+	fmt.Println("  ratelimits   request counts of rate-limited tokens")
+	fmt.Println("  outbox       delayed sends waiting to go out")
+	fmt.Println("  denials      the last 100 denied requests")
+	fmt.Println("  runners      gog concurrency, circuit breakers and response cache")
+	fmt.Println("  switches     accounts and actions disabled by an operator")
+	fmt.Println("")
+	fmt.Println("Controls:")
+	fmt.Println("  reload                                          reread the policy file")
+	fmt.Println("  flush [--account EMAIL]                         drop cached responses and label maps")
+	fmt.Println("  disable --account EMAIL|--action NAME [--for DUR] [--reason TEXT]")
+	fmt.Println("  enable --account EMAIL|--action NAME")
+	fmt.Println("  lockdown [status]                               show read-only lockdowns")
+	fmt.Println("  lockdown on|off [--account EMAIL]               freeze or unfreeze write actions")
+}
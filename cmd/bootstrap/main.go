@@ -111,6 +111,8 @@ func main() {
 
 	actions := []string{
 		"policy.actions",
+		"policy.schema",
+		"policy.explain",
 		"gmail.search",
 		"gmail.thread.list",
 		"gmail.get",
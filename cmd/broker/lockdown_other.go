@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+import "gogcli-sandbox/internal/broker"
+
+func watchLockdownSignals(b *broker.Broker) {}
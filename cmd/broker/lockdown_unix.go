@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gogcli-sandbox/internal/broker"
+)
+
+// watchLockdownSignals puts the whole broker in read-only lockdown on
+// SIGUSR1 and lifts it on SIGUSR2.
+func watchLockdownSignals(b *broker.Broker) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			b.SetLockdown("", sig == syscall.SIGUSR1, "signal")
+		}
+	}()
+}
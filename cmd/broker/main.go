@@ -1,30 +1,69 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/mail"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"gogcli-sandbox/internal/actions"
 	"gogcli-sandbox/internal/broker"
 	"gogcli-sandbox/internal/config"
+	"gogcli-sandbox/internal/cursor"
 	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/metrics"
+	"gogcli-sandbox/internal/outbox"
 	"gogcli-sandbox/internal/policy"
 	"gogcli-sandbox/internal/server"
+	"gogcli-sandbox/internal/token"
+	"gogcli-sandbox/internal/trace"
 )
 
 func main() {
+	gog.MaybeExecHelper()
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
 
+	pending, err := outbox.Open(cfg.OutboxPath)
+	if err != nil {
+		log.Fatalf("outbox error: %v", err)
+	}
+	if cfg.ListOutbox {
+		summaries := []outbox.Summary{}
+		for _, entry := range pending.List() {
+			summaries = append(summaries, entry.Summary())
+		}
+		payload, _ := json.MarshalIndent(summaries, "", "  ")
+		fmt.Println(string(payload))
+		return
+	}
+
+	if cfg.ActionsPath != "" {
+		if err := actions.LoadFile(cfg.ActionsPath); err != nil {
+			log.Fatalf("actions error: %v", err)
+		}
+	}
+
 	policies, err := policy.LoadSet(cfg.PolicyPath)
 	if err != nil {
 		log.Fatalf("policy error: %v", err)
 	}
+	if err := checkTokenFile(cfg, policies); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
 
 	var logger broker.Logger
 	if cfg.LogJSON {
@@ -33,29 +72,313 @@ func main() {
 		logger = broker.NewTextLogger()
 	}
 
-	runnerFactory := &gog.RunnerFactory{Path: cfg.GogPath, DefaultAccount: cfg.GogAccount, Timeout: cfg.Timeout}
+	var runnerFactory gog.RunnerProvider
+	var capabilities *gog.Capabilities
+	var gogFactory *gog.RunnerFactory
+	switch cfg.Runner {
+	case "api":
+		runnerFactory = &gog.APIFactory{
+			DefaultAccount:  cfg.GogAccount,
+			TokenFile:       cfg.API.TokenFile,
+			CredentialsFile: cfg.API.CredentialsFile,
+			TokenURL:        cfg.API.TokenURL,
+			GmailURL:        cfg.API.GmailURL,
+			CalendarURL:     cfg.API.CalendarURL,
+			Timeout:         cfg.Timeout,
+			MaxOutputBytes:  cfg.GogMaxOutput,
+			AttachmentDir:   cfg.API.AttachmentDir,
+		}
+	default:
+		gogFactory = &gog.RunnerFactory{
+			Path:           cfg.GogPath,
+			DefaultAccount: cfg.GogAccount,
+			Timeout:        cfg.Timeout,
+			Dir:            cfg.GogWorkDir,
+			MaxOutputBytes: cfg.GogMaxOutput,
+		}
+		if len(cfg.GogEnv) > 0 {
+			gogFactory.Env = append(append([]string{}, gog.DefaultEnv...), cfg.GogEnv...)
+		}
+		if cfg.GogSandbox != nil {
+			limits, helper, err := gogLimits(cfg)
+			if err != nil {
+				log.Fatalf("gog sandbox error: %v", err)
+			}
+			gogFactory.Limits = limits
+			gogFactory.Helper = helper
+		}
+		runnerFactory = gogFactory
+		if cfg.GogCheck != "off" {
+			capabilities = checkGog(cfg, gogFactory, policies, logger)
+		}
+	}
 
-	for account, pol := range policies.Accounts {
-		runner := runnerFactory.RunnerFor(account)
-		pol.SetTimeZoneProvider(calendarTimeZoneProvider(runner))
+	limiter := &gog.Limiter{
+		MaxInFlight:   cfg.MaxInFlight,
+		MaxPerAccount: cfg.MaxPerAccount,
+		MaxQueue:      cfg.QueueSize,
+		QueueTimeout:  cfg.QueueTimeout,
+	}
+	cache := gog.NewCache(cfg.CacheTTLs, cfg.CacheMaxEntries)
+	breaker := &gog.BreakerProvider{
+		Next: &gog.RetryProvider{
+			Next:        &gog.LimitedProvider{Next: runnerFactory, Limiter: limiter},
+			MaxAttempts: cfg.RetryAttempts,
+		},
+		Threshold: cfg.BreakerFailures,
+		Cooldown:  cfg.BreakerCooldown,
+	}
+	var runners gog.RunnerProvider = &gog.CachedProvider{Next: breaker, Cache: cache}
+
+	cursorKey, err := loadCursorKey(cfg.CursorKeyPath)
+	if err != nil {
+		log.Fatalf("cursor key error: %v", err)
+	}
+	cursors, err := cursor.NewSealer(cursorKey)
+	if err != nil {
+		log.Fatalf("cursor key error: %v", err)
 	}
 
 	b := &broker.Broker{
-		Policies:       policies,
-		RunnerProvider: runnerFactory,
-		DefaultAccount: cfg.GogAccount,
-		Logger:         logger,
-		Verbose:        cfg.Verbose,
+		Policies:         policies,
+		RunnerProvider:   runners,
+		DefaultAccount:   cfg.GogAccount,
+		Logger:           logger,
+		Verbose:          cfg.Verbose,
+		Outbox:           pending,
+		LabelTTL:         cfg.LabelCacheTTL,
+		Limiter:          limiter,
+		Breaker:          breaker,
+		Gog:              capabilities,
+		BatchMaxItems:    cfg.BatchMaxItems,
+		BatchParallelism: cfg.BatchParallel,
+		BatchTimeout:     cfg.BatchTimeout,
+		IterateTimeout:   cfg.IterateTimeout,
+		Cursors:          cursors,
+		LockdownFile:     cfg.LockdownFile,
+	}
+
+	breaker.ProbeAllowed = func(account, action string) bool {
+		pol, _, err := b.PolicySet().Resolve(account, cfg.GogAccount)
+		return err == nil && pol.IsActionAllowed(action)
+	}
+
+	b.RegisterMetrics(metrics.NewRegistry())
+	if exporter := traceExporter(cfg); exporter != nil {
+		b.Tracer = trace.NewTracer(exporter, func(err error) {
+			logger.Error("trace_export_failed", map[string]any{"error": err.Error()})
+		})
+	}
+	if gogFactory != nil {
+		gogFactory.Observer = b.ObserveGog
+	}
+
+	configure := func(set *policy.PolicySet) {
+		for account, pol := range set.Accounts {
+			runner := runners.RunnerFor(account)
+			pol.SetTimeZoneProvider(calendarTimeZoneProvider(runner))
+			pol.SetReplyRecipientsProvider(replyRecipientsProvider(runner))
+			pol.SetLabelRefresher(b.LabelRefresher(account, pol))
+			pol.SetPageCursors(account, cursors, cfg.CursorTTL)
+		}
+	}
+	configure(policies)
+	b.SetPolicies(policies, policyInfo(cfg.PolicyPath))
+	reloadPolicy := func() error {
+		set, err := policy.LoadSet(cfg.PolicyPath)
+		if err != nil {
+			return err
+		}
+		if err := checkTokenFile(cfg, set); err != nil {
+			return err
+		}
+		configure(set)
+		b.SetPolicies(set, policyInfo(cfg.PolicyPath))
+		return nil
+	}
+
+	var tokens *token.Store
+	if cfg.TokensPath != "" {
+		if tokens, err = token.NewStore(cfg.TokensPath); err != nil {
+			log.Fatalf("token file error: %v", err)
+		}
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := server.Serve(ctx, cfg.SocketPath, b, logger); err != nil {
+	go b.RunOutbox(ctx)
+	go b.WatchLockdownFile(ctx)
+	watchLockdownSignals(b)
+	if cfg.MetricsListen != "" {
+		go func() {
+			if err := server.ServeMetrics(ctx, cfg.MetricsListen, b.Metrics, logger); err != nil {
+				log.Fatalf("metrics server error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.TLSListen != "" {
+		tlsServer, err := server.NewTLSServer(cfg.TLSListen, server.TLSFiles{
+			Cert:     cfg.TLSCert,
+			Key:      cfg.TLSKey,
+			ClientCA: cfg.TLSClientCA,
+			Revoked:  cfg.TLSRevoked,
+		}, b, logger)
+		if err != nil {
+			log.Fatalf("tls listener error: %v", err)
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := tlsServer.Reload(); err != nil {
+					logger.Error("tls_reload_failed", map[string]any{"error": err.Error()})
+					continue
+				}
+				logger.Info("tls_reloaded", nil)
+			}
+		}()
+		go func() {
+			if err := tlsServer.Serve(ctx); err != nil {
+				log.Fatalf("tls server error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.AdminSocket != "" {
+		admin := &server.Admin{Broker: b, Cache: cache, Tokens: tokens, Reload: reloadPolicy, Logger: logger}
+		go func() {
+			if err := server.ServeAdmin(ctx, cfg.AdminSocket, admin); err != nil {
+				log.Fatalf("admin server error: %v", err)
+			}
+		}()
+	}
+
+	err = server.Serve(ctx, cfg.SocketPath, b, tokens, logger)
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_ = b.Tracer.Close(flushCtx)
+	cancel()
+	if err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
 
+func traceExporter(cfg *config.Config) trace.Exporter {
+	switch {
+	case cfg.TraceEndpoint != "":
+		return &trace.OTLPExporter{Endpoint: cfg.TraceEndpoint}
+	case cfg.TraceFile != "":
+		return &trace.FileExporter{Path: cfg.TraceFile}
+	}
+	return nil
+}
+
+// checkTokenFile rejects one api token file shared by several accounts,
+// which would all act with whichever account's token it holds.
+func checkTokenFile(cfg *config.Config, set *policy.PolicySet) error {
+	if cfg.Runner != "api" || len(set.Accounts) < 2 || strings.Contains(cfg.API.TokenFile, "{account}") {
+		return nil
+	}
+	return fmt.Errorf("api.token_file must contain {account} when the policy has %d accounts", len(set.Accounts))
+}
+
+// policyInfo identifies the policy file by a hash of its contents.
+func policyInfo(path string) broker.PolicyInfo {
+	info := broker.PolicyInfo{Source: path, LoadedAt: time.Now().UTC()}
+	if data, err := os.ReadFile(path); err == nil {
+		sum := sha256.Sum256(data)
+		info.Hash = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return info
+}
+
+// loadCursorKey reads the page cursor key. Without a key file the sealer
+// picks a random key, so cursors do not survive a restart.
+func loadCursorKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) < 32 {
+		return nil, fmt.Errorf("%s: key must be at least 32 bytes", path)
+	}
+	return key, nil
+}
+
+// checkGog probes the installed gog. In strict mode any mismatch, or a
+// policy allowing an action gog cannot run, stops the broker; in warn mode
+// mismatches are logged and the affected actions are disabled.
+func checkGog(cfg *config.Config, factory *gog.RunnerFactory, policies *policy.PolicySet, logger broker.Logger) *gog.Capabilities {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	caps, err := factory.Probe(ctx, cfg.GogMinVersion, cfg.GogMaxVersion)
+	if err != nil {
+		if cfg.GogCheck == "strict" {
+			log.Fatalf("gog check error: %v", err)
+		}
+		logger.Error("gog_check_failed", map[string]any{"error": err.Error()})
+		return nil
+	}
+	strict := cfg.GogCheck == "strict"
+	for _, problem := range caps.Problems {
+		if strict {
+			log.Fatalf("gog check error: %s", problem)
+		}
+		logger.Error("gog_unsupported", map[string]any{"version": caps.Version, "problem": problem})
+	}
+	for account, pol := range policies.Accounts {
+		for _, action := range pol.AllowedActions {
+			reason, disabled := caps.DisabledReason(action)
+			if !disabled {
+				continue
+			}
+			if strict {
+				log.Fatalf("gog check error: %s is allowed for %s but %s", action, account, reason)
+			}
+			logger.Error("action_disabled", map[string]any{"account": account, "action": action, "reason": reason})
+		}
+	}
+	logger.Info("gog_detected", map[string]any{"version": caps.Version, "supported": caps.Supported, "disabled_actions": len(caps.Disabled)})
+	return caps
+}
+
+func gogLimits(cfg *config.Config) (*gog.Limits, string, error) {
+	if !gog.HelperSupported {
+		return nil, "", errors.New("gog_sandbox is not supported on this platform")
+	}
+	helper, err := os.Executable()
+	if err != nil {
+		return nil, "", err
+	}
+	sandbox := cfg.GogSandbox
+	limits := &gog.Limits{
+		CPUSeconds:    sandbox.CPUSeconds,
+		MemoryBytes:   sandbox.MemoryMB << 20,
+		FileSizeBytes: sandbox.FileSizeMB << 20,
+		OpenFiles:     sandbox.OpenFiles,
+		Landlock:      sandbox.Landlock,
+		WritablePaths: sandbox.WritablePaths,
+	}
+	if limits.Landlock && len(limits.WritablePaths) == 0 {
+		limits.WritablePaths = []string{os.TempDir()}
+		if cfg.GogWorkDir != "" {
+			limits.WritablePaths = append(limits.WritablePaths, cfg.GogWorkDir)
+		}
+		if dir, err := os.UserConfigDir(); err == nil {
+			limits.WritablePaths = append(limits.WritablePaths, dir)
+		}
+		if dir, err := os.UserCacheDir(); err == nil {
+			limits.WritablePaths = append(limits.WritablePaths, dir)
+		}
+	}
+	return limits, helper, nil
+}
+
 func calendarTimeZoneProvider(runner gog.Runner) func(context.Context) (*time.Location, error) {
 	return func(ctx context.Context) (*time.Location, error) {
 		data, err := runner.Run(ctx, "calendar.list", map[string]interface{}{"max": 250})
@@ -108,7 +431,104 @@ func calendarTimeZoneProvider(runner gog.Runner) func(context.Context) (*time.Lo
 	}
 }
 
+func replyRecipientsProvider(runner gog.Runner) func(context.Context, string) ([]string, error) {
+	return func(ctx context.Context, messageID string) ([]string, error) {
+		data, err := runner.Run(ctx, "gmail.get", map[string]interface{}{"message_id": messageID, "format": "metadata"})
+		if err != nil {
+			return nil, err
+		}
+		threadID := findString(data, "threadId", "thread_id")
+		if threadID != "" {
+			thread, err := runner.Run(ctx, "gmail.thread.get", map[string]interface{}{"thread_id": threadID})
+			if err != nil {
+				return nil, err
+			}
+			data = thread
+		}
+		set := map[string]struct{}{}
+		collectParticipants(data, set)
+		if len(set) == 0 {
+			return nil, errInvalidMessage
+		}
+		out := make([]string, 0, len(set))
+		for addr := range set {
+			out = append(out, addr)
+		}
+		return out, nil
+	}
+}
+
+var participantHeaders = map[string]struct{}{
+	"from":     {},
+	"to":       {},
+	"cc":       {},
+	"reply-to": {},
+	"sender":   {},
+}
+
+func collectParticipants(val any, set map[string]struct{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		if name, ok := v["name"].(string); ok {
+			if _, ok := participantHeaders[strings.ToLower(name)]; ok {
+				if value, ok := v["value"].(string); ok {
+					addParticipants(value, set)
+				}
+			}
+		}
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				if _, ok := participantHeaders[strings.ToLower(key)]; ok {
+					addParticipants(s, set)
+				}
+				continue
+			}
+			collectParticipants(item, set)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectParticipants(item, set)
+		}
+	}
+}
+
+func addParticipants(value string, set map[string]struct{}) {
+	addrs, err := mail.ParseAddressList(value)
+	if err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		if addr.Address != "" {
+			set[strings.ToLower(addr.Address)] = struct{}{}
+		}
+	}
+}
+
+func findString(val any, keys ...string) string {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for _, key := range keys {
+			if s, ok := v[key].(string); ok && s != "" {
+				return s
+			}
+		}
+		for _, item := range v {
+			if s := findString(item, keys...); s != "" {
+				return s
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s := findString(item, keys...); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
 var errInvalidCalendarList = logError("invalid calendar list response")
+var errInvalidMessage = logError("invalid message response")
 
 type logError string
 
@@ -34,6 +34,22 @@ func main() {
 	cmd := args[0]
 	cmdArgs := args[1:]
 
+	if cmd == "batch" {
+		if err := runBatch(cfg, cmdArgs); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if cmd == "iterate" {
+		if err := runIterate(cfg, cmdArgs); err != nil {
+			if errors.Is(err, errHelp) {
+				return
+			}
+			fatal(err)
+		}
+		return
+	}
+
 	action, params, err := parseCommand(cmd, cmdArgs)
 	if err != nil {
 		if errors.Is(err, errHelp) {
@@ -68,10 +84,11 @@ type config struct {
 	Timeout time.Duration
 	Pretty  bool
 	ID      string
+	Token   string
 }
 
 func parseGlobal(args []string) (config, []string, error) {
-	cfg := config{}
+	cfg := config{Token: os.Getenv("GOGCLI_SANDBOX_TOKEN")}
 	defaultSock := os.Getenv("GOGCLI_SANDBOX_SOCKET")
 	if defaultSock == "" {
 		defaultSock = defaultSocket
@@ -102,6 +119,8 @@ func parseCommand(cmd string, args []string) (string, map[string]interface{}, er
 		return parseGmailGet(args)
 	case "gmail.send":
 		return parseGmailSend(args)
+	case "gmail.send.cancel":
+		return parseGmailSendCancel(args)
 	case "gmail.labels.list":
 		return parseGmailLabelsList(args)
 	case "gmail.labels.get", "gmail.lables.get":
@@ -110,6 +129,10 @@ func parseCommand(cmd string, args []string) (string, map[string]interface{}, er
 		return parseGmailLabelsModify(args)
 	case "policy.actions":
 		return parsePolicyActions(args)
+	case "policy.schema":
+		return parsePolicySchema(args)
+	case "explain", "policy.explain":
+		return parsePolicyExplain(args)
 	case "calendar.list":
 		return parseCalendarList(args)
 	case "calendar.events":
@@ -129,6 +152,9 @@ func parseCommand(cmd string, args []string) (string, map[string]interface{}, er
 		printUsage("policy")
 		return "", nil, errHelp
 	default:
+		if strings.Contains(cmd, ".") {
+			return parseGeneric(cmd, args)
+		}
 		return "", nil, fmt.Errorf("unknown command: %s", cmd)
 	}
 }
@@ -307,6 +333,22 @@ func parseGmailSend(args []string) (string, map[string]interface{}, error) {
 	return "gmail.send", params, nil
 }
 
+func parseGmailSendCancel(args []string) (string, map[string]interface{}, error) {
+	fs := flag.NewFlagSet("gmail.send.cancel", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	id := fs.String("id", "", "pending send id (required)")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	if *id == "" && fs.NArg() > 0 {
+		*id = fs.Arg(0)
+	}
+	if strings.TrimSpace(*id) == "" {
+		return "", nil, fmt.Errorf("--id is required")
+	}
+	return "gmail.send.cancel", map[string]interface{}{"id": *id}, nil
+}
+
 func parseGmailLabelsList(args []string) (string, map[string]interface{}, error) {
 	fs := flag.NewFlagSet("gmail.labels.list", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -493,16 +535,99 @@ func parsePolicyActions(args []string) (string, map[string]interface{}, error) {
 	return "policy.actions", map[string]interface{}{}, nil
 }
 
+func parsePolicySchema(args []string) (string, map[string]interface{}, error) {
+	fs := flag.NewFlagSet("policy.schema", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	action := fs.String("action", "", "only this action (optional)")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	if *action == "" && fs.NArg() > 0 {
+		*action = fs.Arg(0)
+	}
+	params := map[string]interface{}{}
+	if *action != "" {
+		params["action"] = *action
+	}
+	return "policy.schema", params, nil
+}
+
+// parsePolicyExplain wraps another command: explain gmail.send --to ... asks
+// the broker how it would rewrite that request without running it.
+func parsePolicyExplain(args []string) (string, map[string]interface{}, error) {
+	if len(args) == 0 {
+		return "", nil, errors.New("explain requires a command, e.g. explain gmail.search --query QUERY")
+	}
+	if args[0] == "explain" || args[0] == "policy.explain" {
+		return "", nil, errors.New("explain cannot wrap itself")
+	}
+	action, params, err := parseCommand(args[0], args[1:])
+	if err != nil {
+		return "", nil, err
+	}
+	return "policy.explain", map[string]interface{}{"action": action, "params": params}, nil
+}
+
+// parseGeneric handles actions defined in the broker's action spec file:
+// params come from --params JSON and/or key=value arguments, where values
+// that parse as JSON keep their type.
+func parseGeneric(cmd string, args []string) (string, map[string]interface{}, error) {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	raw := fs.String("params", "", "params as a JSON object")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	params := map[string]interface{}{}
+	if *raw != "" {
+		if err := json.Unmarshal([]byte(*raw), &params); err != nil {
+			return "", nil, fmt.Errorf("--params: %w", err)
+		}
+	}
+	for _, arg := range fs.Args() {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return "", nil, fmt.Errorf("expected key=value, got %q", arg)
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		params[key] = parsed
+	}
+	return cmd, params, nil
+}
+
 func doRequest(cfg config, action string, params map[string]interface{}) (*types.Response, []byte, error) {
 	reqPayload := &types.Request{ID: cfg.ID, Action: action, Account: cfg.Account, Params: params}
 	body, err := json.Marshal(reqPayload)
 	if err != nil {
 		return nil, nil, err
 	}
+	raw, err := post(cfg, "/v1/request", body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var parsed types.Response
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, raw, fmt.Errorf("invalid response json: %w", err)
+	}
+	return &parsed, raw, nil
+}
 
+func post(cfg config, path string, body []byte) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
 	defer cancel()
 
+	resp, err := send(ctx, cfg, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func send(ctx context.Context, cfg config, path string, body []byte) (*http.Response, error) {
 	client := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -510,28 +635,162 @@ func doRequest(cfg config, action string, params map[string]interface{}) (*types
 			},
 		},
 	}
-	url := "http://unix/v1/request"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://unix"+path, bytes.NewReader(body))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	return client.Do(req)
+}
 
-	resp, err := client.Do(req)
+// runIterate streams an action's pages from /v1/iterate, printing each NDJSON
+// chunk as it arrives. The broker's iterate timeout bounds the stream, so
+// --timeout does not apply.
+func runIterate(cfg config, args []string) error {
+	fs := flag.NewFlagSet("iterate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cursor := fs.String("cursor", "", "cursor from a previous iterate call")
+	maxItems := fs.Int("max-items", 0, "stop after this many items (0: policy limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("iterate requires a command, e.g. iterate gmail.search --query QUERY")
+	}
+	action, params, err := parseCommand(fs.Arg(0), fs.Args()[1:])
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	if cfg.ID == "" {
+		if cfg.ID, err = newID(); err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(&types.IterateRequest{
+		Request:  types.Request{ID: cfg.ID, Action: action, Account: cfg.Account, Params: params},
+		Cursor:   *cursor,
+		MaxItems: *maxItems,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := send(context.Background(), cfg, "/v1/iterate", body)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		var single types.Response
+		if json.Unmarshal(raw, &single) == nil && single.Error != nil {
+			writeResponse(cfg, &single, raw)
+			os.Exit(1)
+		}
+		return fmt.Errorf("unexpected response: %s", raw)
+	}
 
-	raw, err := io.ReadAll(resp.Body)
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk types.Chunk
+		if err := decoder.Decode(&chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("iterate stream ended without a final chunk")
+			}
+			return err
+		}
+		var out []byte
+		if cfg.Pretty {
+			out, err = json.MarshalIndent(&chunk, "", "  ")
+		} else {
+			out, err = json.Marshal(&chunk)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		if !chunk.Done {
+			continue
+		}
+		if chunk.Error != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", chunk.Error.Code, chunk.Error.Message)
+			os.Exit(1)
+		}
+		if chunk.Cursor != "" {
+			fmt.Fprintln(os.Stderr, "more results: rerun with --cursor from the last line")
+		}
+		return nil
+	}
+}
+
+// runBatch sends a JSON array of requests (from --file or stdin) to
+// /v1/batch. Missing ids are generated and missing accounts default to
+// --account.
+func runBatch(cfg config, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("file", "-", "JSON array of requests (- for stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
-	var parsed types.Response
-	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return nil, raw, fmt.Errorf("invalid response json: %w", err)
+	var reqs []*types.Request
+	if err := json.Unmarshal(data, &reqs); err != nil {
+		return fmt.Errorf("batch input must be a JSON array of requests: %w", err)
 	}
-	return &parsed, raw, nil
+	for _, req := range reqs {
+		if req == nil {
+			continue
+		}
+		if req.ID == "" {
+			if req.ID, err = newID(); err != nil {
+				return err
+			}
+		}
+		if req.Account == "" {
+			req.Account = cfg.Account
+		}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+	raw, err := post(cfg, "/v1/batch", body)
+	if err != nil {
+		return err
+	}
+	var parsed types.BatchResponse
+	if err := json.Unmarshal(raw, &parsed); err != nil || parsed.Responses == nil {
+		var single types.Response
+		if json.Unmarshal(raw, &single) == nil && single.Error != nil {
+			writeResponse(cfg, &single, raw)
+			os.Exit(1)
+		}
+		return fmt.Errorf("invalid response json: %s", raw)
+	}
+	if cfg.Pretty {
+		if pretty, err := json.MarshalIndent(parsed, "", "  "); err == nil {
+			raw = pretty
+		}
+	}
+	fmt.Println(strings.TrimSpace(string(raw)))
+	for _, resp := range parsed.Responses {
+		if resp == nil || !resp.Ok {
+			os.Exit(1)
+		}
+	}
+	return nil
 }
 
 func writeResponse(cfg config, resp *types.Response, raw []byte) {
@@ -582,6 +841,7 @@ func printUsage(section string) {
 		fmt.Println("  gmail.thread.modify Modify labels on a thread")
 		fmt.Println("  gmail.get           Get a message (metadata)")
 		fmt.Println("  gmail.send          Send or draft an email (policy controlled)")
+		fmt.Println("  gmail.send.cancel   Cancel a delayed send")
 		fmt.Println("  gmail.labels.list   List labels")
 		fmt.Println("  gmail.labels.get    Get label details")
 		fmt.Println("  gmail.labels.modify Modify labels on multiple threads")
@@ -595,6 +855,8 @@ func printUsage(section string) {
 	case "policy":
 		fmt.Println("policy commands:")
 		fmt.Println("  policy.actions      List allowed actions")
+		fmt.Println("  policy.schema       JSON Schema of allowed actions' params")
+		fmt.Println("  policy.explain      How the policy would rewrite or deny a command (explain <command> ...)")
 		return
 	}
 
@@ -608,12 +870,16 @@ func printUsage(section string) {
 	fmt.Println("  --pretty          pretty-print JSON output")
 	fmt.Println("  --id ID           request id (optional)")
 	fmt.Println("")
+	fmt.Println("Environment:")
+	fmt.Println("  GOGCLI_SANDBOX_TOKEN   bearer token sent to brokers that require one")
+	fmt.Println("")
 	fmt.Println("Commands:")
 	fmt.Println("  gmail.search")
 	fmt.Println("  gmail.thread.get")
 	fmt.Println("  gmail.thread.modify")
 	fmt.Println("  gmail.get")
 	fmt.Println("  gmail.send")
+	fmt.Println("  gmail.send.cancel")
 	fmt.Println("  gmail.labels.list")
 	fmt.Println("  gmail.labels.get")
 	fmt.Println("  gmail.labels.modify")
@@ -621,7 +887,11 @@ func printUsage(section string) {
 	fmt.Println("  calendar.events")
 	fmt.Println("  calendar.freebusy")
 	fmt.Println("  policy.actions")
-	fmt.Println("  policy.actions")
+	fmt.Println("  policy.schema")
+	fmt.Println("  explain <command> [command flags]   show how the policy would rewrite or deny a command")
+	fmt.Println("  batch [--file PATH]   send a JSON array of requests (default: stdin) to /v1/batch")
+	fmt.Println("  iterate [--cursor C] [--max-items N] <command> [command flags]   stream every page as NDJSON")
+	fmt.Println("  <service.action> [--params JSON] [key=value ...]   actions from the broker's action spec file")
 	fmt.Println("")
 	fmt.Println("Help:")
 	fmt.Println("  gogcli-sandbox-client help")
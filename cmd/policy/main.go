@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/config"
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/policy"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "test":
+		err = runTest(os.Args[2:])
+	case "effective":
+		err = runEffective(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gogcli-sandbox-policy lint [--labels FILE] [--calendars FILE] [--account EMAIL] [--json]")
+	fmt.Println("  gogcli-sandbox-policy test [--labels FILE] CASES.{json,yaml} ...")
+	fmt.Println("  gogcli-sandbox-policy effective [--account EMAIL]")
+	fmt.Println("")
+	fmt.Println("All commands take --policy PATH (default: $XDG_CONFIG_HOME/gogcli-sandbox/policy.json)")
+	fmt.Println("and --actions PATH for policies that allow actions from an action spec file.")
+	fmt.Println("--labels and --calendars read snapshots saved with `gog gmail labels list --json` and")
+	fmt.Println("`gog calendar calendars --json`; test never runs gog.")
+}
+
+type common struct {
+	policy  *string
+	actions *string
+}
+
+func commonFlags(fs *flag.FlagSet) common {
+	defaultPolicy, _ := config.DefaultPolicyPath()
+	return common{
+		policy:  fs.String("policy", defaultPolicy, "policy file"),
+		actions: fs.String("actions", "", "action spec file (optional)"),
+	}
+}
+
+func labelsFlag(fs *flag.FlagSet) *string {
+	return fs.String("labels", "", "labels snapshot: gog gmail labels list --json output (optional)")
+}
+
+func (c common) loadActions() error {
+	if *c.actions == "" {
+		return nil
+	}
+	return actions.LoadFile(*c.actions)
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	c := commonFlags(fs)
+	labelsPath := labelsFlag(fs)
+	calendars := fs.String("calendars", "", "calendars snapshot: gog calendar calendars --json output (optional)")
+	account := fs.String("account", "", "account the snapshots belong to (default: every account)")
+	asJSON := fs.Bool("json", false, "print findings as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := c.loadActions(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*c.policy)
+	if err != nil {
+		return err
+	}
+
+	inv := &policy.Inventory{}
+	if *labelsPath != "" {
+		labels, err := readLabels(*labelsPath)
+		if err != nil {
+			return err
+		}
+		for id, name := range labels {
+			inv.Labels = append(inv.Labels, id, name)
+		}
+	}
+	if *calendars != "" {
+		if inv.Calendars, err = readCalendars(*calendars); err != nil {
+			return err
+		}
+	}
+	findings := policy.Lint(data, map[string]*policy.Inventory{strings.ToLower(strings.TrimSpace(*account)): inv})
+
+	failed := false
+	for _, f := range findings {
+		failed = failed || f.Severity == policy.SeverityError
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"findings": findings}); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			where := *c.policy
+			if f.Account != "" {
+				where += ": " + f.Account
+			}
+			if len(f.Extends) > 0 {
+				where += " (extends " + policy.FormatExtends(f.Extends) + ")"
+			}
+			fmt.Printf("%s: %s: %s\n", f.Severity, where, f.Message)
+		}
+	}
+	if failed {
+		return errors.New("policy has errors")
+	}
+	return nil
+}
+
+// runEffective prints each account's policy with its profiles applied.
+func runEffective(args []string) error {
+	fs := flag.NewFlagSet("effective", flag.ContinueOnError)
+	c := commonFlags(fs)
+	account := fs.String("account", "", "only this account (default: every account)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := c.loadActions(); err != nil {
+		return err
+	}
+	set, err := policy.LoadSet(*c.policy)
+	if err != nil {
+		return fmt.Errorf("load policy: %w", err)
+	}
+	type effective struct {
+		Extends []policy.ProfileTree `json:"extends,omitempty"`
+		Policy  *policy.Policy       `json:"policy"`
+	}
+	out := map[string]effective{}
+	for name, pol := range set.Accounts {
+		out[name] = effective{Extends: set.Extends(name), Policy: pol}
+	}
+	if *account != "" {
+		pol, name, err := set.Resolve(*account, "")
+		if err != nil {
+			return fmt.Errorf("account %s: %w", *account, err)
+		}
+		out = map[string]effective{name: {Extends: set.Extends(name), Policy: pol}}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"accounts": out})
+}
+
+// testCase is one expectation: the request, then expect (allow, deny or
+// rewrite) and optional checks on the explanation.
+type testCase struct {
+	Name        string                 `json:"name"`
+	Account     string                 `json:"account"`
+	Action      string                 `json:"action"`
+	Params      map[string]interface{} `json:"params"`
+	Expect      string                 `json:"expect"`
+	Code        string                 `json:"code"`
+	Reason      string                 `json:"reason"`
+	FinalAction string                 `json:"final_action"`
+	Rewritten   map[string]interface{} `json:"rewritten"`
+	Rules       []string               `json:"rules"`
+}
+
+func runTest(args []string) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c := commonFlags(fs)
+	labelsPath := labelsFlag(fs)
+	verbose := fs.Bool("v", false, "print passing cases too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: gogcli-sandbox-policy test [flags] CASES.{json,yaml} ...")
+	}
+	if err := c.loadActions(); err != nil {
+		return err
+	}
+	set, err := policy.LoadSet(*c.policy)
+	if err != nil {
+		return fmt.Errorf("load policy: %w", err)
+	}
+	offline := offlineRunner{}
+	if *labelsPath != "" {
+		if offline.labels, err = readLabels(*labelsPath); err != nil {
+			return err
+		}
+	}
+	b := &broker.Broker{Policies: set, RunnerProvider: offline}
+
+	passed, failed := 0, 0
+	for _, path := range fs.Args() {
+		cases, err := readCases(path)
+		if err != nil {
+			return err
+		}
+		for i, tc := range cases {
+			name := tc.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d %s", i+1, tc.Action)
+			}
+			got := b.Explain(context.Background(), tc.Account, tc.Action, tc.Params)
+			if problems := check(tc, got); len(problems) > 0 {
+				failed++
+				fmt.Printf("FAIL %s: %s\n", path, name)
+				for _, p := range problems {
+					fmt.Printf("    %s\n", p)
+				}
+				continue
+			}
+			passed++
+			if *verbose {
+				fmt.Printf("ok   %s: %s\n", path, name)
+			}
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return errors.New("policy tests failed")
+	}
+	return nil
+}
+
+func readCases(path string) ([]testCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		doc, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	var cases []testCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, tc := range cases {
+		if tc.Action == "" {
+			return nil, fmt.Errorf("%s: case %d: action is required", path, i+1)
+		}
+		switch tc.Expect {
+		case "allow", "deny", "rewrite":
+		default:
+			return nil, fmt.Errorf("%s: case %d: expect must be allow, deny or rewrite", path, i+1)
+		}
+	}
+	return cases, nil
+}
+
+func check(tc testCase, got *broker.Explanation) []string {
+	problems := []string{}
+	decision := got.Decision
+	if decision == "allow" && rewrote(tc, got) {
+		decision = "rewrite"
+	}
+	if decision != tc.Expect && !(tc.Expect == "allow" && decision == "rewrite") {
+		problem := fmt.Sprintf("expected %s, got %s", tc.Expect, decision)
+		if got.Decision == "deny" {
+			problem += fmt.Sprintf(" (%s: %s)", got.Code, got.Reason)
+		}
+		problems = append(problems, problem)
+	}
+	if tc.Code != "" && got.Code != tc.Code {
+		problems = append(problems, fmt.Sprintf("expected code %s, got %q", tc.Code, got.Code))
+	}
+	if tc.Reason != "" && !strings.Contains(got.Reason, tc.Reason) {
+		problems = append(problems, fmt.Sprintf("expected reason containing %q, got %q", tc.Reason, got.Reason))
+	}
+	if tc.FinalAction != "" && got.FinalAction != tc.FinalAction {
+		problems = append(problems, fmt.Sprintf("expected final action %s, got %q", tc.FinalAction, got.FinalAction))
+	}
+	for key, want := range tc.Rewritten {
+		if !sameJSON(got.Params[key], want) {
+			problems = append(problems, fmt.Sprintf("expected params.%s = %s, got %s", key, toJSON(want), toJSON(got.Params[key])))
+		}
+	}
+	for _, rule := range tc.Rules {
+		found := false
+		for _, fired := range got.Rules {
+			found = found || fired == rule
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("expected rule %s, fired %v", rule, got.Rules))
+		}
+	}
+	return problems
+}
+
+// rewrote reports whether an allowed request was changed on the way to gog.
+func rewrote(tc testCase, got *broker.Explanation) bool {
+	if len(got.Rules) > 0 || got.FinalAction != tc.Action {
+		return true
+	}
+	params := tc.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return !sameJSON(got.Params, params)
+}
+
+func sameJSON(a, b any) bool {
+	var x, y any
+	if json.Unmarshal([]byte(toJSON(a)), &x) != nil || json.Unmarshal([]byte(toJSON(b)), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func toJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func readLabels(path string) (map[string]string, error) {
+	var snapshot struct {
+		Labels []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+	if err := readJSON(path, &snapshot); err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for _, l := range snapshot.Labels {
+		if l.ID != "" && l.Name != "" {
+			labels[l.ID] = l.Name
+		}
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("%s: no labels found", path)
+	}
+	return labels, nil
+}
+
+func readCalendars(path string) ([]string, error) {
+	var snapshot struct {
+		Calendars []struct {
+			ID string `json:"id"`
+		} `json:"calendars"`
+	}
+	if err := readJSON(path, &snapshot); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, c := range snapshot.Calendars {
+		if c.ID != "" {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%s: no calendars found", path)
+	}
+	return ids, nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// offlineRunner answers label lookups from the snapshot and refuses
+// everything else, so test cases never reach gog.
+type offlineRunner struct {
+	labels map[string]string
+}
+
+func (o offlineRunner) RunnerFor(string) gog.Runner {
+	return o
+}
+
+func (o offlineRunner) Run(_ context.Context, action string, _ map[string]interface{}) (any, error) {
+	if action != "gmail.labels.list" || o.labels == nil {
+		return nil, fmt.Errorf("offline: %s needs gog (pass --labels for label lookups)", action)
+	}
+	items := []interface{}{}
+	for id, name := range o.labels {
+		items = append(items, map[string]interface{}{"id": id, "name": name})
+	}
+	return map[string]interface{}{"labels": items}, nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the YAML subset test case files need: block mappings and
+// sequences, flow [..] and {..} collections, quoted and plain scalars and
+// comments. Anchors, tags, block scalars (| and >) and multiple documents
+// are rejected rather than misread.
+func parseYAML(data []byte) (any, error) {
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func yamlLines(src string) ([]yamlLine, error) {
+	var out []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		text := stripYAMLComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		if trimmed == "---" || strings.HasPrefix(trimmed, "--- ") {
+			if len(out) > 0 {
+				return nil, fmt.Errorf("line %d: multiple documents are not supported", i+1)
+			}
+			continue
+		}
+		out = append(out, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	return out, nil
+}
+
+// stripYAMLComment cuts a # comment that starts a line or follows a space,
+// outside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := p.lines[len(p.lines)-1].num
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].num
+	}
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			item, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isSeqItem(rest) {
+			// "- key: value" opens a mapping indented to the key.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		item, err := parseYAMLValue(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		items = append(items, item)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	out := map[string]any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		text := p.lines[p.pos].text
+		if isSeqItem(text) {
+			return nil, p.errorf("unexpected sequence item")
+		}
+		key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		if rest != "" {
+			v, err := parseYAMLValue(rest)
+			if err != nil {
+				p.pos--
+				return nil, p.errorf("%v", err)
+			}
+			out[key] = v
+			continue
+		}
+		// A sequence may sit at the key's own indentation.
+		if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+			v, err := p.sequence(indent)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+			continue
+		}
+		v, err := p.nested(indent)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return out, nil
+}
+
+// nested parses the block under a "key:" or "-" line, or null when the
+// next line is not indented further.
+func (p *yamlParser) nested(indent int) (any, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.pos].indent)
+}
+
+// splitYAMLKey splits "key: value" at the first colon followed by a space
+// or the end of the line, outside quotes and flow collections.
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0 && (i+1 == len(text) || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if key == "" {
+				return "", "", false
+			}
+			if key[0] == '"' || key[0] == '\'' {
+				v, err := parseYAMLScalar(key)
+				s, ok := v.(string)
+				if err != nil || !ok {
+					return "", "", false
+				}
+				key = s
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func parseYAMLValue(text string) (any, error) {
+	if text[0] == '[' || text[0] == '{' {
+		f := &yamlFlow{s: text}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if f.skipSpace(); f.i < len(f.s) {
+			return nil, fmt.Errorf("unexpected %q after flow collection", f.s[f.i:])
+		}
+		return v, nil
+	}
+	return parseYAMLScalar(text)
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+func parseYAMLScalar(text string) (any, error) {
+	switch text[0] {
+	case '"':
+		if len(text) < 2 || text[len(text)-1] != '"' {
+			return nil, errors.New("unterminated double-quoted string")
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double-quoted string %s", text)
+		}
+		return s, nil
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, errors.New("unterminated single-quoted string")
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '|', '>':
+		return nil, errors.New("block scalars (| and >) are not supported")
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if yamlNumber.MatchString(text) {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return text, nil
+}
+
+// yamlFlow parses a flow collection such as [a, "b"] or {k: v}.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return nil, errors.New("unterminated flow collection")
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		items := []any{}
+		for {
+			if f.skipSpace(); f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return items, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			if err := f.next(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		out := map[string]any{}
+		for {
+			if f.skipSpace(); f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return out, nil
+			}
+			k, err := f.scalar(":")
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok || f.i >= len(f.s) || f.s[f.i] != ':' {
+				return nil, fmt.Errorf("expected key: value in %s", f.s)
+			}
+			f.i++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+			if err := f.next('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f.scalar(",]}")
+}
+
+// next consumes the comma between items, leaving the closing bracket for
+// the caller's loop.
+func (f *yamlFlow) next(closing byte) error {
+	f.skipSpace()
+	switch {
+	case f.i < len(f.s) && f.s[f.i] == ',':
+		f.i++
+		return nil
+	case f.i < len(f.s) && f.s[f.i] == closing:
+		return nil
+	}
+	return fmt.Errorf("expected , or %c in %s", closing, f.s)
+}
+
+func (f *yamlFlow) scalar(stops string) (any, error) {
+	f.skipSpace()
+	start := f.i
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		quote := f.s[f.i]
+		for f.i++; ; f.i++ {
+			if f.i >= len(f.s) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			if quote == '"' && f.s[f.i] == '\\' {
+				f.i++
+			} else if f.s[f.i] == quote {
+				if quote == '\'' && f.i+1 < len(f.s) && f.s[f.i+1] == '\'' {
+					f.i++
+					continue
+				}
+				break
+			}
+		}
+		f.i++
+		v, err := parseYAMLScalar(f.s[start:f.i])
+		f.skipSpace()
+		return v, err
+	}
+	for f.i < len(f.s) && !strings.ContainsRune(stops, rune(f.s[f.i])) {
+		f.i++
+	}
+	text := strings.TrimSpace(f.s[start:f.i])
+	if text == "" {
+		return nil, fmt.Errorf("missing value in %s", f.s)
+	}
+	return parseYAMLScalar(text)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAMLCases(t *testing.T) {
+	src := `# policy tests
+- name: "search is bounded"   # quoted
+  action: gmail.search
+  params:
+    query: from:boss
+    max: 10
+  expect: rewrite
+  rules: [query_rewritten:newer_than, 'it''s']
+- name: no tracking
+  action: gmail.send
+  params: {to: a@example.com, track: true, cc: ~}
+  expect: deny
+  reason: "tracking #1"
+  labels:
+  - INBOX
+  -
+    nested: yes
+`
+	got, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []any{
+		map[string]any{
+			"name":   "search is bounded",
+			"action": "gmail.search",
+			"params": map[string]any{"query": "from:boss", "max": float64(10)},
+			"expect": "rewrite",
+			"rules":  []any{"query_rewritten:newer_than", "it's"},
+		},
+		map[string]any{
+			"name":   "no tracking",
+			"action": "gmail.send",
+			"params": map[string]any{"to": "a@example.com", "track": true, "cc": nil},
+			"expect": "deny",
+			"reason": "tracking #1",
+			"labels": []any{"INBOX", map[string]any{"nested": "yes"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected document:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseYAMLRejectsUnsupported(t *testing.T) {
+	for _, src := range []string{
+		"body: |\n  text\n",
+		"a: &x 1\nb: *x\n",
+		"a: 1\na: 2\n",
+		"a: 1\n   b: 2\n",
+		"a: [1, 2\n",
+		"- a\n---\n- b\n",
+	} {
+		if _, err := parseYAML([]byte(src)); err == nil {
+			t.Fatalf("expected %q to be rejected", src)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gogcli-sandbox/internal/config"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/token"
+)
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "mint":
+		err = runMint(os.Args[2:])
+	case "list":
+		err = runList(os.Args[2:])
+	case "revoke":
+		err = runRevoke(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gogcli-sandbox-token mint --account EMAIL [--action NAME ...] [--name TEXT] [--ttl DUR] [--per-minute N] [--per-hour N]")
+	fmt.Println("  gogcli-sandbox-token list")
+	fmt.Println("  gogcli-sandbox-token revoke ID")
+	fmt.Println("")
+	fmt.Println("All commands take --tokens PATH (default: $XDG_CONFIG_HOME/gogcli-sandbox/tokens.json).")
+	fmt.Println("The broker only checks tokens when started with --token-file pointing at the same file.")
+}
+
+func tokensFlag(fs *flag.FlagSet) *string {
+	defaultPath, _ := config.DefaultTokensPath()
+	return fs.String("tokens", defaultPath, "token file path")
+}
+
+func runMint(args []string) error {
+	fs := flag.NewFlagSet("mint", flag.ContinueOnError)
+	path := tokensFlag(fs)
+	defaultPolicy, _ := config.DefaultPolicyPath()
+	policyPath := fs.String("policy", defaultPolicy, "policy file the token's account and actions are checked against")
+	account := fs.String("account", "", "account the token may use (required)")
+	var actions stringList
+	fs.Var(&actions, "action", "allowed action (repeat or comma-separated; default: every action the account policy allows)")
+	name := fs.String("name", "", "label shown by list (optional)")
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "how long the token stays valid")
+	perMinute := fs.Int("per-minute", 0, "max requests per minute (0: unlimited)")
+	perHour := fs.Int("per-hour", 0, "max requests per hour (0: unlimited)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *account == "" {
+		return errors.New("--account is required")
+	}
+	if *ttl <= 0 {
+		return errors.New("--ttl must be positive")
+	}
+	if *perMinute < 0 || *perHour < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+
+	policies, err := policy.LoadSet(*policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy: %w", err)
+	}
+	pol, normalized, err := policies.Resolve(*account, "")
+	if err != nil {
+		return fmt.Errorf("account %s: %w", *account, err)
+	}
+	for _, action := range actions {
+		if !pol.IsActionAllowed(action) {
+			return fmt.Errorf("action %s is not allowed by %s's policy", action, normalized)
+		}
+	}
+
+	f, err := token.Load(*path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	raw, minted, err := f.Mint(token.Token{
+		Name:      *name,
+		Account:   normalized,
+		Actions:   actions,
+		Limits:    token.Limits{PerMinute: *perMinute, PerHour: *perHour},
+		ExpiresAt: now.Add(*ttl),
+	}, now)
+	if err != nil {
+		return err
+	}
+	if err := token.Save(*path, f); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "minted token %s for %s, expires %s; it is shown only once\n", minted.ID, minted.Account, minted.ExpiresAt.Format(time.RFC3339))
+	fmt.Println(raw)
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	path := tokensFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := token.Load(*path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tACCOUNT\tACTIONS\tLIMITS\tEXPIRES")
+	for _, t := range f.Sorted() {
+		actions := strings.Join(t.Actions, ",")
+		if actions == "" {
+			actions = "*"
+		}
+		expires := t.ExpiresAt.Format(time.RFC3339)
+		if !now.Before(t.ExpiresAt) {
+			expires += " (expired)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Account, actions, limits(t.Limits), expires)
+	}
+	return w.Flush()
+}
+
+func limits(l token.Limits) string {
+	parts := []string{}
+	if l.PerMinute > 0 {
+		parts = append(parts, fmt.Sprintf("%d/min", l.PerMinute))
+	}
+	if l.PerHour > 0 {
+		parts = append(parts, fmt.Sprintf("%d/h", l.PerHour))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
+
+func runRevoke(args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	path := tokensFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: gogcli-sandbox-token revoke ID")
+	}
+	f, err := token.Load(*path)
+	if err != nil {
+		return err
+	}
+	revoked, err := f.Revoke(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := token.Save(*path, f); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "revoked token %s (%s)\n", revoked.ID, revoked.Account)
+	return nil
+}
@@ -0,0 +1,280 @@
+package actions
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gogcli-sandbox/internal/schema"
+)
+
+//go:embed default.json
+var defaultSpecs []byte
+
+// Spec describes how an action is executed and classified. Command,
+// Positional, Flags and MultiFlags map the runner params (after policy
+// rewrites) to gog arguments; Params lists the params agents may send.
+// Actions without a Command are handled by the broker itself.
+type Spec struct {
+	Service    string            `json:"service"`
+	ReadOnly   bool              `json:"read_only"`
+	Command    []string          `json:"command,omitempty"`
+	Positional []string          `json:"positional,omitempty"`
+	Flags      map[string]string `json:"flags,omitempty"`
+	MultiFlags map[string]string `json:"multi_flags,omitempty"`
+	Params     map[string]Param  `json:"params,omitempty"`
+	Redaction  string            `json:"redaction"`
+}
+
+// Param declares an agent-facing param. The bounds, pattern and enum are
+// published as JSON Schema keywords; for string_list params they apply to
+// each item.
+type Param struct {
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+	MinLength   *int     `json:"min_length,omitempty"`
+	MaxLength   *int     `json:"max_length,omitempty"`
+	MaxItems    *int     `json:"max_items,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+const (
+	TypeString     = "string"
+	TypeInteger    = "integer"
+	TypeBoolean    = "boolean"
+	TypeStringList = "string_list"
+	TypeAny        = "any"
+)
+
+const (
+	RedactGmail        = "gmail"
+	RedactGmailThreads = "gmail_threads"
+	RedactGmailLabels  = "gmail_labels"
+	RedactGmailSent    = "gmail_sent"
+	RedactCalendar     = "calendar"
+	RedactCalendarList = "calendar_list"
+	RedactNone         = "none"
+)
+
+var paramTypes = map[string]struct{}{
+	TypeString:     {},
+	TypeInteger:    {},
+	TypeBoolean:    {},
+	TypeStringList: {},
+	TypeAny:        {},
+}
+
+var redactionProfiles = map[string]struct{}{
+	RedactGmail:        {},
+	RedactGmailThreads: {},
+	RedactGmailLabels:  {},
+	RedactGmailSent:    {},
+	RedactCalendar:     {},
+	RedactCalendarList: {},
+	RedactNone:         {},
+}
+
+var (
+	mu       sync.RWMutex
+	specs    map[string]Spec
+	builtins map[string]Spec
+)
+
+func init() {
+	parsed, err := Parse(defaultSpecs)
+	if err != nil {
+		panic("actions: invalid default.json: " + err.Error())
+	}
+	builtins = parsed
+	specs = parsed
+}
+
+// Parse decodes a spec file, a JSON object keyed by action name, and
+// validates every entry.
+func Parse(data []byte) (map[string]Spec, error) {
+	var raw map[string]Spec
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for name, spec := range raw {
+		if err := spec.validate(name); err != nil {
+			return nil, fmt.Errorf("action %s: %w", name, err)
+		}
+	}
+	return raw, nil
+}
+
+// LoadFile adds the operator's specs to the built-in set. An entry with
+// the name of a built-in action replaces it.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	extra, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	merged := make(map[string]Spec, len(builtins)+len(extra))
+	for name, spec := range builtins {
+		merged[name] = spec
+	}
+	for name, spec := range extra {
+		merged[name] = spec
+	}
+	mu.Lock()
+	specs = merged
+	mu.Unlock()
+	return nil
+}
+
+func Lookup(name string) (Spec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	spec, ok := specs[name]
+	return spec, ok
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsBuiltin reports whether the action comes from the embedded defaults and
+// so has a dedicated policy rewriter.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+func (s Spec) validate(name string) error {
+	if !strings.Contains(name, ".") || strings.TrimSpace(name) != name {
+		return errors.New("name must look like service.action")
+	}
+	if s.Service == "" {
+		return errors.New("service is required")
+	}
+	if _, ok := redactionProfiles[s.Redaction]; !ok {
+		return fmt.Errorf("unknown redaction profile %q", s.Redaction)
+	}
+	for key, param := range s.Params {
+		if _, ok := paramTypes[param.Type]; !ok {
+			return fmt.Errorf("param %s: unknown type %q", key, param.Type)
+		}
+		if param.Pattern != "" {
+			if err := schema.CheckPattern(param.Pattern); err != nil {
+				return fmt.Errorf("param %s: invalid pattern: %w", key, err)
+			}
+		}
+		if param.Minimum != nil && param.Maximum != nil && *param.Minimum > *param.Maximum {
+			return fmt.Errorf("param %s: minimum is greater than maximum", key)
+		}
+	}
+	if IsBuiltin(name) || builtins == nil {
+		return nil
+	}
+	// Operator actions have no rewriter, so agent params go to the runner
+	// unchanged and each one needs a gog mapping.
+	if len(s.Command) == 0 {
+		return errors.New("command is required")
+	}
+	mapped := map[string]struct{}{}
+	for _, key := range s.Positional {
+		param, ok := s.Params[key]
+		if !ok {
+			return fmt.Errorf("positional %s is not a declared param", key)
+		}
+		if !param.Required {
+			return fmt.Errorf("positional %s must be required", key)
+		}
+		mapped[key] = struct{}{}
+	}
+	for _, flags := range []map[string]string{s.Flags, s.MultiFlags} {
+		for key, flag := range flags {
+			if _, ok := s.Params[key]; !ok {
+				return fmt.Errorf("flag %s is not a declared param", key)
+			}
+			if !strings.HasPrefix(flag, "-") {
+				return fmt.Errorf("flag %s: %q must start with -", key, flag)
+			}
+			mapped[key] = struct{}{}
+		}
+	}
+	for key := range s.Params {
+		if _, ok := mapped[key]; !ok {
+			return fmt.Errorf("param %s has no positional or flag mapping", key)
+		}
+	}
+	return nil
+}
+
+// Schema returns the JSON Schema for the action's params object.
+func (s Spec) Schema(name string) *schema.Schema {
+	closed := false
+	out := &schema.Schema{
+		Schema:               schema.Draft,
+		Title:                name,
+		Type:                 schema.Types{"object"},
+		Properties:           map[string]*schema.Schema{},
+		AdditionalProperties: &closed,
+	}
+	for key, param := range s.Params {
+		out.Properties[key] = param.schema()
+		if param.Required {
+			out.Required = append(out.Required, key)
+		}
+	}
+	sort.Strings(out.Required)
+	return out
+}
+
+func (p Param) schema() *schema.Schema {
+	value := &schema.Schema{
+		Minimum:   p.Minimum,
+		Maximum:   p.Maximum,
+		MinLength: p.MinLength,
+		MaxLength: p.MaxLength,
+		Pattern:   p.Pattern,
+	}
+	for _, v := range p.Enum {
+		value.Enum = append(value.Enum, v)
+	}
+	switch p.Type {
+	case TypeString, TypeInteger, TypeBoolean:
+		value.Type = schema.Types{p.Type}
+	case TypeStringList:
+		value.Type = schema.Types{"string"}
+		return &schema.Schema{
+			Description: p.Description,
+			Type:        schema.Types{"string", "array"},
+			Items:       value,
+			MaxItems:    p.MaxItems,
+		}
+	}
+	value.Description = p.Description
+	return value
+}
+
+// CheckParams validates agent params against the action's schema. Errors
+// are *schema.Error values naming the offending path.
+func (s Spec) CheckParams(name string, params map[string]interface{}) error {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return s.Schema(name).Validate("params", params)
+}
@@ -0,0 +1,121 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultSpecs(t *testing.T) {
+	for _, name := range []string{"gmail.search", "gmail.send", "calendar.events", "policy.actions"} {
+		if _, ok := Lookup(name); !ok {
+			t.Fatalf("missing built-in spec %s", name)
+		}
+	}
+	search, _ := Lookup("gmail.search")
+	if !search.ReadOnly || search.Redaction != RedactGmailThreads || strings.Join(search.Command, " ") != "gmail search" {
+		t.Fatalf("unexpected gmail.search spec: %+v", search)
+	}
+	if send, _ := Lookup("gmail.send"); send.ReadOnly {
+		t.Fatalf("gmail.send must not be read-only")
+	}
+}
+
+func TestLoadFileExtendsBuiltins(t *testing.T) {
+	t.Cleanup(func() { specs = builtins })
+	path := filepath.Join(t.TempDir(), "actions.json")
+	data := `{
+  "drive.files.list": {
+    "service": "drive",
+    "read_only": true,
+    "command": ["drive", "ls"],
+    "flags": {"max": "--max", "query": "--query"},
+    "params": {
+      "max": {"type": "integer"},
+      "query": {"type": "string", "required": true}
+    },
+    "redaction": "none"
+  }
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	spec, ok := Lookup("drive.files.list")
+	if !ok || !spec.ReadOnly || spec.Service != "drive" {
+		t.Fatalf("operator spec not loaded: %+v", spec)
+	}
+	if _, ok := Lookup("gmail.search"); !ok {
+		t.Fatalf("built-in specs were dropped")
+	}
+	if IsBuiltin("drive.files.list") {
+		t.Fatalf("operator action reported as built-in")
+	}
+
+	if err := spec.CheckParams("drive.files.list", map[string]interface{}{"query": "x", "max": float64(10)}); err != nil {
+		t.Fatalf("valid params rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		params map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{}, "params.query: is required"},
+		{map[string]interface{}{"query": "x", "max": 1.5}, "params.max: must be an integer"},
+		{map[string]interface{}{"query": "x", "owner": "me"}, "params.owner: is not a known param"},
+	} {
+		if err := spec.CheckParams("drive.files.list", tc.params); err == nil || err.Error() != tc.want {
+			t.Fatalf("params %v: expected %q, got %v", tc.params, tc.want, err)
+		}
+	}
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{`{"drive.ls": {"service": "drive", "command": ["drive", "ls"], "redaction": "bogus"}}`, "unknown redaction profile"},
+		{`{"drive.ls": {"service": "drive", "redaction": "none"}}`, "command is required"},
+		{`{"drive.ls": {"service": "drive", "command": ["drive", "ls"], "params": {"q": {"type": "string"}}, "redaction": "none"}}`, "param q has no positional or flag mapping"},
+		{`{"drive.ls": {"service": "drive", "command": ["drive", "ls"], "params": {"q": {"type": "text"}}, "redaction": "none"}}`, "unknown type"},
+		{`{"drive.get": {"service": "drive", "command": ["drive", "get"], "positional": ["id"], "params": {"id": {"type": "string"}}, "redaction": "none"}}`, "positional id must be required"},
+		{`{"ls": {"service": "drive", "command": ["drive", "ls"], "redaction": "none"}}`, "service.action"},
+	} {
+		if _, err := Parse([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %q, got %v", tc.data, tc.want, err)
+		}
+	}
+}
+
+func TestBuiltinSchemas(t *testing.T) {
+	for _, tc := range []struct {
+		action string
+		params map[string]interface{}
+		want   string
+	}{
+		{"gmail.search", map[string]interface{}{"query": "in:inbox", "max": float64(50)}, ""},
+		{"gmail.search", map[string]interface{}{"query": "in:inbox", "max": float64(501)}, "params.max: must be <= 500"},
+		{"gmail.search", map[string]interface{}{"query": "in:inbox", "max": 2.5}, "params.max: must be an integer"},
+		{"gmail.get", map[string]interface{}{"id": "abc", "format": "full"}, ""},
+		{"gmail.get", map[string]interface{}{"id": "abc", "format": "html"}, "params.format: must be one of metadata, minimal, full, raw"},
+		{"gmail.thread.get", map[string]interface{}{"thread_id": "../x"}, "params.thread_id: does not match pattern ^[A-Za-z0-9_-]+$"},
+		{"calendar.freebusy", map[string]interface{}{"calendar_ids": []interface{}{"primary", float64(3)}}, "params.calendar_ids[1]: must be a string"},
+		{"calendar.events", map[string]interface{}{"calendar_id": "primary", "week_start": "Monday"}, ""},
+		{"calendar.events", map[string]interface{}{}, "params.calendar_id: is required"},
+	} {
+		spec, _ := Lookup(tc.action)
+		err := spec.CheckParams(tc.action, tc.params)
+		if tc.want == "" {
+			if err != nil {
+				t.Fatalf("%s %v: unexpected error %v", tc.action, tc.params, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("%s %v: expected %q, got %v", tc.action, tc.params, tc.want, err)
+		}
+	}
+}
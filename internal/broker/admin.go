@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"sort"
+	"time"
+
+	"gogcli-sandbox/internal/policy"
+)
+
+const maxRecentDenials = 100
+
+// PolicyInfo describes where the active policy set came from.
+type PolicyInfo struct {
+	Source   string    `json:"source"`
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Denial is one recently denied request, kept for the admin socket.
+type Denial struct {
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	ID        string    `json:"id,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+}
+
+// Switch is an operator kill switch on an account or action.
+type Switch struct {
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until,omitempty"`
+}
+
+type adminState struct {
+	policyInfo PolicyInfo
+	denials    []Denial
+	next       int
+	switches   map[string]Switch
+}
+
+func (b *Broker) policySet() *policy.PolicySet {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	return b.Policies
+}
+
+// PolicySet returns the active policy set.
+func (b *Broker) PolicySet() *policy.PolicySet {
+	return b.policySet()
+}
+
+// SetPolicies swaps in a new policy set. Requests already past policy
+// resolution finish under the old one. The new policies get the cached label
+// maps, which stay fresh across the swap. labelMu is held across the swap so
+// a label refresh finishing meanwhile updates either the maps copied here or
+// the new policies.
+func (b *Broker) SetPolicies(set *policy.PolicySet, info PolicyInfo) {
+	b.labelMu.Lock()
+	defer b.labelMu.Unlock()
+	if set != nil {
+		for account, pol := range set.Accounts {
+			if entry, ok := b.labels[account]; ok && entry.labels != nil {
+				pol.SetLabelMap(entry.labels)
+			}
+		}
+	}
+	b.adminMu.Lock()
+	defer b.adminMu.Unlock()
+	b.Policies = set
+	b.admin.policyInfo = info
+}
+
+func (b *Broker) PolicyInfo() PolicyInfo {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	return b.admin.policyInfo
+}
+
+func (b *Broker) recordDenial(reason string, fields map[string]any) {
+	str := func(key string) string {
+		s, _ := fields[key].(string)
+		return s
+	}
+	d := Denial{Time: time.Now().UTC(), Reason: reason, ID: str("id"), Action: str("action"), Account: str("account"), Principal: str("principal")}
+	b.adminMu.Lock()
+	defer b.adminMu.Unlock()
+	if len(b.admin.denials) < maxRecentDenials {
+		b.admin.denials = append(b.admin.denials, d)
+		return
+	}
+	b.admin.denials[b.admin.next] = d
+	b.admin.next = (b.admin.next + 1) % maxRecentDenials
+}
+
+// RecentDenials returns up to the last 100 denied requests, newest first.
+func (b *Broker) RecentDenials() []Denial {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	out := make([]Denial, 0, len(b.admin.denials))
+	for i := len(b.admin.denials) - 1; i >= 0; i-- {
+		out = append(out, b.admin.denials[(b.admin.next+i)%len(b.admin.denials)])
+	}
+	return out
+}
+
+// Disable turns on a kill switch for an account (Kind "account") or action
+// (Kind "action") until s.Until, or until Enable when Until is zero.
+func (b *Broker) Disable(s Switch) {
+	b.adminMu.Lock()
+	defer b.adminMu.Unlock()
+	if b.admin.switches == nil {
+		b.admin.switches = map[string]Switch{}
+	}
+	b.admin.switches[s.Kind+":"+s.Name] = s
+}
+
+// Enable clears a kill switch and reports whether one was set.
+func (b *Broker) Enable(kind, name string) bool {
+	b.adminMu.Lock()
+	defer b.adminMu.Unlock()
+	key := kind + ":" + name
+	_, ok := b.admin.switches[key]
+	delete(b.admin.switches, key)
+	return ok
+}
+
+// Switches lists the kill switches in effect.
+func (b *Broker) Switches() []Switch {
+	now := time.Now()
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	out := []Switch{}
+	for _, s := range b.admin.switches {
+		if s.Until.IsZero() || now.Before(s.Until) {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (b *Broker) switchedOff(kind, name string) (Switch, bool) {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	s, ok := b.admin.switches[kind+":"+name]
+	if !ok || (!s.Until.IsZero() && !time.Now().Before(s.Until)) {
+		return Switch{}, false
+	}
+	return s, true
+}
+
+// FlushLabels drops the cached label maps of one account, or of every
+// account when account is empty.
+func (b *Broker) FlushLabels(account string) {
+	b.labelMu.Lock()
+	defer b.labelMu.Unlock()
+	if account == "" {
+		b.labels = nil
+		return
+	}
+	delete(b.labels, account)
+}
+
+// LabelCacheContents returns the cached label id to name maps per account.
+func (b *Broker) LabelCacheContents() map[string]map[string]string {
+	b.labelMu.Lock()
+	defer b.labelMu.Unlock()
+	out := map[string]map[string]string{}
+	for account, entry := range b.labels {
+		labels := make(map[string]string, len(entry.labels))
+		for id, name := range entry.labels {
+			labels[id] = name
+		}
+		out[account] = labels
+	}
+	return out
+}
+
+func switchMessage(kind string, s Switch) string {
+	msg := kind + " disabled by operator"
+	if s.Reason != "" {
+		msg += ": " + s.Reason
+	}
+	return msg
+}
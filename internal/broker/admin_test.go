@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/types"
+)
+
+func TestKillSwitchDisablesAccountAndAction(t *testing.T) {
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+	req := func(id string) *types.Response {
+		return b.Handle(context.Background(), &types.Request{ID: id, Action: "calendar.list", Account: "a@example.com"})
+	}
+
+	b.Disable(Switch{Kind: "account", Name: "a@example.com", Reason: "incident"})
+	if resp := req("1"); resp.Ok || resp.Error.Code != "disabled" || resp.Error.Message != "account disabled by operator: incident" {
+		t.Fatalf("expected disabled account, got %+v", resp)
+	}
+	if !b.Enable("account", "a@example.com") {
+		t.Fatalf("expected switch to be cleared")
+	}
+	b.Disable(Switch{Kind: "action", Name: "calendar.list", Until: time.Now().Add(-time.Second)})
+	if resp := req("2"); !resp.Ok {
+		t.Fatalf("expected expired switch to be ignored, got %+v", resp)
+	}
+	b.Disable(Switch{Kind: "action", Name: "calendar.list", Until: time.Now().Add(time.Minute)})
+	if resp := req("3"); resp.Ok || resp.Error.Code != "disabled" {
+		t.Fatalf("expected disabled action, got %+v", resp)
+	}
+	if switches := b.Switches(); len(switches) != 1 || switches[0].Kind != "action" {
+		t.Fatalf("unexpected switches: %+v", switches)
+	}
+	if runner.calls != 1 {
+		t.Fatalf("expected one runner call, got %d", runner.calls)
+	}
+
+	denials := b.RecentDenials()
+	if len(denials) != 2 || denials[0].ID != "3" || denials[0].Reason != "action_switched_off" || denials[1].Account != "a@example.com" {
+		t.Fatalf("unexpected denials: %+v", denials)
+	}
+}
+
+func TestRecentDenialsKeepsNewest(t *testing.T) {
+	b := &Broker{}
+	for i := 0; i < maxRecentDenials+5; i++ {
+		b.recordDenial("action_denied", map[string]any{"id": fmt.Sprint(i)})
+	}
+	denials := b.RecentDenials()
+	if len(denials) != maxRecentDenials || denials[0].ID != fmt.Sprint(maxRecentDenials+4) || denials[len(denials)-1].ID != "5" {
+		t.Fatalf("unexpected ring order: first %+v last %+v", denials[0], denials[len(denials)-1])
+	}
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gogcli-sandbox/internal/types"
+)
+
+const (
+	DefaultBatchMaxItems    = 20
+	DefaultBatchParallelism = 4
+	DefaultBatchTimeout     = 25 * time.Second
+)
+
+var ErrBatchTooLarge = errors.New("batch is too large")
+
+// HandleBatch runs each request through Handle independently, at most
+// BatchParallelism at a time, and returns the responses in request order.
+// Items that have not started when the BatchTimeout budget runs out fail
+// with a timeout; a failed or denied item never affects the others.
+func (b *Broker) HandleBatch(ctx context.Context, reqs []*types.Request) ([]*types.Response, error) {
+	maxItems := b.BatchMaxItems
+	if maxItems <= 0 {
+		maxItems = DefaultBatchMaxItems
+	}
+	if len(reqs) == 0 {
+		return nil, errors.New("batch must not be empty")
+	}
+	if len(reqs) > maxItems {
+		return nil, fmt.Errorf("%w: %d items (max %d)", ErrBatchTooLarge, len(reqs), maxItems)
+	}
+	parallelism := b.BatchParallelism
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+	timeout := b.BatchTimeout
+	if timeout <= 0 {
+		timeout = DefaultBatchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx, span := b.Tracer.Start(ctx, "broker.HandleBatch")
+	defer span.Finish()
+
+	start := time.Now()
+	responses := make([]*types.Response, len(reqs))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			responses[i] = budgetExceeded(req)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, req *types.Request) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			responses[i] = b.Handle(ctx, req)
+		}(i, req)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, resp := range responses {
+		if !resp.Ok {
+			failed++
+		}
+	}
+	if b.Logger != nil {
+		b.Logger.Info("batch_done", map[string]any{"items": len(reqs), "failed": failed, "duration_ms": time.Since(start).Milliseconds()})
+	}
+	return responses, nil
+}
+
+func budgetExceeded(req *types.Request) *types.Response {
+	resp := &types.Response{Ok: false, Error: types.NewError("timeout", "batch time budget exceeded", "")}
+	if req != nil {
+		resp.ID = req.ID
+	}
+	return resp
+}
@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+func batchTestBroker(t *testing.T, runner *fakeRunner) *Broker {
+	t.Helper()
+	pol := &policy.Policy{AllowedActions: []string{"calendar.list"}, Calendar: &policy.CalendarPolicy{}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return &Broker{
+		Policies:       &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}},
+		RunnerProvider: runner,
+	}
+}
+
+func TestHandleBatchKeepsOrderAndIsolatesDenials(t *testing.T) {
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+	reqs := []*types.Request{
+		{ID: "1", Action: "calendar.list", Account: "a@example.com"},
+		{ID: "2", Action: "gmail.send", Account: "a@example.com"},
+		nil,
+		{ID: "4", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(0)}},
+		{ID: "5", Action: "calendar.list", Account: "a@example.com"},
+	}
+	responses, err := b.HandleBatch(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(responses) != len(reqs) {
+		t.Fatalf("expected %d responses, got %d", len(reqs), len(responses))
+	}
+	want := []string{"", "forbidden", "bad_request", "bad_request", ""}
+	for i, resp := range responses {
+		if want[i] == "" {
+			if !resp.Ok || resp.ID != reqs[i].ID {
+				t.Fatalf("item %d: expected ok, got %+v", i, resp)
+			}
+			continue
+		}
+		if resp.Ok || resp.Error.Code != want[i] {
+			t.Fatalf("item %d: expected %s, got %+v", i, want[i], resp)
+		}
+	}
+}
+
+func TestHandleBatchLimits(t *testing.T) {
+	runner := &fakeRunner{delay: 50 * time.Millisecond, run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+	b.BatchMaxItems = 3
+	b.BatchParallelism = 1
+	b.BatchTimeout = 20 * time.Millisecond
+
+	reqs := []*types.Request{}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		reqs = append(reqs, &types.Request{ID: id, Action: "calendar.list", Account: "a@example.com"})
+	}
+	if _, err := b.HandleBatch(context.Background(), reqs); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("expected ErrBatchTooLarge, got %v", err)
+	}
+
+	responses, err := b.HandleBatch(context.Background(), reqs[:3])
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	last := responses[2]
+	if last.Ok || last.Error.Code != "timeout" || last.ID != "3" {
+		t.Fatalf("expected the last item to exceed the budget, got %+v", last)
+	}
+}
@@ -7,24 +7,62 @@ import (
 	"sync"
 	"time"
 
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/cursor"
 	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/metrics"
+	"gogcli-sandbox/internal/outbox"
 	"gogcli-sandbox/internal/policy"
 	"gogcli-sandbox/internal/redact"
+	"gogcli-sandbox/internal/trace"
 	"gogcli-sandbox/internal/types"
 )
 
 type Broker struct {
-	Policies       *policy.PolicySet
-	RunnerProvider gog.RunnerProvider
-	DefaultAccount string
-	Logger         Logger
-	Verbose        bool
-	labelMu        sync.Mutex
-	labelOnce      map[string]*sync.Once
-	labelErr       map[string]error
+	Policies         *policy.PolicySet
+	RunnerProvider   gog.RunnerProvider
+	DefaultAccount   string
+	Logger           Logger
+	Verbose          bool
+	Outbox           *outbox.Store
+	LabelTTL         time.Duration
+	Limiter          *gog.Limiter
+	Breaker          *gog.BreakerProvider
+	Gog              *gog.Capabilities
+	BatchMaxItems    int
+	BatchParallelism int
+	BatchTimeout     time.Duration
+	IterateTimeout   time.Duration
+	Cursors          *cursor.Sealer
+	Metrics          *metrics.Registry
+	Tracer           *trace.Tracer
+	LockdownFile     string
+	metrics          *brokerMetrics
+	labelMu          sync.Mutex
+	labels           map[string]*labelEntry
+	cursorMu         sync.Mutex
+	adminMu          sync.RWMutex
+	admin            adminState
+	lockdown         lockdownState
 }
 
 func (b *Broker) Handle(ctx context.Context, req *types.Request) *types.Response {
+	ctx, span := b.Tracer.Start(ctx, "broker.Handle")
+	resp := b.handle(ctx, req)
+	b.observeRequest(req, resp)
+	if req != nil {
+		span.SetAttr("request.id", req.ID)
+		span.SetAttr("action", req.Action)
+	}
+	if !resp.Ok && resp.Error != nil {
+		span.SetAttr("error.code", resp.Error.Code)
+		span.SetError(errors.New(resp.Error.Message))
+	}
+	span.Finish()
+	return resp
+}
+
+func (b *Broker) handle(ctx context.Context, req *types.Request) *types.Response {
 	start := time.Now()
 	fields := map[string]any{}
 	if req != nil {
@@ -59,7 +97,21 @@ func (b *Broker) Handle(ctx context.Context, req *types.Request) *types.Response
 		fields["action"] = req.Action
 	}
 
-	pol, account, err := b.resolvePolicy(req.Account)
+	// The send checks below may each ask whether the recipients are on the
+	// thread; look the thread up once.
+	ctx = policy.WithReplyLookups(ctx)
+	principal := PrincipalFrom(ctx)
+	if principal != nil {
+		fields["principal"] = principal.Name
+	}
+	requested := req.Account
+	if requested == "" {
+		requested = principal.defaultAccount()
+	}
+	_, span := trace.Start(ctx, "broker.resolvePolicy")
+	pol, account, err := b.resolvePolicy(requested)
+	span.SetError(err)
+	span.Finish()
 	if err != nil {
 		code := "forbidden"
 		if errors.Is(err, policy.ErrAccountRequired) {
@@ -69,28 +121,70 @@ func (b *Broker) Handle(ctx context.Context, req *types.Request) *types.Response
 		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError(code, err.Error(), "")}
 	}
 	fields["account"] = account
+	if !principal.AllowsAccount(account) {
+		b.logDenied("account_denied", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("forbidden", policy.ErrAccountNotAllowed.Error(), "")}
+	}
 
-	if !pol.IsActionAllowed(req.Action) {
+	if !pol.IsActionAllowed(req.Action) || !principal.AllowsAction(req.Action) {
 		b.logDenied("action_denied", fields, start)
 		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("forbidden", "action not allowed", "")}
 	}
-	if req.Action == "gmail.search" || req.Action == "gmail.thread.list" || req.Action == "gmail.labels.get" || req.Action == "gmail.labels.modify" || req.Action == "gmail.thread.modify" || req.Action == "gmail.labels.list" {
+	if s, off := b.switchedOff("account", account); off {
+		b.logDenied("account_switched_off", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("disabled", switchMessage("account", s), "")}
+	}
+	if s, off := b.switchedOff("action", req.Action); off {
+		b.logDenied("action_switched_off", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("disabled", switchMessage("action", s), "")}
+	}
+	if isWrite(req.Action) && b.lockedDown(account) {
+		b.logDenied("lockdown_denied", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("lockdown", "write actions are locked down", "")}
+	}
+	if !principal.allow() {
+		b.logDenied("principal_rate_limited", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("rate_limited", "request rate limit reached", "")}
+	}
+	if reason, disabled := b.Gog.DisabledReason(req.Action); disabled {
+		b.logDenied("action_disabled", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("action_disabled", "action disabled: "+reason, "")}
+	}
+	if spec, ok := actions.Lookup(req.Action); ok {
+		if err := spec.CheckParams(req.Action, req.Params); err != nil {
+			b.logDenied("invalid_params", fields, start)
+			return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("bad_request", err.Error(), "")}
+		}
+	}
+	if usesLabelMap(req.Action) {
 		if pol != nil && pol.Gmail != nil && hasAnyLabelConstraints(pol.Gmail) {
-			if err := b.ensureLabelMap(ctx, account, pol); err != nil {
+			ctx, span := trace.Start(ctx, "broker.ensureLabelMap")
+			err := b.ensureLabelMap(ctx, account, pol)
+			span.SetError(err)
+			span.Finish()
+			if err != nil {
 				b.logError("label_map_error", fields, start)
-				return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("upstream_error", "failed to resolve label ids", "")}
+				return &types.Response{ID: req.ID, Ok: false, Error: upstreamError(err, "failed to resolve label ids")}
 			}
 		}
 	}
 
-	params, warnings, err := pol.ValidateAndRewrite(ctx, req.Action, req.Params)
+	var original map[string]interface{}
+	if req.Action == "gmail.send" {
+		original = cloneParams(req.Params)
+	}
+
+	rewriteCtx, span := trace.Start(ctx, "policy.ValidateAndRewrite")
+	params, warnings, err := pol.ValidateAndRewrite(rewriteCtx, req.Action, req.Params)
+	span.SetError(err)
+	span.Finish()
 	if err != nil {
 		b.logDenied("policy_denied", fields, start)
 		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("forbidden", err.Error(), "")}
 	}
 
 	runAction := req.Action
-	if req.Action == "gmail.send" && pol != nil && pol.DraftSendRequired(params) {
+	if req.Action == "gmail.send" && pol != nil && pol.DraftSendRequired(ctx, params) {
 		runAction = "gmail.drafts.create"
 		warnings = append(warnings, "action_rewritten:gmail.drafts.create")
 		if b.Verbose && b.Logger != nil {
@@ -98,12 +192,33 @@ func (b *Broker) Handle(ctx context.Context, req *types.Request) *types.Response
 		}
 	}
 
+	if req.Action == "gmail.send.cancel" {
+		return b.cancelSend(req, account, params, warnings, fields, start)
+	}
+	if runAction == "gmail.send" {
+		if delay := pol.SendDelay(); delay > 0 {
+			return b.queueSend(req, account, original, delay, warnings, fields, start)
+		}
+	}
+
 	if req.Action == "policy.actions" {
-		actions := append([]string{}, pol.AllowedActions...)
-		sort.Strings(actions)
+		allowed := []string{}
+		for _, action := range pol.AllowedActions {
+			if principal.AllowsAction(action) {
+				allowed = append(allowed, action)
+			}
+		}
+		sort.Strings(allowed)
+		params := map[string]any{}
+		for _, action := range allowed {
+			if spec, ok := actions.Lookup(action); ok && len(spec.Params) > 0 {
+				params[action] = spec.Params
+			}
+		}
 		resp := &types.Response{ID: req.ID, Ok: true, Data: map[string]any{
 			"account": account,
-			"actions": actions,
+			"actions": allowed,
+			"params":  params,
 		}}
 		if len(warnings) > 0 {
 			resp.Warnings = warnings
@@ -112,19 +227,54 @@ func (b *Broker) Handle(ctx context.Context, req *types.Request) *types.Response
 		return resp
 	}
 
+	if req.Action == "policy.schema" {
+		return b.policySchema(req, account, pol, principal, params, warnings, fields, start)
+	}
+	if req.Action == "policy.explain" {
+		return b.policyExplain(ctx, req, account, pol, principal, params, fields, start)
+	}
+
 	runner := b.RunnerProvider.RunnerFor(account)
-	data, err := runner.Run(ctx, runAction, params)
+	runCtx, span := trace.Start(ctx, "runner.Run")
+	span.SetAttr("action", runAction)
+	data, err := runner.Run(runCtx, runAction, params)
+	span.SetError(err)
+	span.Finish()
 	if err != nil {
-		b.logError("gog_error", fields, start)
-		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("upstream_error", err.Error(), "")}
+		if errors.Is(err, gog.ErrBusy) {
+			b.logError("busy", fields, start)
+		} else if errors.Is(err, gog.ErrUnavailable) {
+			b.logError("upstream_unavailable", fields, start)
+		} else {
+			if kind, ok := gog.ErrorKindOf(err); ok {
+				fields["error_kind"] = string(kind)
+			}
+			b.logError("gog_error", fields, start)
+		}
+		return &types.Response{ID: req.ID, Ok: false, Error: upstreamError(err, err.Error())}
 	}
 
+	redactStart := time.Now()
+	_, span = trace.Start(ctx, "redact.Redact")
 	clean, redactionWarnings, err := redact.Redact(req.Action, data, pol)
+	span.SetError(err)
+	span.Finish()
+	b.observeRedaction(req.Action, redactStart)
 	if err != nil {
 		b.logError("redact_error", fields, start)
 		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("redaction_error", err.Error(), "")}
 	}
 	warnings = append(warnings, redactionWarnings...)
+	if root, ok := clean.(map[string]interface{}); ok {
+		if token, ok := root["nextPageToken"].(string); ok {
+			wrapped, err := pol.WrapPageToken(runAction, params, token)
+			if err != nil {
+				b.logError("cursor_error", fields, start)
+				return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("cursor_error", err.Error(), "")}
+			}
+			root["nextPageToken"] = wrapped
+		}
+	}
 
 	resp := &types.Response{ID: req.ID, Ok: true, Data: clean}
 	if len(warnings) > 0 {
@@ -148,6 +298,7 @@ func (b *Broker) logDenied(msg string, fields map[string]any, start time.Time) {
 	fields = cloneFields(fields)
 	fields["decision"] = "deny"
 	fields["duration_ms"] = time.Since(start).Milliseconds()
+	b.recordDenial(msg, fields)
 	if b.Logger != nil {
 		b.Logger.Info(msg, fields)
 	}
@@ -182,111 +333,34 @@ func paramKeys(params map[string]interface{}) []string {
 	return keys
 }
 
-func (b *Broker) ensureLabelMap(ctx context.Context, account string, pol *policy.Policy) error {
-	if b == nil || pol == nil || b.RunnerProvider == nil {
-		return nil
+func (b *Broker) resolvePolicy(account string) (*policy.Policy, string, error) {
+	if b == nil {
+		return nil, "", errors.New("policy is required")
 	}
-	once, err := b.labelOnceFor(account)
-	if err != nil {
-		return err
+	set := b.policySet()
+	if set == nil {
+		return nil, "", errors.New("policy is required")
 	}
-
-	once.Do(func() {
-		runner := b.RunnerProvider.RunnerFor(account)
-		data, runErr := runner.Run(ctx, "gmail.labels.list", nil)
-		if runErr != nil {
-			b.setLabelErr(account, runErr)
-			return
-		}
-		idToName := map[string]string{}
-		root, ok := data.(map[string]interface{})
-		if !ok {
-			b.setLabelErr(account, errors.New("invalid labels response"))
-			return
-		}
-		rawLabels, ok := root["labels"]
-		if !ok {
-			b.setLabelErr(account, errors.New("labels missing"))
-			return
-		}
-		items, ok := rawLabels.([]interface{})
-		if !ok {
-			b.setLabelErr(account, errors.New("labels invalid"))
-			return
-		}
-		for _, item := range items {
-			m, ok := item.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			id, _ := m["id"].(string)
-			name, _ := m["name"].(string)
-			if id != "" && name != "" {
-				idToName[id] = name
-			}
-		}
-		if len(idToName) == 0 {
-			b.setLabelErr(account, errors.New("labels empty"))
-			return
-		}
-		pol.SetLabelMap(idToName)
-		b.setLabelErr(account, nil)
-	})
-	return b.getLabelErr(account)
+	return set.Resolve(account, b.DefaultAccount)
 }
 
-func (b *Broker) labelOnceFor(account string) (*sync.Once, error) {
-	b.labelMu.Lock()
-	defer b.labelMu.Unlock()
-	if b.labelOnce == nil {
-		b.labelOnce = map[string]*sync.Once{}
-	}
-	if b.labelErr == nil {
-		b.labelErr = map[string]error{}
+// upstreamError maps classified gog failures to their own codes. Anything
+// else keeps the generic upstream_error code with the given message.
+func upstreamError(err error, message string) *types.Error {
+	if errors.Is(err, gog.ErrBusy) {
+		return types.NewError("busy", "too many gog requests in flight, retry later", "")
 	}
-	key := account
-	if key == "" {
-		key = "_default"
+	if errors.Is(err, gog.ErrUnavailable) {
+		return types.NewError("upstream_unavailable", err.Error(), "")
 	}
-	once, ok := b.labelOnce[key]
+	kind, ok := gog.ErrorKindOf(err)
 	if !ok {
-		once = &sync.Once{}
-		b.labelOnce[key] = once
-	}
-	return once, nil
-}
-
-func (b *Broker) setLabelErr(account string, err error) {
-	b.labelMu.Lock()
-	defer b.labelMu.Unlock()
-	if b.labelErr == nil {
-		b.labelErr = map[string]error{}
-	}
-	key := account
-	if key == "" {
-		key = "_default"
+		return types.NewError("upstream_error", message, "")
 	}
-	b.labelErr[key] = err
-}
-
-func (b *Broker) getLabelErr(account string) error {
-	b.labelMu.Lock()
-	defer b.labelMu.Unlock()
-	if b.labelErr == nil {
-		return nil
-	}
-	key := account
-	if key == "" {
-		key = "_default"
-	}
-	return b.labelErr[key]
-}
-
-func (b *Broker) resolvePolicy(account string) (*policy.Policy, string, error) {
-	if b == nil || b.Policies == nil {
-		return nil, "", errors.New("policy is required")
+	if kind == gog.KindFailed {
+		return types.NewError("upstream_error", err.Error(), "")
 	}
-	return b.Policies.Resolve(account, b.DefaultAccount)
+	return types.NewError(string(kind), err.Error(), "")
 }
 
 func hasAnyLabelConstraints(gmail *policy.GmailPolicy) bool {
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gogcli-sandbox/internal/trace"
+	"gogcli-sandbox/internal/types"
+)
+
+func TestHandleTracesStages(t *testing.T) {
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+	path := filepath.Join(t.TempDir(), "spans.json")
+	b.Tracer = trace.NewTracer(&trace.FileExporter{Path: path}, nil)
+
+	ctx := trace.WithRemoteParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if resp := b.Handle(ctx, &types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com"}); !resp.Ok {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if err := b.Tracer.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	for _, name := range []string{"broker.Handle", "broker.resolvePolicy", "policy.ValidateAndRewrite", "runner.Run", "redact.Redact"} {
+		if !strings.Contains(string(data), `"name":"`+name+`"`) {
+			t.Fatalf("missing span %s in %s", name, data)
+		}
+	}
+	if strings.Count(string(data), "4bf92f3577b34da6a3ce929d0e0e4736") != 5 {
+		t.Fatalf("expected every span in the caller's trace: %s", data)
+	}
+}
+
+func TestHandleEnforcesPrincipalScope(t *testing.T) {
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+
+	other := WithPrincipal(context.Background(), &Principal{Name: "agent", Accounts: []string{"b@example.com"}})
+	if resp := b.Handle(other, &types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com"}); resp.Ok || resp.Error.Code != "forbidden" {
+		t.Fatalf("expected account outside the principal to be forbidden: %+v", resp)
+	}
+	narrow := WithPrincipal(context.Background(), &Principal{Name: "agent", Accounts: []string{"a@example.com"}, Actions: []string{"gmail.search"}})
+	if resp := b.Handle(narrow, &types.Request{ID: "2", Action: "calendar.list"}); resp.Ok || resp.Error.Code != "forbidden" {
+		t.Fatalf("expected action outside the principal to be forbidden: %+v", resp)
+	}
+	scoped := WithPrincipal(context.Background(), &Principal{Name: "agent", Accounts: []string{"a@example.com"}})
+	if resp := b.Handle(scoped, &types.Request{ID: "3", Action: "calendar.list"}); !resp.Ok {
+		t.Fatalf("expected single-account principal to default its account: %+v", resp)
+	}
+	if runner.calls != 1 {
+		t.Fatalf("expected one runner call, got %d", runner.calls)
+	}
+}
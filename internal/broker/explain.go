@@ -0,0 +1,145 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/redact"
+	"gogcli-sandbox/internal/types"
+)
+
+// Explanation is the policy.explain result: what the broker would do with a
+// request for Action, without running it.
+type Explanation struct {
+	Account     string                 `json:"account"`
+	Action      string                 `json:"action"`
+	Decision    string                 `json:"decision"`
+	Code        string                 `json:"code,omitempty"`
+	Reason      string                 `json:"reason,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Rules       []string               `json:"rules"`
+	FinalAction string                 `json:"final_action,omitempty"`
+	SendDelay   string                 `json:"send_delay,omitempty"`
+	Redaction   *RedactionPlan         `json:"redaction,omitempty"`
+}
+
+// RedactionPlan names the redaction profile of the final action and the
+// rules that would apply to its response.
+type RedactionPlan struct {
+	Profile string   `json:"profile"`
+	Rules   []string `json:"rules"`
+}
+
+// policyExplain evaluates the request in params.action and params.params the
+// way handle would, stopping before gog runs the action. Lookups the rewrite
+// needs, such as the label map, go through the usual caches. Reply threads
+// are not fetched: a send under reply_recipients_only is reported with the
+// rule depends_on:thread_recipients instead.
+func (b *Broker) policyExplain(ctx context.Context, req *types.Request, account string, pol *policy.Policy, principal *Principal, params map[string]interface{}, fields map[string]any, start time.Time) *types.Response {
+	target, _ := params["action"].(string)
+	inner := map[string]interface{}{}
+	if raw, ok := params["params"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			b.logDenied("invalid_params", fields, start)
+			return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("bad_request", "params.params must be an object", "")}
+		}
+		inner = cloneParams(obj)
+	}
+	if target == "" || target == req.Action {
+		b.logDenied("invalid_params", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("bad_request", "params.action must name another action", "")}
+	}
+
+	explained := b.explain(ctx, account, pol, principal, target, inner)
+	b.logAllowed("request_ok", fields, start)
+	return &types.Response{ID: req.ID, Ok: true, Data: explained}
+}
+
+// Explain reports what the broker would do with a request for action on
+// account. Unlike policy.explain it needs no permission in the policy, so
+// offline tools can check a policy file with it.
+func (b *Broker) Explain(ctx context.Context, account, action string, params map[string]interface{}) *Explanation {
+	pol, resolved, err := b.resolvePolicy(account)
+	if err != nil {
+		code := "forbidden"
+		if errors.Is(err, policy.ErrAccountRequired) {
+			code = "bad_request"
+		}
+		return &Explanation{Account: account, Action: action, Decision: "deny", Code: code, Reason: err.Error(), Rules: []string{}}
+	}
+	return b.explain(ctx, resolved, pol, PrincipalFrom(ctx), action, cloneParams(params))
+}
+
+func (b *Broker) explain(ctx context.Context, account string, pol *policy.Policy, principal *Principal, action string, params map[string]interface{}) *Explanation {
+	out := &Explanation{Account: account, Action: action, Decision: "deny", Rules: []string{}}
+	deny := func(code, reason string) *Explanation {
+		out.Code, out.Reason = code, reason
+		return out
+	}
+
+	if !pol.IsActionAllowed(action) || !principal.AllowsAction(action) {
+		return deny("forbidden", "action not allowed")
+	}
+	if s, off := b.switchedOff("account", account); off {
+		return deny("disabled", switchMessage("account", s))
+	}
+	if s, off := b.switchedOff("action", action); off {
+		return deny("disabled", switchMessage("action", s))
+	}
+	if isWrite(action) && b.lockedDown(account) {
+		return deny("lockdown", "write actions are locked down")
+	}
+	if reason, disabled := b.Gog.DisabledReason(action); disabled {
+		return deny("action_disabled", "action disabled: "+reason)
+	}
+	if spec, ok := actions.Lookup(action); ok {
+		if err := spec.CheckParams(action, params); err != nil {
+			return deny("bad_request", err.Error())
+		}
+	}
+	if pol.Gmail != nil && hasAnyLabelConstraints(pol.Gmail) && usesLabelMap(action) {
+		if err := b.ensureLabelMap(ctx, account, pol); err != nil {
+			e := upstreamError(err, "failed to resolve label ids: "+err.Error())
+			return deny(e.Code, e.Message)
+		}
+	}
+
+	ctx = policy.WithoutReplyLookups(ctx)
+	rewritten, warnings, err := pol.ValidateAndRewrite(ctx, action, params)
+	if err != nil {
+		return deny("forbidden", err.Error())
+	}
+	final := action
+	if action == "gmail.send" && pol.DraftSendRequired(ctx, rewritten) {
+		final = "gmail.drafts.create"
+		warnings = append(warnings, "action_rewritten:gmail.drafts.create")
+	}
+	if final == "gmail.send" && policy.ReplyLookupSkipped(ctx) {
+		warnings = append(warnings, "depends_on:thread_recipients")
+	}
+	if final == "gmail.send" {
+		if delay := pol.SendDelay(); delay > 0 {
+			out.SendDelay = delay.String()
+		}
+	}
+	profile, rules := redact.Rules(final, pol)
+
+	out.Decision = "allow"
+	out.Params = rewritten
+	out.Rules = append(out.Rules, warnings...)
+	out.FinalAction = final
+	out.Redaction = &RedactionPlan{Profile: profile, Rules: rules}
+	return out
+}
+
+func usesLabelMap(action string) bool {
+	switch action {
+	case "gmail.search", "gmail.thread.list", "gmail.labels.get", "gmail.labels.modify", "gmail.thread.modify", "gmail.labels.list":
+		return true
+	}
+	return false
+}
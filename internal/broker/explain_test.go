@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+func TestPolicyExplainRewritesWithoutRunning(t *testing.T) {
+	pol := &policy.Policy{
+		AllowedActions: []string{"policy.explain", "gmail.search", "gmail.send"},
+		Gmail:          &policy.GmailPolicy{MaxDays: 7, DraftOnly: true, SubjectPrefix: "[agent] "},
+	}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{}, nil
+	}}
+	b := &Broker{Policies: &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}}, RunnerProvider: runner}
+	explain := func(action string, params map[string]interface{}) *Explanation {
+		t.Helper()
+		resp := b.Handle(context.Background(), &types.Request{ID: "1", Action: "policy.explain", Account: "a@example.com", Params: map[string]interface{}{"action": action, "params": params}})
+		if !resp.Ok {
+			t.Fatalf("explain %s failed: %+v", action, resp.Error)
+		}
+		return resp.Data.(*Explanation)
+	}
+
+	got := explain("gmail.search", map[string]interface{}{"query": "from:boss"})
+	if got.Decision != "allow" || got.Params["query"] != "from:boss newer_than:7d" || strings.Join(got.Rules, ",") != "query_rewritten:newer_than" {
+		t.Fatalf("unexpected search explanation: %+v", got)
+	}
+	if got.Redaction == nil || got.Redaction.Profile != "gmail_threads" || !strings.Contains(strings.Join(got.Redaction.Rules, ","), "drop:body") {
+		t.Fatalf("unexpected redaction plan: %+v", got.Redaction)
+	}
+
+	got = explain("gmail.send", map[string]interface{}{"to": "x@example.com", "subject": "hi", "body": "hello"})
+	if got.FinalAction != "gmail.drafts.create" || got.Params["subject"] != "[agent] hi" || !strings.Contains(strings.Join(got.Rules, ","), "draft_only:policy") {
+		t.Fatalf("unexpected send explanation: %+v", got)
+	}
+
+	got = explain("gmail.send", map[string]interface{}{"to": "x@example.com", "track": true})
+	if got.Decision != "deny" || got.Code != "forbidden" || got.Reason != "tracking is not allowed" {
+		t.Fatalf("expected denial, got %+v", got)
+	}
+	if got = explain("calendar.list", nil); got.Decision != "deny" || got.Reason != "action not allowed" {
+		t.Fatalf("expected disallowed action, got %+v", got)
+	}
+	if runner.calls != 0 {
+		t.Fatalf("expected gog not to run, got %d calls", runner.calls)
+	}
+
+	resp := b.Handle(context.Background(), &types.Request{ID: "2", Action: "policy.explain", Account: "a@example.com", Params: map[string]interface{}{"action": "policy.explain"}})
+	if resp.Ok || resp.Error.Code != "bad_request" {
+		t.Fatalf("expected self-explain to be rejected, got %+v", resp)
+	}
+}
+
+func TestPolicyExplainSkipsReplyThreadLookup(t *testing.T) {
+	pol := &policy.Policy{
+		AllowedActions: []string{"policy.explain", "gmail.send"},
+		Gmail:          &policy.GmailPolicy{ReplyRecipientsOnly: true},
+	}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	lookups := 0
+	pol.SetReplyRecipientsProvider(func(ctx context.Context, messageID string) ([]string, error) {
+		lookups++
+		return []string{"x@example.com"}, nil
+	})
+	b := &Broker{Policies: &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}}, RunnerProvider: &fakeRunner{}}
+
+	got := b.Explain(context.Background(), "a@example.com", "gmail.send", map[string]interface{}{"to": "x@example.com", "reply_to_message_id": "m1"})
+	if got.FinalAction != "gmail.send" || !strings.Contains(strings.Join(got.Rules, ","), "depends_on:thread_recipients") {
+		t.Fatalf("expected send to depend on the thread, got %+v", got)
+	}
+	got = b.Explain(context.Background(), "a@example.com", "gmail.send", map[string]interface{}{"to": "x@example.com"})
+	if got.FinalAction != "gmail.drafts.create" || !strings.Contains(strings.Join(got.Rules, ","), "draft_only:reply_required") {
+		t.Fatalf("expected non-reply to become a draft, got %+v", got)
+	}
+	if lookups != 0 {
+		t.Fatalf("expected no thread lookups, got %d", lookups)
+	}
+}
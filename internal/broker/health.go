@@ -0,0 +1,22 @@
+package broker
+
+import "gogcli-sandbox/internal/gog"
+
+type Health struct {
+	Status   string              `json:"status"`
+	Accounts []gog.BreakerStatus `json:"accounts,omitempty"`
+	Gog      *gog.Capabilities   `json:"gog,omitempty"`
+}
+
+func (b *Broker) Health() Health {
+	health := Health{Status: "ok", Accounts: b.Breaker.Status(), Gog: b.Gog}
+	if b.Gog != nil && !b.Gog.Supported {
+		health.Status = "degraded"
+	}
+	for _, account := range health.Accounts {
+		if account.State != gog.BreakerClosed {
+			health.Status = "degraded"
+		}
+	}
+	return health
+}
@@ -0,0 +1,223 @@
+package broker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/cursor"
+	"gogcli-sandbox/internal/types"
+)
+
+const DefaultIterateTimeout = 2 * time.Minute
+
+// iterateCursorKind keeps iterate cursors apart from page cursors, which
+// are sealed with the same key.
+const iterateCursorKind = "iterate"
+
+// iterateCursor is what an iterate cursor carries. It is only valid for the
+// account, action and params it was issued for.
+type iterateCursor struct {
+	Account string `json:"acct"`
+	Action  string `json:"act"`
+	Params  string `json:"params"`
+	Page    string `json:"page"`
+}
+
+// Iterate follows upstream page tokens for a read-only, paginated action and
+// emits each filtered and redacted page as it arrives. It stops at the
+// policy's max_iterate_items (or the smaller req.MaxItems) and hands back a
+// sealed cursor instead of the raw page token when more pages remain. The
+// last chunk has Done set and carries either the item count or the error.
+// Only a failing emit is returned.
+func (b *Broker) Iterate(ctx context.Context, req *types.IterateRequest, emit func(*types.Chunk) error) error {
+	start := time.Now()
+	if req == nil {
+		return emit(&types.Chunk{Done: true, Error: types.NewError("bad_request", "request is required", "")})
+	}
+	fields := map[string]any{"id": req.ID, "action": req.Action}
+	fail := func(code, message string) error {
+		return emit(&types.Chunk{ID: req.ID, Done: true, Error: types.NewError(code, message, "")})
+	}
+	if req.ID == "" {
+		return fail("bad_request", "id is required")
+	}
+	spec, ok := actions.Lookup(req.Action)
+	if _, paged := spec.Params["page"]; !ok || !spec.ReadOnly || !paged {
+		b.logDenied("iterate_unsupported", fields, start)
+		return fail("bad_request", "action does not support iteration")
+	}
+	if _, ok := req.Params["page"]; ok {
+		b.logDenied("iterate_page_param", fields, start)
+		return fail("bad_request", "params.page is not accepted when iterating, use cursor")
+	}
+	if req.MaxItems < 0 {
+		return fail("bad_request", "max_items must not be negative")
+	}
+	requested := req.Account
+	if requested == "" {
+		requested = PrincipalFrom(ctx).defaultAccount()
+	}
+	pol, account, err := b.resolvePolicy(requested)
+	if err != nil {
+		// Handle reports the precise account error.
+		account = requested
+	}
+	fields["account"] = account
+
+	limit := pol.MaxIterateItems(req.Action)
+	if req.MaxItems > 0 && req.MaxItems < limit {
+		limit = req.MaxItems
+	}
+	pageSize := 0
+	if p, ok := spec.Params["max"]; ok {
+		pageSize = limit
+		if max, ok := getInt(req.Params, "max"); ok && max < pageSize {
+			pageSize = max
+		}
+		if p.Maximum != nil && int(*p.Maximum) < pageSize {
+			pageSize = int(*p.Maximum)
+		}
+	}
+
+	sealer, err := b.cursorSealer()
+	if err != nil {
+		b.logError("cursor_error", fields, start)
+		return fail("bad_request", "cursors are unavailable")
+	}
+	binding := paramsDigest(req.Params)
+	page := ""
+	if req.Cursor != "" {
+		var c iterateCursor
+		if err := sealer.Open(iterateCursorKind, req.Cursor, &c); err != nil || c.Account != account || c.Action != req.Action || c.Params != binding || c.Page == "" {
+			b.logDenied("cursor_invalid", fields, start)
+			return fail("bad_request", "invalid cursor")
+		}
+		page = c.Page
+	}
+	resume := func() string {
+		token, err := sealer.Seal(iterateCursorKind, iterateCursor{Account: account, Action: req.Action, Params: binding, Page: page})
+		if err != nil {
+			return ""
+		}
+		return token
+	}
+
+	timeout := b.IterateTimeout
+	if timeout <= 0 {
+		timeout = DefaultIterateTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx, span := b.Tracer.Start(ctx, "broker.Iterate")
+	span.SetAttr("action", req.Action)
+	defer span.Finish()
+
+	count := 0
+	n := 0
+	done := func(chunk *types.Chunk) error {
+		fields["pages"] = n
+		fields["items"] = count
+		if chunk.Error != nil {
+			b.logError("iterate_failed", fields, start)
+		} else {
+			b.logAllowed("iterate_done", fields, start)
+		}
+		chunk.ID = req.ID
+		chunk.Done = true
+		chunk.Count = count
+		return emit(chunk)
+	}
+	for {
+		if n > 0 && ctx.Err() != nil {
+			return done(&types.Chunk{Cursor: resume(), Warnings: []string{"iterate_time_budget_exceeded"}})
+		}
+		n++
+		params := cloneParams(req.Params)
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		if page != "" {
+			params["page"] = page
+		}
+		if pageSize > 0 {
+			remaining := limit - count
+			if remaining < pageSize {
+				params["max"] = float64(remaining)
+			} else {
+				params["max"] = float64(pageSize)
+			}
+		}
+		resp := b.Handle(ctx, &types.Request{ID: req.ID, Action: req.Action, Account: req.Account, Params: params})
+		if !resp.Ok {
+			chunk := &types.Chunk{Page: n, Error: resp.Error}
+			if page != "" {
+				chunk.Cursor = resume()
+			}
+			return done(chunk)
+		}
+		next, items := splitPage(resp.Data)
+		count += items
+		if err := emit(&types.Chunk{ID: req.ID, Page: n, Data: resp.Data, Warnings: resp.Warnings}); err != nil {
+			return err
+		}
+		if next == "" {
+			return done(&types.Chunk{})
+		}
+		page = next
+		if count >= limit {
+			return done(&types.Chunk{Cursor: resume()})
+		}
+	}
+}
+
+func (b *Broker) cursorSealer() (*cursor.Sealer, error) {
+	b.cursorMu.Lock()
+	defer b.cursorMu.Unlock()
+	if b.Cursors == nil {
+		sealer, err := cursor.NewSealer(nil)
+		if err != nil {
+			return nil, err
+		}
+		b.Cursors = sealer
+	}
+	return b.Cursors, nil
+}
+
+// splitPage removes the upstream page token from a redacted page and counts
+// the items in its list.
+func splitPage(data any) (string, int) {
+	switch v := data.(type) {
+	case []interface{}:
+		return "", len(v)
+	case map[string]interface{}:
+		next, _ := v["nextPageToken"].(string)
+		delete(v, "nextPageToken")
+		for _, value := range v {
+			if list, ok := value.([]interface{}); ok {
+				return next, len(list)
+			}
+		}
+		return next, 0
+	}
+	return "", 0
+}
+
+func paramsDigest(params map[string]interface{}) string {
+	data, _ := json.Marshal(params)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getInt(params map[string]interface{}, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
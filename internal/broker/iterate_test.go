@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/cursor"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+func pagedCalendars(total int) *fakeRunner {
+	return &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		start := 0
+		if page, ok := params["page"].(string); ok {
+			start, _ = strconv.Atoi(strings.TrimPrefix(page, "tok"))
+		}
+		end := start + int(params["max"].(float64))
+		if end > total {
+			end = total
+		}
+		cals := []interface{}{}
+		for i := start; i < end; i++ {
+			cals = append(cals, map[string]interface{}{"id": "cal" + strconv.Itoa(i)})
+		}
+		out := map[string]interface{}{"calendars": cals}
+		if end < total {
+			out["nextPageToken"] = "tok" + strconv.Itoa(end)
+		}
+		return out, nil
+	}}
+}
+
+func collect(t *testing.T, b *Broker, req *types.IterateRequest) []*types.Chunk {
+	t.Helper()
+	var chunks []*types.Chunk
+	if err := b.Iterate(context.Background(), req, func(c *types.Chunk) error {
+		chunks = append(chunks, c)
+		return nil
+	}); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	if len(chunks) == 0 || !chunks[len(chunks)-1].Done {
+		t.Fatalf("expected a final done chunk, got %+v", chunks)
+	}
+	return chunks
+}
+
+func TestIterateFollowsPagesAndResumesWithCursor(t *testing.T) {
+	b := batchTestBroker(t, pagedCalendars(5))
+	req := &types.IterateRequest{
+		Request:  types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(2)}},
+		MaxItems: 3,
+	}
+	chunks := collect(t, b, req)
+	last := chunks[len(chunks)-1]
+	if len(chunks) != 3 || last.Count != 3 || last.Cursor == "" || last.Error != nil {
+		t.Fatalf("expected two pages and a cursor, got %+v", last)
+	}
+	raw, _ := json.Marshal(chunks)
+	if strings.Contains(string(raw), "tok") {
+		t.Fatalf("raw page token leaked: %s", raw)
+	}
+
+	req.Cursor = last.Cursor
+	req.MaxItems = 0
+	chunks = collect(t, b, req)
+	last = chunks[len(chunks)-1]
+	if last.Count != 2 || last.Cursor != "" {
+		t.Fatalf("expected the remaining two items, got %+v", last)
+	}
+	page := chunks[0].Data.(map[string]interface{})["calendars"].([]interface{})
+	if page[0].(map[string]interface{})["id"] != "cal3" {
+		t.Fatalf("expected resume at cal3, got %v", page)
+	}
+}
+
+func TestIterateRejectsTamperingAndUnsupportedActions(t *testing.T) {
+	b := batchTestBroker(t, pagedCalendars(5))
+	first := collect(t, b, &types.IterateRequest{
+		Request:  types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(2)}},
+		MaxItems: 2,
+	})
+	cursor := first[len(first)-1].Cursor
+
+	cases := []*types.IterateRequest{
+		{Request: types.Request{ID: "2", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(3)}}, Cursor: cursor},
+		{Request: types.Request{ID: "3", Action: "calendar.list", Account: "a@example.com"}, Cursor: cursor + "x"},
+		{Request: types.Request{ID: "4", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"page": "tok4"}}},
+		{Request: types.Request{ID: "5", Action: "calendar.freebusy", Account: "a@example.com"}},
+	}
+	for _, req := range cases {
+		chunks := collect(t, b, req)
+		if len(chunks) != 1 || chunks[0].Error == nil || chunks[0].Error.Code != "bad_request" {
+			t.Fatalf("request %s: expected bad_request, got %+v", req.ID, chunks[0])
+		}
+	}
+
+	pol := b.Policies.Accounts["a@example.com"]
+	pol.Calendar = &policy.CalendarPolicy{MaxIterateItems: 1}
+	chunks := collect(t, b, &types.IterateRequest{Request: types.Request{ID: "6", Action: "calendar.list", Account: "a@example.com"}})
+	if last := chunks[len(chunks)-1]; last.Count != 1 || last.Cursor == "" {
+		t.Fatalf("expected the policy cap to stop after one item, got %+v", last)
+	}
+}
+
+func TestHandleWrapsPageTokens(t *testing.T) {
+	runner := pagedCalendars(3)
+	var seen []string
+	run := runner.run
+	runner.run = func(action string, params map[string]interface{}) (any, error) {
+		if page, ok := params["page"].(string); ok {
+			seen = append(seen, page)
+		}
+		return run(action, params)
+	}
+	b := batchTestBroker(t, runner)
+	sealer, _ := cursor.NewSealer(nil)
+	b.Cursors = sealer
+	b.Policies.Accounts["a@example.com"].SetPageCursors("a@example.com", sealer, time.Hour)
+
+	resp := b.Handle(context.Background(), &types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(2)}})
+	next, _ := resp.Data.(map[string]interface{})["nextPageToken"].(string)
+	if !resp.Ok || next == "" || strings.HasPrefix(next, "tok") {
+		t.Fatalf("expected a wrapped page token, got %+v", resp)
+	}
+	resp = b.Handle(context.Background(), &types.Request{ID: "2", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(2), "page": "tok2"}})
+	if resp.Ok || resp.Error.Code != "forbidden" {
+		t.Fatalf("expected a raw page token to be rejected, got %+v", resp)
+	}
+	resp = b.Handle(context.Background(), &types.Request{ID: "3", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(2), "page": next}})
+	if !resp.Ok || len(seen) != 1 || seen[0] != "tok2" {
+		t.Fatalf("expected the runner to get the raw token, got %+v (%v)", resp, seen)
+	}
+
+	chunks := collect(t, b, &types.IterateRequest{Request: types.Request{ID: "4", Action: "calendar.list", Account: "a@example.com", Params: map[string]interface{}{"max": float64(1)}}})
+	if last := chunks[len(chunks)-1]; last.Count != 3 || last.Error != nil {
+		t.Fatalf("expected iterate to follow wrapped tokens, got %+v", last)
+	}
+}
@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/policy"
+)
+
+const (
+	defaultLabelTTL       = 10 * time.Minute
+	labelRetryBaseDelay   = time.Second
+	labelRetryMaxDelay    = 5 * time.Minute
+	labelMissRefreshEvery = 30 * time.Second
+)
+
+type labelEntry struct {
+	labels      map[string]string
+	loadedAt    time.Time
+	attemptedAt time.Time
+	err         error
+	failures    int
+	retryAt     time.Time
+	refreshing  chan struct{}
+}
+
+type LabelCacheStatus struct {
+	Account    string  `json:"account"`
+	Loaded     bool    `json:"loaded"`
+	LoadedAt   string  `json:"loaded_at,omitempty"`
+	AgeSeconds float64 `json:"age_seconds,omitempty"`
+	Labels     int     `json:"labels"`
+	Failures   int     `json:"failures,omitempty"`
+	LastError  string  `json:"last_error,omitempty"`
+	RetryAt    string  `json:"retry_at,omitempty"`
+}
+
+func (b *Broker) ensureLabelMap(ctx context.Context, account string, pol *policy.Policy) error {
+	if b == nil || pol == nil || b.RunnerProvider == nil {
+		return nil
+	}
+	now := time.Now()
+	b.labelMu.Lock()
+	entry := b.labelEntryLocked(account)
+	fresh := !entry.loadedAt.IsZero() && now.Sub(entry.loadedAt) < b.labelTTL()
+	backingOff := now.Before(entry.retryAt)
+	hasLabels := entry.labels != nil
+	lastErr := entry.err
+	b.labelMu.Unlock()
+
+	if fresh {
+		return nil
+	}
+	if backingOff {
+		if hasLabels {
+			return nil
+		}
+		return lastErr
+	}
+	if err := b.refreshLabels(ctx, account, pol); err != nil {
+		if hasLabels {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// LabelRefresher returns the hook the policy calls when it meets a label it
+// does not know, so labels created after the last refresh are picked up.
+func (b *Broker) LabelRefresher(account string, pol *policy.Policy) func(context.Context) error {
+	return func(ctx context.Context) error {
+		b.labelMu.Lock()
+		entry := b.labelEntryLocked(account)
+		recent := time.Since(entry.attemptedAt) < labelMissRefreshEvery
+		backingOff := time.Now().Before(entry.retryAt)
+		b.labelMu.Unlock()
+		if recent || backingOff {
+			return nil
+		}
+		return b.refreshLabels(ctx, account, pol)
+	}
+}
+
+func (b *Broker) refreshLabels(ctx context.Context, account string, pol *policy.Policy) error {
+	b.labelMu.Lock()
+	entry := b.labelEntryLocked(account)
+	if wait := entry.refreshing; wait != nil {
+		b.labelMu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.labelMu.Lock()
+		defer b.labelMu.Unlock()
+		return entry.err
+	}
+	done := make(chan struct{})
+	entry.refreshing = done
+	entry.attemptedAt = time.Now()
+	b.labelMu.Unlock()
+
+	idToName, err := b.fetchLabels(ctx, account)
+
+	b.labelMu.Lock()
+	defer b.labelMu.Unlock()
+	entry.refreshing = nil
+	close(done)
+	if err != nil {
+		entry.err = err
+		entry.failures++
+		entry.retryAt = time.Now().Add(labelBackoff(entry.failures))
+		return err
+	}
+	pol.SetLabelMap(idToName)
+	// A reload during the fetch swapped in policies that were handed the
+	// previous map, so update the current one too.
+	if set := b.policySet(); set != nil {
+		if cur, _, err := set.Resolve(account, b.DefaultAccount); err == nil && cur != pol {
+			cur.SetLabelMap(idToName)
+		}
+	}
+	entry.labels = idToName
+	entry.loadedAt = time.Now()
+	entry.err = nil
+	entry.failures = 0
+	entry.retryAt = time.Time{}
+	return nil
+}
+
+func (b *Broker) fetchLabels(ctx context.Context, account string) (map[string]string, error) {
+	runner := b.RunnerProvider.RunnerFor(account)
+	data, err := runner.Run(gog.NoCache(ctx), "gmail.labels.list", nil)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid labels response")
+	}
+	rawLabels, ok := root["labels"]
+	if !ok {
+		return nil, errors.New("labels missing")
+	}
+	items, ok := rawLabels.([]interface{})
+	if !ok {
+		return nil, errors.New("labels invalid")
+	}
+	idToName := map[string]string{}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := m["id"].(string)
+		name, _ := m["name"].(string)
+		if id != "" && name != "" {
+			idToName[id] = name
+		}
+	}
+	if len(idToName) == 0 {
+		return nil, errors.New("labels empty")
+	}
+	return idToName, nil
+}
+
+func (b *Broker) LabelCacheStatus() []LabelCacheStatus {
+	b.labelMu.Lock()
+	defer b.labelMu.Unlock()
+	now := time.Now()
+	out := make([]LabelCacheStatus, 0, len(b.labels))
+	for key, entry := range b.labels {
+		status := LabelCacheStatus{Account: key, Loaded: entry.labels != nil, Labels: len(entry.labels), Failures: entry.failures}
+		if !entry.loadedAt.IsZero() {
+			status.LoadedAt = entry.loadedAt.UTC().Format(time.RFC3339)
+			status.AgeSeconds = now.Sub(entry.loadedAt).Seconds()
+		}
+		if entry.err != nil {
+			status.LastError = entry.err.Error()
+		}
+		if now.Before(entry.retryAt) {
+			status.RetryAt = entry.retryAt.UTC().Format(time.RFC3339)
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Account < out[j].Account })
+	return out
+}
+
+func (b *Broker) labelEntryLocked(account string) *labelEntry {
+	if b.labels == nil {
+		b.labels = map[string]*labelEntry{}
+	}
+	key := account
+	if key == "" {
+		key = "_default"
+	}
+	entry, ok := b.labels[key]
+	if !ok {
+		entry = &labelEntry{}
+		b.labels[key] = entry
+	}
+	return entry
+}
+
+func (b *Broker) labelTTL() time.Duration {
+	if b.LabelTTL > 0 {
+		return b.LabelTTL
+	}
+	return defaultLabelTTL
+}
+
+func labelBackoff(failures int) time.Duration {
+	delay := labelRetryBaseDelay
+	for i := 1; i < failures && delay < labelRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > labelRetryMaxDelay {
+		delay = labelRetryMaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
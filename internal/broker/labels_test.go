@@ -0,0 +1,189 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/policy"
+)
+
+type fakeRunner struct {
+	calls int32
+	fail  atomic.Bool
+	delay time.Duration
+	run   func(action string, params map[string]interface{}) (any, error)
+}
+
+func (f *fakeRunner) RunnerFor(account string) gog.Runner {
+	return f
+}
+
+func (f *fakeRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
+	if f.run != nil {
+		return f.run(action, params)
+	}
+	if f.fail.Load() {
+		return nil, errors.New("gog failed")
+	}
+	return map[string]interface{}{"labels": []interface{}{
+		map[string]interface{}{"id": "Label_1", "name": "Project"},
+	}}, nil
+}
+
+func labelTestPolicy(t *testing.T) *policy.Policy {
+	t.Helper()
+	pol := &policy.Policy{AllowedActions: []string{"gmail.labels.get"}, Gmail: &policy.GmailPolicy{AllowedReadLabels: []string{"Label_1"}}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return pol
+}
+
+func TestEnsureLabelMapRetriesAfterFailure(t *testing.T) {
+	runner := &fakeRunner{}
+	runner.fail.Store(true)
+	b := &Broker{RunnerProvider: runner}
+	pol := labelTestPolicy(t)
+	ctx := context.Background()
+
+	if err := b.ensureLabelMap(ctx, "a@example.com", pol); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := b.ensureLabelMap(ctx, "a@example.com", pol); err == nil {
+		t.Fatalf("expected cached error during backoff")
+	}
+	if calls := atomic.LoadInt32(&runner.calls); calls != 1 {
+		t.Fatalf("expected 1 call during backoff, got %d", calls)
+	}
+
+	runner.fail.Store(false)
+	b.labelMu.Lock()
+	b.labels["a@example.com"].retryAt = time.Time{}
+	b.labelMu.Unlock()
+	if err := b.ensureLabelMap(ctx, "a@example.com", pol); err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	if _, ok := pol.LabelIDForName("Project"); !ok {
+		t.Fatalf("expected label map to be set")
+	}
+}
+
+func TestEnsureLabelMapRefreshesAfterTTL(t *testing.T) {
+	runner := &fakeRunner{}
+	b := &Broker{RunnerProvider: runner, LabelTTL: time.Hour}
+	pol := labelTestPolicy(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := b.ensureLabelMap(ctx, "", pol); err != nil {
+			t.Fatalf("ensure: %v", err)
+		}
+	}
+	if calls := atomic.LoadInt32(&runner.calls); calls != 1 {
+		t.Fatalf("expected 1 call within ttl, got %d", calls)
+	}
+
+	b.labelMu.Lock()
+	b.labels["_default"].loadedAt = time.Now().Add(-2 * time.Hour)
+	b.labelMu.Unlock()
+	runner.fail.Store(true)
+	if err := b.ensureLabelMap(ctx, "", pol); err != nil {
+		t.Fatalf("expected stale labels to be served, got %v", err)
+	}
+	if calls := atomic.LoadInt32(&runner.calls); calls != 2 {
+		t.Fatalf("expected refresh after ttl, got %d calls", calls)
+	}
+}
+
+func TestRefreshLabelsCoalescesConcurrentCalls(t *testing.T) {
+	runner := &fakeRunner{delay: 50 * time.Millisecond}
+	b := &Broker{RunnerProvider: runner}
+	pol := labelTestPolicy(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.ensureLabelMap(context.Background(), "a@example.com", pol); err != nil {
+				t.Errorf("ensure: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt32(&runner.calls); calls != 1 {
+		t.Fatalf("expected coalesced refresh, got %d calls", calls)
+	}
+}
+
+func TestLabelRefresherLearnsNewLabels(t *testing.T) {
+	labels := []interface{}{map[string]interface{}{"id": "Label_1", "name": "Project"}}
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"labels": labels}, nil
+	}}
+	b := &Broker{RunnerProvider: runner}
+	pol := &policy.Policy{AllowedActions: []string{"gmail.labels.get"}, Gmail: &policy.GmailPolicy{AllowedReadLabels: []string{"Label_2"}}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	pol.SetLabelRefresher(b.LabelRefresher("a@example.com", pol))
+	if err := b.ensureLabelMap(context.Background(), "a@example.com", pol); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+
+	labels = append(labels, map[string]interface{}{"id": "Label_2", "name": "New Label"})
+	b.labelMu.Lock()
+	b.labels["a@example.com"].attemptedAt = time.Time{}
+	b.labelMu.Unlock()
+	if _, _, err := pol.ValidateAndRewrite(context.Background(), "gmail.labels.get", map[string]interface{}{"label": "New Label"}); err != nil {
+		t.Fatalf("expected new label to be learned, got %v", err)
+	}
+}
+
+func TestSetPoliciesKeepsCachedLabelMaps(t *testing.T) {
+	runner := &fakeRunner{}
+	b := &Broker{RunnerProvider: runner, LabelTTL: time.Hour}
+	ctx := context.Background()
+	if err := b.ensureLabelMap(ctx, "a@example.com", labelTestPolicy(t)); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+
+	reloaded := labelTestPolicy(t)
+	b.SetPolicies(&policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": reloaded}}, PolicyInfo{})
+	if err := b.ensureLabelMap(ctx, "a@example.com", reloaded); err != nil {
+		t.Fatalf("ensure after reload: %v", err)
+	}
+	if calls := atomic.LoadInt32(&runner.calls); calls != 1 {
+		t.Fatalf("expected cached labels to be reused, got %d calls", calls)
+	}
+	if _, ok := reloaded.LabelIDForName("Project"); !ok {
+		t.Fatalf("expected reloaded policy to have the label map")
+	}
+}
+
+func TestLabelRefreshDuringReloadUpdatesCurrentPolicy(t *testing.T) {
+	old := labelTestPolicy(t)
+	b := &Broker{Policies: &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": old}}}
+	reloaded := labelTestPolicy(t)
+	b.RunnerProvider = &fakeRunner{run: func(string, map[string]interface{}) (any, error) {
+		b.SetPolicies(&policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": reloaded}}, PolicyInfo{})
+		return map[string]interface{}{"labels": []interface{}{
+			map[string]interface{}{"id": "Label_1", "name": "Project"},
+		}}, nil
+	}}
+	if err := b.ensureLabelMap(context.Background(), "a@example.com", old); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if _, ok := reloaded.LabelIDForName("Project"); !ok {
+		t.Fatalf("expected policy swapped in during the refresh to get the label map")
+	}
+}
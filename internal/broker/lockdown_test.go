@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+func lockdownTestBroker(t *testing.T) *Broker {
+	t.Helper()
+	accounts := map[string]*policy.Policy{}
+	for _, account := range []string{"a@example.com", "b@example.com"} {
+		pol := &policy.Policy{AllowedActions: []string{"calendar.list", "gmail.send"}, Calendar: &policy.CalendarPolicy{}, Gmail: &policy.GmailPolicy{}}
+		if err := pol.Validate(); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		accounts[account] = pol
+	}
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	return &Broker{Policies: &policy.PolicySet{Accounts: accounts}, RunnerProvider: runner}
+}
+
+func TestLockdownDeniesWritesOnly(t *testing.T) {
+	b := lockdownTestBroker(t)
+	send := func(account string) *types.Response {
+		return b.Handle(context.Background(), &types.Request{ID: "1", Action: "gmail.send", Account: account, Params: map[string]interface{}{"to": "x@example.com"}})
+	}
+	locked := func(resp *types.Response) bool {
+		return !resp.Ok && resp.Error.Code == "lockdown"
+	}
+
+	if !b.SetLockdown("", true, "test") || b.SetLockdown("", true, "test") {
+		t.Fatalf("expected only the first toggle to change state")
+	}
+	if resp := send("a@example.com"); !locked(resp) {
+		t.Fatalf("expected lockdown, got %+v", resp)
+	}
+	if resp := b.Handle(context.Background(), &types.Request{ID: "2", Action: "calendar.list", Account: "a@example.com"}); !resp.Ok {
+		t.Fatalf("expected reads to keep working, got %+v", resp)
+	}
+	b.SetLockdown("", false, "test")
+
+	b.SetLockdown("A@example.com", true, "test")
+	if resp := send("a@example.com"); !locked(resp) {
+		t.Fatalf("expected account lockdown, got %+v", resp)
+	}
+	if resp := send("b@example.com"); locked(resp) {
+		t.Fatalf("expected other account to be unaffected, got %+v", resp)
+	}
+	if status := b.Lockdown(); status.Broker || len(status.Accounts) != 1 || status.Accounts[0] != "a@example.com" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestLockdownFile(t *testing.T) {
+	b := lockdownTestBroker(t)
+	b.LockdownFile = filepath.Join(t.TempDir(), "lockdown")
+	if b.lockedDown("a@example.com") {
+		t.Fatalf("expected no lockdown without the file")
+	}
+
+	if err := os.WriteFile(b.LockdownFile, nil, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !b.lockedDown("b@example.com") || !b.Lockdown().FileBroker {
+		t.Fatalf("expected an empty file to lock down the broker")
+	}
+
+	if err := os.WriteFile(b.LockdownFile, []byte("# incident 42\nA@example.com\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !b.lockedDown("a@example.com") || b.lockedDown("b@example.com") {
+		t.Fatalf("expected only the listed account to be locked down: %+v", b.Lockdown())
+	}
+
+	if err := os.Remove(b.LockdownFile); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if b.lockedDown("a@example.com") {
+		t.Fatalf("expected removing the file to lift the lockdown")
+	}
+}
+
+func TestIsWrite(t *testing.T) {
+	for action, want := range map[string]bool{
+		"gmail.send":          true,
+		"gmail.labels.modify": true,
+		"gmail.send.cancel":   false,
+		"calendar.list":       false,
+		"no.such.action":      true,
+	} {
+		if got := isWrite(action); got != want {
+			t.Fatalf("isWrite(%q) = %v, want %v", action, got, want)
+		}
+	}
+}
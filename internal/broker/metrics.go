@@ -0,0 +1,135 @@
+package broker
+
+import (
+	"strings"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/metrics"
+	"gogcli-sandbox/internal/types"
+)
+
+type brokerMetrics struct {
+	requests  *metrics.Counter
+	warnings  *metrics.Counter
+	redaction *metrics.Histogram
+	gog       *metrics.Histogram
+}
+
+// RegisterMetrics adds the broker's metrics to reg and starts recording
+// them. Call it before serving requests.
+func (b *Broker) RegisterMetrics(reg *metrics.Registry) {
+	b.Metrics = reg
+	b.metrics = &brokerMetrics{
+		requests:  reg.Counter("gogcli_sandbox_requests_total", "Requests by action, account, decision and error code.", "action", "account", "decision", "code"),
+		warnings:  reg.Counter("gogcli_sandbox_warnings_total", "Response warnings by action and type.", "action", "warning"),
+		redaction: reg.Histogram("gogcli_sandbox_redaction_duration_seconds", "Time spent filtering and redacting upstream data.", nil, "action"),
+		gog:       reg.Histogram("gogcli_sandbox_gog_duration_seconds", "Duration of gog subprocess calls.", nil, "action", "outcome"),
+	}
+
+	reg.GaugeFunc("gogcli_sandbox_label_cache_labels", "Labels in the label cache.", []string{"account"}, func() []metrics.Sample {
+		return b.labelSamples(func(s LabelCacheStatus) float64 { return float64(s.Labels) })
+	})
+	reg.GaugeFunc("gogcli_sandbox_label_cache_age_seconds", "Age of the cached label map.", []string{"account"}, func() []metrics.Sample {
+		return b.labelSamples(func(s LabelCacheStatus) float64 { return s.AgeSeconds })
+	})
+	reg.GaugeFunc("gogcli_sandbox_label_cache_failures", "Consecutive label map refresh failures.", []string{"account"}, func() []metrics.Sample {
+		return b.labelSamples(func(s LabelCacheStatus) float64 { return float64(s.Failures) })
+	})
+	reg.GaugeFunc("gogcli_sandbox_limiter_in_flight", "gog calls running.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(b.Limiter.Stats().InFlight)}}
+	})
+	reg.GaugeFunc("gogcli_sandbox_limiter_queued", "gog calls waiting for a slot.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(b.Limiter.Stats().Queued)}}
+	})
+	reg.CounterFunc("gogcli_sandbox_limiter_rejected_total", "gog calls rejected because the queue was full.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(b.Limiter.Stats().Rejected)}}
+	})
+	reg.CounterFunc("gogcli_sandbox_limiter_timed_out_total", "gog calls that timed out waiting for a slot.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(b.Limiter.Stats().TimedOut)}}
+	})
+}
+
+// ObserveGog records one gog subprocess call; see gog.RunnerFactory.Observer.
+func (b *Broker) ObserveGog(action string, elapsed time.Duration, err error) {
+	if b.metrics == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	b.metrics.gog.Observe(elapsed.Seconds(), metricAction(action), outcome)
+}
+
+func (b *Broker) observeRequest(req *types.Request, resp *types.Response) {
+	if b.metrics == nil {
+		return
+	}
+	action := ""
+	account := "unknown"
+	if req != nil {
+		action = req.Action
+		if _, resolved, err := b.resolvePolicy(req.Account); err == nil {
+			account = resolved
+		}
+	}
+	action = metricAction(action)
+	decision, code := "allow", "ok"
+	if !resp.Ok {
+		decision, code = "error", "unknown"
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		if isDenial(code) {
+			decision = "deny"
+		}
+	}
+	b.metrics.requests.Inc(action, account, decision, code)
+	for _, warning := range resp.Warnings {
+		b.metrics.warnings.Inc(action, warningType(warning))
+	}
+}
+
+func (b *Broker) observeRedaction(action string, start time.Time) {
+	if b.metrics != nil {
+		b.metrics.redaction.Observe(time.Since(start).Seconds(), metricAction(action))
+	}
+}
+
+func (b *Broker) labelSamples(value func(LabelCacheStatus) float64) []metrics.Sample {
+	statuses := b.LabelCacheStatus()
+	samples := make([]metrics.Sample, 0, len(statuses))
+	for _, status := range statuses {
+		samples = append(samples, metrics.Sample{Labels: []string{status.Account}, Value: value(status)})
+	}
+	return samples
+}
+
+func isDenial(code string) bool {
+	switch code {
+	case "forbidden", "bad_request", "action_disabled", "disabled", "lockdown":
+		return true
+	}
+	return false
+}
+
+// metricAction keeps label values to known actions; anything an agent makes
+// up is counted together.
+func metricAction(action string) string {
+	if _, ok := actions.Lookup(action); ok {
+		return action
+	}
+	return "unknown"
+}
+
+// warningType keeps the kind and first qualifier of a warning
+// ("draft_only:recipient_not_allowed:cc" counts as
+// "draft_only:recipient_not_allowed").
+func warningType(warning string) string {
+	parts := strings.SplitN(warning, ":", 3)
+	if len(parts) > 2 {
+		return parts[0] + ":" + parts[1]
+	}
+	return warning
+}
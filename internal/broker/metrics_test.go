@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gogcli-sandbox/internal/metrics"
+	"gogcli-sandbox/internal/types"
+)
+
+func TestMetricsCountDecisions(t *testing.T) {
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return map[string]interface{}{"calendars": []interface{}{}}, nil
+	}}
+	b := batchTestBroker(t, runner)
+	reg := metrics.NewRegistry()
+	b.RegisterMetrics(reg)
+
+	b.Handle(context.Background(), &types.Request{ID: "1", Action: "calendar.list", Account: "a@example.com"})
+	b.Handle(context.Background(), &types.Request{ID: "2", Action: "gmail.send", Account: "a@example.com"})
+	b.Handle(context.Background(), &types.Request{ID: "3", Action: "made.up", Account: "nobody@example.com"})
+
+	var out strings.Builder
+	if err := reg.WriteText(&out); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, want := range []string{
+		`gogcli_sandbox_requests_total{action="calendar.list",account="a@example.com",decision="allow",code="ok"} 1`,
+		`gogcli_sandbox_requests_total{action="gmail.send",account="a@example.com",decision="deny",code="forbidden"} 1`,
+		`gogcli_sandbox_requests_total{action="unknown",account="unknown",decision="deny",code="forbidden"} 1`,
+		`gogcli_sandbox_redaction_duration_seconds_count{action="calendar.list"} 1`,
+		`gogcli_sandbox_limiter_in_flight 0`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWarningType(t *testing.T) {
+	for in, want := range map[string]string{
+		"filtered:labels":                      "filtered:labels",
+		"redacted:string":                      "redacted:string",
+		"draft_only:recipient_not_allowed:cc":  "draft_only:recipient_not_allowed",
+		"action_rewritten:gmail.drafts.create": "action_rewritten:gmail.drafts.create",
+	} {
+		if got := warningType(in); got != want {
+			t.Fatalf("%s: got %s", in, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/outbox"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+const (
+	outboxMaxAttempts  = 5
+	outboxRetryDelay   = time.Minute
+	outboxPollInterval = time.Minute
+)
+
+func (b *Broker) queueSend(req *types.Request, account string, original map[string]interface{}, delay time.Duration, warnings []string, fields map[string]any, start time.Time) *types.Response {
+	if b.Outbox == nil {
+		b.logError("outbox_unavailable", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("outbox_error", "send delay is configured but the outbox is unavailable", "")}
+	}
+	entry, err := b.Outbox.Add(outbox.Entry{
+		Account:   account,
+		RequestID: req.ID,
+		Params:    original,
+		SendAt:    time.Now().UTC().Add(delay),
+	})
+	if err != nil {
+		b.logError("outbox_error", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("outbox_error", "failed to queue send", "")}
+	}
+	warnings = append(warnings, fmt.Sprintf("send_delayed:%dm", int(delay/time.Minute)))
+	fields = cloneFields(fields)
+	fields["pending_id"] = entry.ID
+	b.logAllowed("send_queued", fields, start)
+	return &types.Response{ID: req.ID, Ok: true, Warnings: warnings, Data: map[string]any{
+		"status":     "pending",
+		"pending_id": entry.ID,
+		"send_at":    entry.SendAt.Format(time.RFC3339),
+	}}
+}
+
+func (b *Broker) cancelSend(req *types.Request, account string, params map[string]interface{}, warnings []string, fields map[string]any, start time.Time) *types.Response {
+	if b.Outbox == nil {
+		b.logDenied("outbox_unavailable", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("not_found", outbox.ErrNotFound.Error(), "")}
+	}
+	id, _ := params["id"].(string)
+	entry, err := b.Outbox.Cancel(account, id)
+	if err != nil {
+		if errors.Is(err, outbox.ErrNotFound) {
+			b.logDenied("send_cancel_not_found", fields, start)
+			return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("not_found", err.Error(), "")}
+		}
+		if errors.Is(err, outbox.ErrInFlight) {
+			b.logDenied("send_cancel_too_late", fields, start)
+			return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("conflict", err.Error(), "")}
+		}
+		b.logError("outbox_error", fields, start)
+		return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("outbox_error", "failed to cancel send", "")}
+	}
+	fields = cloneFields(fields)
+	fields["pending_id"] = entry.ID
+	b.logAllowed("send_cancelled", fields, start)
+	resp := &types.Response{ID: req.ID, Ok: true, Data: map[string]any{
+		"status":     "cancelled",
+		"pending_id": entry.ID,
+	}}
+	if len(warnings) > 0 {
+		resp.Warnings = warnings
+	}
+	return resp
+}
+
+func (b *Broker) RunOutbox(ctx context.Context) {
+	if b == nil || b.Outbox == nil {
+		return
+	}
+	for {
+		b.flushOutbox(ctx)
+		wait := outboxPollInterval
+		if next, ok := b.Outbox.Next(); ok {
+			if until := time.Until(next); until < wait {
+				wait = until
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-b.Outbox.Changed():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *Broker) flushOutbox(ctx context.Context) {
+	for _, entry := range b.Outbox.Due(time.Now()) {
+		if ctx.Err() != nil {
+			return
+		}
+		b.dispatchPending(ctx, entry)
+	}
+}
+
+// dispatchPending sends a queued message after re-checking it against the
+// policy that is current at send time, not the one it was queued under.
+func (b *Broker) dispatchPending(ctx context.Context, entry outbox.Entry) {
+	start := time.Now()
+	fields := map[string]any{"id": entry.RequestID, "action": "gmail.send", "account": entry.Account, "pending_id": entry.ID}
+	if !b.Outbox.Claim(entry.ID) {
+		return
+	}
+	defer b.Outbox.Release(entry.ID)
+
+	drop := func(msg string) {
+		if err := b.Outbox.Remove(entry.ID); err != nil && !errors.Is(err, outbox.ErrNotFound) {
+			b.logError("outbox_error", fields, start)
+			return
+		}
+		b.logDenied(msg, fields, start)
+	}
+
+	pol, account, err := b.resolvePolicy(entry.Account)
+	if err != nil {
+		drop("pending_send_account_denied")
+		return
+	}
+	_, accountOff := b.switchedOff("account", account)
+	if _, actionOff := b.switchedOff("action", "gmail.send"); accountOff || actionOff || b.lockedDown(account) {
+		if err := b.Outbox.Postpone(entry.ID, time.Now().UTC().Add(outboxRetryDelay)); err != nil && !errors.Is(err, outbox.ErrNotFound) {
+			b.logError("outbox_error", fields, start)
+			return
+		}
+		b.logDenied("pending_send_held", fields, start)
+		return
+	}
+	if !pol.IsActionAllowed("gmail.send") {
+		drop("pending_send_action_denied")
+		return
+	}
+	ctx = policy.WithReplyLookups(ctx)
+	params, _, err := pol.ValidateAndRewrite(ctx, "gmail.send", cloneParams(entry.Params))
+	if err != nil {
+		drop("pending_send_policy_denied")
+		return
+	}
+	runAction := "gmail.send"
+	if pol.DraftSendRequired(ctx, params) {
+		runAction = "gmail.drafts.create"
+		fields["rewritten_to"] = runAction
+	}
+
+	runner := b.RunnerProvider.RunnerFor(account)
+	if _, err := runner.Run(ctx, runAction, params); err != nil {
+		if !sendNotAttempted(err) || entry.Attempts+1 >= outboxMaxAttempts {
+			if rmErr := b.Outbox.Remove(entry.ID); rmErr != nil && !errors.Is(rmErr, outbox.ErrNotFound) {
+				b.logError("outbox_error", fields, start)
+				return
+			}
+			b.logError("pending_send_failed", fields, start)
+			return
+		}
+		if err := b.Outbox.Reschedule(entry.ID, time.Now().UTC().Add(outboxRetryDelay)); err != nil && !errors.Is(err, outbox.ErrNotFound) {
+			b.logError("outbox_error", fields, start)
+			return
+		}
+		b.logError("pending_send_retry", fields, start)
+		return
+	}
+	if err := b.Outbox.Remove(entry.ID); err != nil && !errors.Is(err, outbox.ErrNotFound) {
+		b.logError("outbox_error", fields, start)
+		return
+	}
+	b.logAllowed("pending_send_ok", fields, start)
+}
+
+// sendNotAttempted reports whether a failed send certainly did not reach
+// Google, so it can be retried without delivering the message twice. After
+// a timeout, a network error or an unknown failure it may have gone out.
+func sendNotAttempted(err error) bool {
+	if errors.Is(err, gog.ErrBusy) || errors.Is(err, gog.ErrUnavailable) {
+		return true
+	}
+	kind, _ := gog.ErrorKindOf(err)
+	return kind == gog.KindAuthExpired || kind == gog.KindRateLimited
+}
+
+func cloneParams(params map[string]interface{}) map[string]interface{} {
+	clone := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/outbox"
+	"gogcli-sandbox/internal/policy"
+)
+
+func TestDispatchPendingRetriesOnlyUnsentFailures(t *testing.T) {
+	pol := &policy.Policy{AllowedActions: []string{"gmail.send"}, Gmail: &policy.GmailPolicy{SendDelayMinutes: 5}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	store, err := outbox.Open(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var runErr error
+	runner := &fakeRunner{run: func(action string, params map[string]interface{}) (any, error) {
+		return nil, runErr
+	}}
+	b := &Broker{Policies: &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}}, RunnerProvider: runner, Outbox: store}
+	dispatch := func(err error) []outbox.Entry {
+		t.Helper()
+		runErr = err
+		runner.calls = 0
+		entry, addErr := store.Add(outbox.Entry{Account: "a@example.com", RequestID: "1", Params: map[string]interface{}{"to": "b@example.com", "body": "hi"}, SendAt: time.Now().UTC()})
+		if addErr != nil {
+			t.Fatalf("add: %v", addErr)
+		}
+		b.dispatchPending(context.Background(), entry)
+		if runner.calls != 1 {
+			t.Fatalf("expected a single attempt, got %d", runner.calls)
+		}
+		return store.List()
+	}
+
+	if left := dispatch(&gog.Error{Kind: gog.KindTimeout}); len(left) != 0 {
+		t.Fatalf("expected timed-out send to be dropped, got %+v", left)
+	}
+	if left := dispatch(gog.ErrQueueTimeout); len(left) != 1 || left[0].Attempts != 1 {
+		t.Fatalf("expected busy send to be rescheduled, got %+v", left)
+	}
+}
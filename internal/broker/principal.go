@@ -0,0 +1,55 @@
+package broker
+
+import "context"
+
+// Principal is an authenticated caller, such as a TLS client certificate or
+// a bearer token, whose scope is narrower than the account policies.
+// Requests without a principal get the full account policies. Allow, when
+// set, is asked once per handled request and rate limits the caller.
+type Principal struct {
+	Name     string
+	Accounts []string
+	Actions  []string
+	Allow    func() bool
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+func (p *Principal) AllowsAccount(account string) bool {
+	return p == nil || contains(p.Accounts, account)
+}
+
+func (p *Principal) AllowsAction(action string) bool {
+	return p == nil || len(p.Actions) == 0 || contains(p.Actions, action)
+}
+
+func (p *Principal) allow() bool {
+	return p == nil || p.Allow == nil || p.Allow()
+}
+
+// defaultAccount is the account to use when the request names none and the
+// principal can only use one.
+func (p *Principal) defaultAccount() string {
+	if p != nil && len(p.Accounts) == 1 {
+		return p.Accounts[0]
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/schema"
+	"gogcli-sandbox/internal/types"
+)
+
+// policySchema returns the params JSON Schema of every action the account's
+// policy allows, or of the single action named by params.action.
+func (b *Broker) policySchema(req *types.Request, account string, pol *policy.Policy, principal *Principal, params map[string]interface{}, warnings []string, fields map[string]any, start time.Time) *types.Response {
+	names := []string{}
+	for _, name := range pol.AllowedActions {
+		if principal.AllowsAction(name) {
+			names = append(names, name)
+		}
+	}
+	if only, _ := params["action"].(string); only != "" {
+		if !pol.IsActionAllowed(only) || !principal.AllowsAction(only) {
+			b.logDenied("action_denied", fields, start)
+			return &types.Response{ID: req.ID, Ok: false, Error: types.NewError("forbidden", "action not allowed", "")}
+		}
+		names = []string{only}
+	}
+	schemas := map[string]*schema.Schema{}
+	for _, name := range names {
+		if spec, ok := actions.Lookup(name); ok {
+			schemas[name] = spec.Schema(name)
+		}
+	}
+	resp := &types.Response{ID: req.ID, Ok: true, Data: map[string]any{
+		"account": account,
+		"schemas": schemas,
+	}}
+	if len(warnings) > 0 {
+		resp.Warnings = warnings
+	}
+	b.logAllowed("request_ok", fields, start)
+	return resp
+}
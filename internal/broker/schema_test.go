@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/schema"
+	"gogcli-sandbox/internal/types"
+)
+
+func TestHandleRejectsInvalidParamsBeforeRewrite(t *testing.T) {
+	pol := &policy.Policy{AllowedActions: []string{"calendar.events", "policy.schema"}, Calendar: &policy.CalendarPolicy{}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	runner := &fakeRunner{}
+	b := &Broker{
+		Policies:       &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}},
+		RunnerProvider: runner,
+	}
+	ctx := context.Background()
+
+	resp := b.Handle(ctx, &types.Request{ID: "1", Action: "calendar.events", Account: "a@example.com", Params: map[string]interface{}{
+		"calendar_id": "primary",
+		"max":         float64(1000),
+	}})
+	if resp.Ok || resp.Error == nil || resp.Error.Code != "bad_request" || resp.Error.Message != "params.max: must be <= 500" {
+		t.Fatalf("expected bad_request naming params.max, got %+v", resp.Error)
+	}
+	if calls := atomic.LoadInt32(&runner.calls); calls != 0 {
+		t.Fatalf("runner should not be called, got %d calls", calls)
+	}
+
+	resp = b.Handle(ctx, &types.Request{ID: "2", Action: "policy.schema", Account: "a@example.com"})
+	if !resp.Ok {
+		t.Fatalf("policy.schema failed: %+v", resp.Error)
+	}
+	schemas := resp.Data.(map[string]any)["schemas"].(map[string]*schema.Schema)
+	events, ok := schemas["calendar.events"]
+	if !ok || events.Properties["max"] == nil || len(events.Required) != 1 || events.Required[0] != "calendar_id" {
+		t.Fatalf("unexpected calendar.events schema: %+v", events)
+	}
+
+	resp = b.Handle(ctx, &types.Request{ID: "3", Action: "policy.schema", Account: "a@example.com", Params: map[string]interface{}{"action": "gmail.send"}})
+	if resp.Ok || resp.Error.Code != "forbidden" {
+		t.Fatalf("expected forbidden for a disallowed action, got %+v", resp)
+	}
+}
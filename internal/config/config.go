@@ -3,32 +3,94 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"regexp"
 	"time"
 )
 
+var versionRe = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
 type Config struct {
-	ConfigPath string
-	SocketPath string
-	PolicyPath string
-	GogPath    string
-	GogAccount string
-	Timeout    time.Duration
-	LogJSON    bool
-	Verbose    bool
+	ConfigPath      string
+	SocketPath      string
+	PolicyPath      string
+	GogPath         string
+	GogAccount      string
+	Timeout         time.Duration
+	LogJSON         bool
+	Verbose         bool
+	OutboxPath      string
+	ListOutbox      bool
+	LabelCacheTTL   time.Duration
+	CacheTTLs       map[string]time.Duration
+	CacheMaxEntries int
+	MaxInFlight     int
+	MaxPerAccount   int
+	QueueSize       int
+	QueueTimeout    time.Duration
+	RetryAttempts   int
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	GogWorkDir      string
+	GogMaxOutput    int
+	GogEnv          []string
+	GogSandbox      *SandboxConfig
+	Runner          string
+	API             *APIConfig
+	ActionsPath     string
+	GogCheck        string
+	GogMinVersion   string
+	GogMaxVersion   string
+	BatchMaxItems   int
+	BatchParallel   int
+	BatchTimeout    time.Duration
+	IterateTimeout  time.Duration
+	CursorKeyPath   string
+	CursorTTL       time.Duration
+	MetricsListen   string
+	TraceEndpoint   string
+	TraceFile       string
+	TLSListen       string
+	TLSCert         string
+	TLSKey          string
+	TLSClientCA     string
+	TLSRevoked      string
+	TokensPath      string
+	AdminSocket     string
+	LockdownFile    string
 }
 
 func Load() (*Config, error) {
 	defaultPolicyPath, _ := DefaultPolicyPath()
 	defaultConfigPath, _ := DefaultConfigPath()
+	defaultOutboxPath, _ := DefaultOutboxPath()
 
 	cfg := &Config{
-		ConfigPath: defaultConfigPath,
-		SocketPath: defaultSocketPath,
-		PolicyPath: defaultPolicyPath,
-		GogPath:    "gog",
-		Timeout:    30 * time.Second,
-		LogJSON:    true,
-		Verbose:    false,
+		ConfigPath:      defaultConfigPath,
+		SocketPath:      defaultSocketPath,
+		PolicyPath:      defaultPolicyPath,
+		GogPath:         "gog",
+		Timeout:         30 * time.Second,
+		LogJSON:         true,
+		Verbose:         false,
+		OutboxPath:      defaultOutboxPath,
+		LabelCacheTTL:   10 * time.Minute,
+		MaxInFlight:     4,
+		MaxPerAccount:   2,
+		QueueSize:       32,
+		QueueTimeout:    10 * time.Second,
+		RetryAttempts:   3,
+		BreakerFailures: 3,
+		BreakerCooldown: 30 * time.Second,
+		Runner:          "gog",
+		GogCheck:        "warn",
+		GogMinVersion:   "0.4.0",
+		GogMaxVersion:   "1.0.0",
+		BatchMaxItems:   20,
+		BatchParallel:   4,
+		BatchTimeout:    25 * time.Second,
+		IterateTimeout:  2 * time.Minute,
+		CursorTTL:       time.Hour,
 	}
 
 	flag.StringVar(&cfg.ConfigPath, "config", defaultConfigPath, "config file path (default: $XDG_CONFIG_HOME/gogcli-sandbox/config.json)")
@@ -39,6 +101,41 @@ func Load() (*Config, error) {
 	flag.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "gog execution timeout")
 	flag.BoolVar(&cfg.LogJSON, "log-json", cfg.LogJSON, "emit JSON logs")
 	flag.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "verbose logging (safe metadata only)")
+	flag.StringVar(&cfg.OutboxPath, "outbox", cfg.OutboxPath, "delayed send queue path (default: $XDG_CONFIG_HOME/gogcli-sandbox/outbox.json)")
+	flag.BoolVar(&cfg.ListOutbox, "list-outbox", false, "print pending delayed sends and exit")
+	flag.IntVar(&cfg.CacheMaxEntries, "cache-max-entries", cfg.CacheMaxEntries, "max cached gog responses (0: default)")
+	flag.DurationVar(&cfg.LabelCacheTTL, "label-cache-ttl", cfg.LabelCacheTTL, "how long resolved Gmail label ids are reused")
+	flag.IntVar(&cfg.MaxInFlight, "max-in-flight", cfg.MaxInFlight, "max concurrent gog processes (0: unlimited)")
+	flag.IntVar(&cfg.MaxPerAccount, "max-in-flight-per-account", cfg.MaxPerAccount, "max concurrent gog processes per account (0: unlimited)")
+	flag.IntVar(&cfg.QueueSize, "queue-size", cfg.QueueSize, "max requests waiting for a gog slot before returning busy")
+	flag.DurationVar(&cfg.QueueTimeout, "queue-timeout", cfg.QueueTimeout, "max time a request waits for a gog slot")
+	flag.IntVar(&cfg.RetryAttempts, "retry-attempts", cfg.RetryAttempts, "attempts for read-only gog calls that fail transiently (1: no retry)")
+	flag.IntVar(&cfg.BreakerFailures, "breaker-failures", cfg.BreakerFailures, "consecutive auth or network failures before an account's gog calls are short-circuited")
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", cfg.BreakerCooldown, "how long an account stays short-circuited before gog is probed again")
+	flag.StringVar(&cfg.GogWorkDir, "gog-workdir", cfg.GogWorkDir, "working directory for gog (default: system temp dir)")
+	flag.IntVar(&cfg.GogMaxOutput, "gog-max-output-bytes", cfg.GogMaxOutput, "max gog stdout size in bytes (0: 16 MiB)")
+	flag.StringVar(&cfg.Runner, "runner", cfg.Runner, "how actions are executed: gog (subprocess) or api (Google REST APIs)")
+	flag.StringVar(&cfg.ActionsPath, "actions", cfg.ActionsPath, "extra action spec file merged over the built-in actions (optional)")
+	flag.StringVar(&cfg.GogCheck, "gog-check", cfg.GogCheck, "gog version/flag check at startup: strict (refuse to start), warn (disable mismatched actions) or off")
+	flag.StringVar(&cfg.GogMinVersion, "gog-min-version", cfg.GogMinVersion, "oldest supported gog version")
+	flag.StringVar(&cfg.GogMaxVersion, "gog-max-version", cfg.GogMaxVersion, "first unsupported gog version")
+	flag.IntVar(&cfg.BatchMaxItems, "batch-max-items", cfg.BatchMaxItems, "max requests in one /v1/batch call")
+	flag.IntVar(&cfg.BatchParallel, "batch-parallelism", cfg.BatchParallel, "max batch items handled at once")
+	flag.DurationVar(&cfg.BatchTimeout, "batch-timeout", cfg.BatchTimeout, "total time budget for one /v1/batch call")
+	flag.DurationVar(&cfg.IterateTimeout, "iterate-timeout", cfg.IterateTimeout, "total time budget for one /v1/iterate call")
+	flag.StringVar(&cfg.CursorKeyPath, "cursor-key-file", cfg.CursorKeyPath, "file with the key for page and iterate cursors (default: random key per start)")
+	flag.DurationVar(&cfg.CursorTTL, "cursor-ttl", cfg.CursorTTL, "how long page cursors stay valid")
+	flag.StringVar(&cfg.MetricsListen, "metrics-listen", cfg.MetricsListen, "extra TCP address serving /metrics, e.g. 127.0.0.1:9464 (optional)")
+	flag.StringVar(&cfg.TraceEndpoint, "trace-endpoint", cfg.TraceEndpoint, "OTLP/HTTP collector URL for trace export, e.g. http://127.0.0.1:4318 (optional)")
+	flag.StringVar(&cfg.TraceFile, "trace-file", cfg.TraceFile, "append trace spans as OTLP JSON lines to this file (optional)")
+	flag.StringVar(&cfg.TLSListen, "tls-listen", cfg.TLSListen, "TCP address for the mutual-TLS agent API, e.g. 0.0.0.0:8443 (optional)")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "server certificate PEM for --tls-listen")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "server private key PEM for --tls-listen")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "CA bundle PEM that client certificates must chain to")
+	flag.StringVar(&cfg.TLSRevoked, "tls-revoked-file", cfg.TLSRevoked, "file of revoked client certificate SHA-256 fingerprints (optional)")
+	flag.StringVar(&cfg.TokensPath, "token-file", cfg.TokensPath, "require bearer tokens on the unix socket, checked against this token file (optional)")
+	flag.StringVar(&cfg.AdminSocket, "admin-socket", cfg.AdminSocket, "operator unix socket for introspection and runtime controls, mode 0600 (optional)")
+	flag.StringVar(&cfg.LockdownFile, "lockdown-file", cfg.LockdownFile, "sentinel file: while it exists, write actions are denied (empty file: all accounts; else one account per line)")
 	flag.Parse()
 
 	explicit := map[string]bool{}
@@ -76,8 +173,187 @@ func Load() (*Config, error) {
 		if !explicit["verbose"] && fileCfg.Verbose != nil {
 			cfg.Verbose = *fileCfg.Verbose
 		}
+		if !explicit["outbox"] && fileCfg.Outbox != "" {
+			cfg.OutboxPath = fileCfg.Outbox
+		}
+		if fileCfg.CacheTTLs != nil {
+			cfg.CacheTTLs = map[string]time.Duration{}
+			for action, raw := range fileCfg.CacheTTLs {
+				parsed, err := time.ParseDuration(raw)
+				if err != nil {
+					return nil, fmt.Errorf("cache_ttls.%s: %w", action, err)
+				}
+				cfg.CacheTTLs[action] = parsed
+			}
+		}
+		if !explicit["cache-max-entries"] && fileCfg.CacheMaxEntries > 0 {
+			cfg.CacheMaxEntries = fileCfg.CacheMaxEntries
+		}
+		if !explicit["label-cache-ttl"] && fileCfg.LabelTTL != "" {
+			parsed, err := time.ParseDuration(fileCfg.LabelTTL)
+			if err != nil {
+				return nil, err
+			}
+			cfg.LabelCacheTTL = parsed
+		}
+		if !explicit["max-in-flight"] && fileCfg.MaxInFlight > 0 {
+			cfg.MaxInFlight = fileCfg.MaxInFlight
+		}
+		if !explicit["max-in-flight-per-account"] && fileCfg.MaxPerAccount > 0 {
+			cfg.MaxPerAccount = fileCfg.MaxPerAccount
+		}
+		if !explicit["queue-size"] && fileCfg.QueueSize != nil {
+			cfg.QueueSize = *fileCfg.QueueSize
+		}
+		if !explicit["queue-timeout"] && fileCfg.QueueTimeout != "" {
+			parsed, err := time.ParseDuration(fileCfg.QueueTimeout)
+			if err != nil {
+				return nil, err
+			}
+			cfg.QueueTimeout = parsed
+		}
+		if !explicit["retry-attempts"] && fileCfg.RetryAttempts > 0 {
+			cfg.RetryAttempts = fileCfg.RetryAttempts
+		}
+		if !explicit["breaker-failures"] && fileCfg.BreakerFailures > 0 {
+			cfg.BreakerFailures = fileCfg.BreakerFailures
+		}
+		if !explicit["breaker-cooldown"] && fileCfg.BreakerCooldown != "" {
+			parsed, err := time.ParseDuration(fileCfg.BreakerCooldown)
+			if err != nil {
+				return nil, err
+			}
+			cfg.BreakerCooldown = parsed
+		}
+		if !explicit["gog-workdir"] && fileCfg.GogWorkDir != "" {
+			cfg.GogWorkDir = fileCfg.GogWorkDir
+		}
+		if !explicit["gog-max-output-bytes"] && fileCfg.GogMaxOutput > 0 {
+			cfg.GogMaxOutput = fileCfg.GogMaxOutput
+		}
+		cfg.GogEnv = fileCfg.GogEnv
+		cfg.GogSandbox = fileCfg.GogSandbox
+		if !explicit["runner"] && fileCfg.Runner != "" {
+			cfg.Runner = fileCfg.Runner
+		}
+		cfg.API = fileCfg.API
+		if !explicit["actions"] && fileCfg.Actions != "" {
+			cfg.ActionsPath = fileCfg.Actions
+		}
+		if !explicit["gog-check"] && fileCfg.GogCheck != "" {
+			cfg.GogCheck = fileCfg.GogCheck
+		}
+		if !explicit["gog-min-version"] && fileCfg.GogMinVersion != "" {
+			cfg.GogMinVersion = fileCfg.GogMinVersion
+		}
+		if !explicit["gog-max-version"] && fileCfg.GogMaxVersion != "" {
+			cfg.GogMaxVersion = fileCfg.GogMaxVersion
+		}
+		if !explicit["batch-max-items"] && fileCfg.BatchMaxItems > 0 {
+			cfg.BatchMaxItems = fileCfg.BatchMaxItems
+		}
+		if !explicit["batch-parallelism"] && fileCfg.BatchParallel > 0 {
+			cfg.BatchParallel = fileCfg.BatchParallel
+		}
+		if !explicit["batch-timeout"] && fileCfg.BatchTimeout != "" {
+			parsed, err := time.ParseDuration(fileCfg.BatchTimeout)
+			if err != nil {
+				return nil, err
+			}
+			cfg.BatchTimeout = parsed
+		}
+		if !explicit["iterate-timeout"] && fileCfg.IterateTimeout != "" {
+			parsed, err := time.ParseDuration(fileCfg.IterateTimeout)
+			if err != nil {
+				return nil, err
+			}
+			cfg.IterateTimeout = parsed
+		}
+		if !explicit["cursor-key-file"] && fileCfg.CursorKeyFile != "" {
+			cfg.CursorKeyPath = fileCfg.CursorKeyFile
+		}
+		if !explicit["cursor-ttl"] && fileCfg.CursorTTL != "" {
+			parsed, err := time.ParseDuration(fileCfg.CursorTTL)
+			if err != nil {
+				return nil, err
+			}
+			cfg.CursorTTL = parsed
+		}
+		if !explicit["metrics-listen"] && fileCfg.MetricsListen != "" {
+			cfg.MetricsListen = fileCfg.MetricsListen
+		}
+		if !explicit["trace-endpoint"] && fileCfg.TraceEndpoint != "" {
+			cfg.TraceEndpoint = fileCfg.TraceEndpoint
+		}
+		if !explicit["trace-file"] && fileCfg.TraceFile != "" {
+			cfg.TraceFile = fileCfg.TraceFile
+		}
+		if !explicit["tls-listen"] && fileCfg.TLSListen != "" {
+			cfg.TLSListen = fileCfg.TLSListen
+		}
+		if !explicit["tls-cert"] && fileCfg.TLSCert != "" {
+			cfg.TLSCert = fileCfg.TLSCert
+		}
+		if !explicit["tls-key"] && fileCfg.TLSKey != "" {
+			cfg.TLSKey = fileCfg.TLSKey
+		}
+		if !explicit["tls-client-ca"] && fileCfg.TLSClientCA != "" {
+			cfg.TLSClientCA = fileCfg.TLSClientCA
+		}
+		if !explicit["tls-revoked-file"] && fileCfg.TLSRevoked != "" {
+			cfg.TLSRevoked = fileCfg.TLSRevoked
+		}
+		if !explicit["token-file"] && fileCfg.TokenFile != "" {
+			cfg.TokensPath = fileCfg.TokenFile
+		}
+		if !explicit["admin-socket"] && fileCfg.AdminSocket != "" {
+			cfg.AdminSocket = fileCfg.AdminSocket
+		}
+		if !explicit["lockdown-file"] && fileCfg.LockdownFile != "" {
+			cfg.LockdownFile = fileCfg.LockdownFile
+		}
 	}
 
+	if cfg.MaxInFlight < 0 || cfg.MaxPerAccount < 0 || cfg.QueueSize < 0 || cfg.RetryAttempts < 1 {
+		return nil, errors.New("concurrency limits must not be negative and retry attempts must be at least 1")
+	}
+	if cfg.BatchMaxItems < 1 || cfg.BatchParallel < 1 || cfg.BatchTimeout <= 0 {
+		return nil, errors.New("batch limits must be positive")
+	}
+	if cfg.IterateTimeout <= 0 {
+		return nil, errors.New("iterate timeout must be positive")
+	}
+	if cfg.CursorTTL <= 0 {
+		return nil, errors.New("cursor ttl must be positive")
+	}
+	if cfg.TraceEndpoint != "" && cfg.TraceFile != "" {
+		return nil, errors.New("set at most one of trace endpoint and trace file")
+	}
+	if cfg.AdminSocket != "" && cfg.AdminSocket == cfg.SocketPath {
+		return nil, errors.New("admin socket must differ from the agent socket")
+	}
+	if cfg.TLSListen != "" && (cfg.TLSCert == "" || cfg.TLSKey == "" || cfg.TLSClientCA == "") {
+		return nil, errors.New("tls listen requires tls cert, tls key and tls client ca")
+	}
+	switch cfg.Runner {
+	case "gog":
+	case "api":
+		if cfg.API == nil || cfg.API.TokenFile == "" {
+			return nil, errors.New("runner api requires api.token_file in the config file")
+		}
+	default:
+		return nil, fmt.Errorf("unknown runner %q (want gog or api)", cfg.Runner)
+	}
+	switch cfg.GogCheck {
+	case "strict", "warn", "off":
+	default:
+		return nil, fmt.Errorf("unknown gog_check %q (want strict, warn or off)", cfg.GogCheck)
+	}
+	for _, v := range []string{cfg.GogMinVersion, cfg.GogMaxVersion} {
+		if v != "" && !versionRe.MatchString(v) {
+			return nil, fmt.Errorf("invalid gog version %q (want major.minor.patch)", v)
+		}
+	}
 	if cfg.PolicyPath == "" {
 		return nil, errors.New("policy path is required (set --policy or config file)")
 	}
@@ -9,13 +9,69 @@ import (
 )
 
 type FileConfig struct {
-	Socket     string `json:"socket"`
-	Policy     string `json:"policy"`
-	GogPath    string `json:"gog_path"`
-	GogAccount string `json:"gog_account"`
-	Timeout    string `json:"timeout"`
-	LogJSON    *bool  `json:"log_json"`
-	Verbose    *bool  `json:"verbose"`
+	Socket          string            `json:"socket"`
+	Policy          string            `json:"policy"`
+	GogPath         string            `json:"gog_path"`
+	GogAccount      string            `json:"gog_account"`
+	Timeout         string            `json:"timeout"`
+	LogJSON         *bool             `json:"log_json"`
+	Verbose         *bool             `json:"verbose"`
+	Outbox          string            `json:"outbox,omitempty"`
+	LabelTTL        string            `json:"label_cache_ttl,omitempty"`
+	CacheTTLs       map[string]string `json:"cache_ttls,omitempty"`
+	CacheMaxEntries int               `json:"cache_max_entries,omitempty"`
+	MaxInFlight     int               `json:"max_in_flight,omitempty"`
+	MaxPerAccount   int               `json:"max_in_flight_per_account,omitempty"`
+	QueueSize       *int              `json:"queue_size,omitempty"`
+	QueueTimeout    string            `json:"queue_timeout,omitempty"`
+	RetryAttempts   int               `json:"retry_attempts,omitempty"`
+	BreakerFailures int               `json:"breaker_failures,omitempty"`
+	BreakerCooldown string            `json:"breaker_cooldown,omitempty"`
+	GogWorkDir      string            `json:"gog_workdir,omitempty"`
+	GogMaxOutput    int               `json:"gog_max_output_bytes,omitempty"`
+	GogEnv          []string          `json:"gog_env,omitempty"`
+	GogSandbox      *SandboxConfig    `json:"gog_sandbox,omitempty"`
+	Runner          string            `json:"runner,omitempty"`
+	API             *APIConfig        `json:"api,omitempty"`
+	Actions         string            `json:"actions_file,omitempty"`
+	GogCheck        string            `json:"gog_check,omitempty"`
+	GogMinVersion   string            `json:"gog_min_version,omitempty"`
+	GogMaxVersion   string            `json:"gog_max_version,omitempty"`
+	BatchMaxItems   int               `json:"batch_max_items,omitempty"`
+	BatchParallel   int               `json:"batch_parallelism,omitempty"`
+	BatchTimeout    string            `json:"batch_timeout,omitempty"`
+	IterateTimeout  string            `json:"iterate_timeout,omitempty"`
+	CursorKeyFile   string            `json:"cursor_key_file,omitempty"`
+	CursorTTL       string            `json:"cursor_ttl,omitempty"`
+	MetricsListen   string            `json:"metrics_listen,omitempty"`
+	TraceEndpoint   string            `json:"trace_endpoint,omitempty"`
+	TraceFile       string            `json:"trace_file,omitempty"`
+	TLSListen       string            `json:"tls_listen,omitempty"`
+	TLSCert         string            `json:"tls_cert,omitempty"`
+	TLSKey          string            `json:"tls_key,omitempty"`
+	TLSClientCA     string            `json:"tls_client_ca,omitempty"`
+	TLSRevoked      string            `json:"tls_revoked_file,omitempty"`
+	TokenFile       string            `json:"token_file,omitempty"`
+	AdminSocket     string            `json:"admin_socket,omitempty"`
+	LockdownFile    string            `json:"lockdown_file,omitempty"`
+}
+
+type APIConfig struct {
+	TokenFile       string `json:"token_file"`
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	TokenURL        string `json:"token_url,omitempty"`
+	GmailURL        string `json:"gmail_url,omitempty"`
+	CalendarURL     string `json:"calendar_url,omitempty"`
+	AttachmentDir   string `json:"attachment_dir,omitempty"`
+}
+
+type SandboxConfig struct {
+	CPUSeconds    uint64   `json:"cpu_seconds,omitempty"`
+	MemoryMB      uint64   `json:"memory_mb,omitempty"`
+	FileSizeMB    uint64   `json:"file_size_mb,omitempty"`
+	OpenFiles     uint64   `json:"open_files,omitempty"`
+	Landlock      bool     `json:"landlock,omitempty"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
 }
 
 func DefaultFileConfig() FileConfig {
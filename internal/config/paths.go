@@ -10,6 +10,8 @@ const (
 	appConfigDirName  = "gogcli-sandbox"
 	policyFileName    = "policy.json"
 	configFileName    = "config.json"
+	outboxFileName    = "outbox.json"
+	tokensFileName    = "tokens.json"
 	defaultSocketPath = "/run/gogcli-sandbox.sock"
 )
 
@@ -40,6 +42,22 @@ func DefaultConfigPath() (string, error) {
 	return filepath.Join(dir, configFileName), nil
 }
 
+func DefaultOutboxPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, outboxFileName), nil
+}
+
+func DefaultTokensPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokensFileName), nil
+}
+
 func EnsurePolicyDir(path string) error {
 	if path == "" {
 		return errors.New("policy path is empty")
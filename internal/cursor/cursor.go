@@ -0,0 +1,73 @@
+package cursor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalid = errors.New("invalid cursor")
+
+// Sealer issues opaque cursors: the JSON payload encrypted and authenticated
+// with AES-256-GCM, base64url encoded. Agents can neither read a cursor nor
+// forge or alter one. Each cursor is sealed for a kind, and only opens as
+// that kind, so cursors of one use cannot be passed off as another.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer derives the cipher key from key, or uses a random key when key
+// is empty (cursors then stop opening when the broker restarts).
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("gogcli-sandbox cursor"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+func (s *Sealer) Seal(kind string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, data, []byte(kind))), nil
+}
+
+// Open decrypts a cursor sealed for kind and decodes the payload into out.
+func (s *Sealer) Open(kind, token string, out any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return ErrInvalid
+	}
+	nonce, sealed := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, sealed, []byte(kind))
+	if err != nil {
+		return ErrInvalid
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return ErrInvalid
+	}
+	return nil
+}
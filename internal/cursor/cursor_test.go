@@ -0,0 +1,45 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	Action string `json:"a"`
+	Token  string `json:"t"`
+}
+
+func TestSealOpen(t *testing.T) {
+	s, err := NewSealer(nil)
+	if err != nil {
+		t.Fatalf("sealer: %v", err)
+	}
+	token, err := s.Seal("page", payload{Action: "gmail.search", Token: "page-2"})
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	if strings.Contains(token, "page-2") || strings.Contains(string(raw), "page-2") {
+		t.Fatalf("cursor leaks the page token: %s", token)
+	}
+	var got payload
+	if err := s.Open("page", token, &got); err != nil || got.Token != "page-2" || got.Action != "gmail.search" {
+		t.Fatalf("open: %+v (%v)", got, err)
+	}
+
+	other, _ := NewSealer([]byte("other key"))
+	for _, bad := range []string{"", "abc", token[:len(token)-2] + "xx", "x" + token} {
+		if err := s.Open("page", bad, &got); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%q: expected ErrInvalid, got %v", bad, err)
+		}
+	}
+	if err := other.Open("page", token, &got); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected a different key to reject the cursor, got %v", err)
+	}
+	if err := s.Open("iterate", token, &got); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected a different kind to reject the cursor, got %v", err)
+	}
+}
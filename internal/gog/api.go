@@ -0,0 +1,660 @@
+package gog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+)
+
+const (
+	DefaultGmailURL    = "https://gmail.googleapis.com/gmail/v1/users/me"
+	DefaultCalendarURL = "https://www.googleapis.com/calendar/v3"
+)
+
+// APIFactory builds runners that call the Gmail and Calendar REST APIs
+// directly instead of spawning gog. TokenFile may contain "{account}".
+type APIFactory struct {
+	DefaultAccount  string
+	TokenFile       string
+	CredentialsFile string
+	TokenURL        string
+	GmailURL        string
+	CalendarURL     string
+	Timeout         time.Duration
+	MaxOutputBytes  int
+	AttachmentDir   string
+	Client          *http.Client
+
+	mu      sync.Mutex
+	sources map[string]*FileTokenSource
+}
+
+func (f *APIFactory) RunnerFor(account string) Runner {
+	resolved := strings.TrimSpace(account)
+	if resolved == "" {
+		resolved = strings.TrimSpace(f.DefaultAccount)
+	}
+	f.mu.Lock()
+	if f.sources == nil {
+		f.sources = map[string]*FileTokenSource{}
+	}
+	source, ok := f.sources[resolved]
+	if !ok {
+		source = &FileTokenSource{
+			Path:            strings.ReplaceAll(f.TokenFile, "{account}", resolved),
+			CredentialsPath: f.CredentialsFile,
+			TokenURL:        f.TokenURL,
+			Client:          f.Client,
+		}
+		f.sources[resolved] = source
+	}
+	f.mu.Unlock()
+	return &APIRunner{
+		Account:        resolved,
+		Tokens:         source,
+		Client:         f.Client,
+		GmailURL:       f.GmailURL,
+		CalendarURL:    f.CalendarURL,
+		Timeout:        f.Timeout,
+		MaxOutputBytes: f.MaxOutputBytes,
+		AttachmentDir:  f.AttachmentDir,
+	}
+}
+
+type APIRunner struct {
+	Account        string
+	Tokens         TokenSource
+	Client         *http.Client
+	GmailURL       string
+	CalendarURL    string
+	Timeout        time.Duration
+	MaxOutputBytes int
+	// AttachmentDir is the only directory attachments may be read from;
+	// empty disables attachments.
+	AttachmentDir string
+}
+
+type apiAction func(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error)
+
+var apiActions = map[string]apiAction{
+	"gmail.search":        apiGmailSearch,
+	"gmail.thread.list":   apiGmailSearch,
+	"gmail.thread.get":    apiGmailThreadGet,
+	"gmail.thread.modify": apiGmailThreadModify,
+	"gmail.get":           apiGmailGet,
+	"gmail.send":          apiGmailSend,
+	"gmail.drafts.create": apiGmailDraftCreate,
+	"gmail.labels.list":   apiGmailLabelsList,
+	"gmail.labels.get":    apiGmailLabelsGet,
+	"gmail.labels.modify": apiGmailLabelsModify,
+	"calendar.list":       apiCalendarList,
+	"calendar.events":     apiCalendarEvents,
+	"calendar.freebusy":   apiCalendarFreeBusy,
+}
+
+func (a *APIRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	spec, ok := actions.Lookup(action)
+	if !ok || len(spec.Command) == 0 {
+		return nil, fmt.Errorf("no command mapping for action: %s", action)
+	}
+	handler, ok := apiActions[action]
+	if !ok {
+		return nil, fmt.Errorf("action not supported by the api runner: %s", action)
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if _, err := buildArgs(spec, params); err != nil {
+		return nil, err
+	}
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+	return handler(a, ctx, params)
+}
+
+func (a *APIRunner) gmail(path string) string {
+	base := a.GmailURL
+	if base == "" {
+		base = DefaultGmailURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+func (a *APIRunner) calendar(path string) string {
+	base := a.CalendarURL
+	if base == "" {
+		base = DefaultCalendarURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+func (a *APIRunner) call(ctx context.Context, method, endpoint string, body any, out any) error {
+	token, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return classifyTransport(ctx, err)
+	}
+	defer resp.Body.Close()
+	limit := a.MaxOutputBytes
+	if limit <= 0 {
+		limit = DefaultMaxOutputBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return classifyTransport(ctx, err)
+	}
+	if len(data) > limit {
+		return &Error{Kind: KindOutputTooLarge}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Error{Kind: classifyStatus(resp.StatusCode, data), ExitCode: resp.StatusCode, err: errors.New(resp.Status)}
+	}
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &Error{Kind: KindFailed, err: fmt.Errorf("invalid api json: %w", err)}
+	}
+	return nil
+}
+
+func classifyStatus(status int, body []byte) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized:
+		return KindAuthExpired
+	case status == http.StatusTooManyRequests:
+		return KindRateLimited
+	case status == http.StatusForbidden:
+		if classifyStderr(string(body)) == KindRateLimited {
+			return KindRateLimited
+		}
+		return KindPermissionDenied
+	case status == http.StatusNotFound:
+		return KindNotFound
+	case status >= 500:
+		return KindNetwork
+	default:
+		return KindFailed
+	}
+}
+
+func classifyTransport(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &Error{Kind: KindTimeout, err: err}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &Error{Kind: KindNetwork, err: err}
+}
+
+func apiGmailSearch(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	query := url.Values{"q": {paramString(params, "query", " ")}}
+	if max := paramString(params, "max", ""); max != "" {
+		query.Set("maxResults", max)
+	}
+	if page := paramString(params, "page", ""); page != "" {
+		query.Set("pageToken", page)
+	}
+	var list struct {
+		Threads []struct {
+			ID string `json:"id"`
+		} `json:"threads"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+	if err := a.call(ctx, http.MethodGet, a.gmail("/threads?"+query.Encode()), nil, &list); err != nil {
+		return nil, err
+	}
+	oldest, _ := params["oldest"].(bool)
+	threads := make([]interface{}, 0, len(list.Threads))
+	for _, item := range list.Threads {
+		var thread map[string]interface{}
+		endpoint := a.gmail("/threads/" + url.PathEscape(item.ID) + "?format=metadata&metadataHeaders=From&metadataHeaders=Subject&metadataHeaders=Date")
+		if err := a.call(ctx, http.MethodGet, endpoint, nil, &thread); err != nil {
+			return nil, err
+		}
+		threads = append(threads, summarizeThread(thread, oldest))
+	}
+	out := map[string]interface{}{"threads": threads}
+	if list.NextPageToken != "" {
+		out["nextPageToken"] = list.NextPageToken
+	}
+	return out, nil
+}
+
+func summarizeThread(thread map[string]interface{}, oldest bool) map[string]interface{} {
+	messages, _ := thread["messages"].([]interface{})
+	summary := map[string]interface{}{
+		"id":           thread["id"],
+		"messageCount": len(messages),
+	}
+	if snippet, ok := thread["snippet"].(string); ok {
+		summary["snippet"] = snippet
+	}
+	labelIDs := []interface{}{}
+	seen := map[string]struct{}{}
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		ids, _ := msg["labelIds"].([]interface{})
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				if _, dup := seen[s]; !dup {
+					seen[s] = struct{}{}
+					labelIDs = append(labelIDs, s)
+				}
+			}
+		}
+	}
+	summary["labelIds"] = labelIDs
+	if len(messages) == 0 {
+		return summary
+	}
+	pick := messages[len(messages)-1]
+	if oldest {
+		pick = messages[0]
+	}
+	msg, _ := pick.(map[string]interface{})
+	headers := messageHeaders(msg)
+	summary["from"] = headers["from"]
+	summary["subject"] = headers["subject"]
+	summary["date"] = headers["date"]
+	return summary
+}
+
+func messageHeaders(msg map[string]interface{}) map[string]string {
+	out := map[string]string{}
+	payload, _ := msg["payload"].(map[string]interface{})
+	headers, _ := payload["headers"].([]interface{})
+	for _, raw := range headers {
+		h, _ := raw.(map[string]interface{})
+		name, _ := h["name"].(string)
+		value, _ := h["value"].(string)
+		if name != "" {
+			out[strings.ToLower(name)] = value
+		}
+	}
+	return out
+}
+
+func apiGmailThreadGet(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	var thread map[string]interface{}
+	endpoint := a.gmail("/threads/" + url.PathEscape(paramString(params, "thread_id", "")) + "?format=full")
+	if err := a.call(ctx, http.MethodGet, endpoint, nil, &thread); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"thread": thread}, nil
+}
+
+func apiGmailGet(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	query := url.Values{}
+	format := paramString(params, "format", "")
+	if format == "" {
+		format = "full"
+	}
+	query.Set("format", format)
+	for _, header := range splitList(paramString(params, "headers", ",")) {
+		query.Add("metadataHeaders", header)
+	}
+	var msg map[string]interface{}
+	endpoint := a.gmail("/messages/" + url.PathEscape(paramString(params, "message_id", "")) + "?" + query.Encode())
+	if err := a.call(ctx, http.MethodGet, endpoint, nil, &msg); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"message": msg}, nil
+}
+
+func apiGmailLabelsList(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	var labels map[string]interface{}
+	if err := a.call(ctx, http.MethodGet, a.gmail("/labels"), nil, &labels); err != nil {
+		return nil, err
+	}
+	if _, ok := labels["labels"]; !ok {
+		labels["labels"] = []interface{}{}
+	}
+	return labels, nil
+}
+
+func apiGmailLabelsGet(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	ids, err := a.resolveLabelIDs(ctx, paramString(params, "label", ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != 1 {
+		return nil, errors.New("exactly one label is required")
+	}
+	var label map[string]interface{}
+	if err := a.call(ctx, http.MethodGet, a.gmail("/labels/"+url.PathEscape(ids[0])), nil, &label); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"label": label}, nil
+}
+
+func apiGmailThreadModify(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	body, err := a.labelModifyBody(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	var thread map[string]interface{}
+	endpoint := a.gmail("/threads/" + url.PathEscape(paramString(params, "thread_id", "")) + "/modify")
+	if err := a.call(ctx, http.MethodPost, endpoint, body, &thread); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"thread": thread}, nil
+}
+
+func apiGmailLabelsModify(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	body, err := a.labelModifyBody(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	threads := []interface{}{}
+	for _, id := range splitList(paramString(params, "thread_ids", ",")) {
+		var thread map[string]interface{}
+		if err := a.call(ctx, http.MethodPost, a.gmail("/threads/"+url.PathEscape(id)+"/modify"), body, &thread); err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+	return map[string]interface{}{"threads": threads}, nil
+}
+
+func (a *APIRunner) labelModifyBody(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	add, err := a.resolveLabelIDs(ctx, paramString(params, "add", ","))
+	if err != nil {
+		return nil, err
+	}
+	remove, err := a.resolveLabelIDs(ctx, paramString(params, "remove", ","))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"addLabelIds": add, "removeLabelIds": remove}, nil
+}
+
+// resolveLabelIDs accepts label ids or names, like gog does.
+func (a *APIRunner) resolveLabelIDs(ctx context.Context, raw string) ([]string, error) {
+	wanted := splitList(raw)
+	if len(wanted) == 0 {
+		return []string{}, nil
+	}
+	var list struct {
+		Labels []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+	if err := a.call(ctx, http.MethodGet, a.gmail("/labels"), nil, &list); err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(wanted))
+	for _, want := range wanted {
+		id := ""
+		for _, label := range list.Labels {
+			if label.ID == want || strings.EqualFold(label.Name, want) {
+				id = label.ID
+				break
+			}
+		}
+		if id == "" {
+			return nil, &Error{Kind: KindNotFound, err: fmt.Errorf("unknown label %q", want)}
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func apiGmailSend(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	raw, threadID, err := a.composeMessage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{"raw": raw}
+	if threadID != "" {
+		body["threadId"] = threadID
+	}
+	var msg map[string]interface{}
+	if err := a.call(ctx, http.MethodPost, a.gmail("/messages/send"), body, &msg); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"message": msg}, nil
+}
+
+func apiGmailDraftCreate(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	raw, threadID, err := a.composeMessage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	message := map[string]interface{}{"raw": raw}
+	if threadID != "" {
+		message["threadId"] = threadID
+	}
+	var draft map[string]interface{}
+	if err := a.call(ctx, http.MethodPost, a.gmail("/drafts"), map[string]interface{}{"message": message}, &draft); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"draft": draft}, nil
+}
+
+func (a *APIRunner) composeMessage(ctx context.Context, params map[string]interface{}) (string, string, error) {
+	for _, key := range []string{"track", "track_split"} {
+		if _, ok := params[key]; ok {
+			return "", "", fmt.Errorf("param %s is not supported by the api runner", key)
+		}
+	}
+	msg := outgoingMessage{
+		From:     paramString(params, "from", ""),
+		To:       paramString(params, "to", ", "),
+		Cc:       paramString(params, "cc", ", "),
+		Bcc:      paramString(params, "bcc", ", "),
+		ReplyTo:  paramString(params, "reply_to", ", "),
+		Subject:  paramString(params, "subject", " "),
+		Body:     paramString(params, "body", "\n"),
+		BodyHTML: paramString(params, "body_html", "\n"),
+		Headers:  paramList(params, "headers"),
+	}
+	for _, path := range paramList(params, "attach") {
+		resolved, err := resolveAttachment(a.AttachmentDir, path)
+		if err != nil {
+			return "", "", err
+		}
+		msg.Attachments = append(msg.Attachments, resolved)
+	}
+	if msg.To == "" && msg.Cc == "" && msg.Bcc == "" {
+		return "", "", errEmptyRecipients
+	}
+	threadID := paramString(params, "thread_id", "")
+	if replyID := paramString(params, "reply_to_message_id", ""); replyID != "" {
+		tid, err := a.applyReply(ctx, &msg, replyID)
+		if err != nil {
+			return "", "", err
+		}
+		if threadID == "" {
+			threadID = tid
+		}
+	}
+	mimeBytes, err := buildMIME(msg)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.URLEncoding.EncodeToString(mimeBytes), threadID, nil
+}
+
+// applyReply threads msg under the original message. Recipients are never
+// filled in from it: the policy only checks the ones the agent names.
+func (a *APIRunner) applyReply(ctx context.Context, msg *outgoingMessage, messageID string) (string, error) {
+	query := url.Values{"format": {"metadata"}}
+	for _, h := range []string{"Message-ID", "References", "Subject"} {
+		query.Add("metadataHeaders", h)
+	}
+	var original map[string]interface{}
+	if err := a.call(ctx, http.MethodGet, a.gmail("/messages/"+url.PathEscape(messageID)+"?"+query.Encode()), nil, &original); err != nil {
+		return "", err
+	}
+	headers := messageHeaders(original)
+	if id := headers["message-id"]; id != "" {
+		msg.InReplyTo = id
+		msg.References = strings.TrimSpace(headers["references"] + " " + id)
+	}
+	if msg.Subject == "" {
+		subject := headers["subject"]
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+		msg.Subject = subject
+	}
+	threadID, _ := original["threadId"].(string)
+	return threadID, nil
+}
+
+func apiCalendarList(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	query := url.Values{}
+	if max := paramString(params, "max", ""); max != "" {
+		query.Set("maxResults", max)
+	}
+	if page := paramString(params, "page", ""); page != "" {
+		query.Set("pageToken", page)
+	}
+	var list struct {
+		Items         []interface{} `json:"items"`
+		NextPageToken string        `json:"nextPageToken"`
+	}
+	if err := a.call(ctx, http.MethodGet, a.calendar("/users/me/calendarList?"+query.Encode()), nil, &list); err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{"calendars": nonNil(list.Items)}
+	if list.NextPageToken != "" {
+		out["nextPageToken"] = list.NextPageToken
+	}
+	return out, nil
+}
+
+func apiCalendarEvents(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	query := url.Values{"singleEvents": {"true"}, "orderBy": {"startTime"}}
+	for key, name := range map[string]string{"max": "maxResults", "page": "pageToken", "query": "q"} {
+		if val := paramString(params, key, " "); val != "" {
+			query.Set(name, val)
+		}
+	}
+	for key, name := range map[string]string{"time_min": "timeMin", "time_max": "timeMax"} {
+		if val := paramString(params, key, ""); val != "" {
+			query.Set(name, apiTime(val))
+		}
+	}
+	var list struct {
+		Items         []interface{} `json:"items"`
+		NextPageToken string        `json:"nextPageToken"`
+		TimeZone      string        `json:"timeZone"`
+	}
+	endpoint := a.calendar("/calendars/" + url.PathEscape(paramString(params, "calendar_id", "")) + "/events?" + query.Encode())
+	if err := a.call(ctx, http.MethodGet, endpoint, nil, &list); err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{"events": nonNil(list.Items)}
+	if list.NextPageToken != "" {
+		out["nextPageToken"] = list.NextPageToken
+	}
+	if list.TimeZone != "" {
+		out["timeZone"] = list.TimeZone
+	}
+	return out, nil
+}
+
+func apiCalendarFreeBusy(a *APIRunner, ctx context.Context, params map[string]interface{}) (any, error) {
+	items := []interface{}{}
+	for _, id := range splitList(paramString(params, "calendar_ids", ",")) {
+		items = append(items, map[string]interface{}{"id": id})
+	}
+	body := map[string]interface{}{
+		"timeMin": apiTime(paramString(params, "time_min", "")),
+		"timeMax": apiTime(paramString(params, "time_max", "")),
+		"items":   items,
+	}
+	var resp map[string]interface{}
+	if err := a.call(ctx, http.MethodPost, a.calendar("/freeBusy"), body, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// apiTime turns a bare date into the RFC 3339 timestamp the API requires.
+func apiTime(val string) string {
+	if t, err := time.Parse("2006-01-02", val); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	return val
+}
+
+func paramString(params map[string]interface{}, key, sep string) string {
+	val, ok := params[key]
+	if !ok {
+		return ""
+	}
+	vals, err := normalizeValue(val)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Join(vals, sep))
+}
+
+func paramList(params map[string]interface{}, key string) []string {
+	val, ok := params[key]
+	if !ok {
+		return nil
+	}
+	vals, _ := normalizeValue(val)
+	return vals
+}
+
+func splitList(raw string) []string {
+	out := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func nonNil(items []interface{}) []interface{} {
+	if items == nil {
+		return []interface{}{}
+	}
+	return items
+}
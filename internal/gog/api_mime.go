@@ -0,0 +1,203 @@
+package gog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type outgoingMessage struct {
+	From        string
+	To          string
+	Cc          string
+	Bcc         string
+	ReplyTo     string
+	Subject     string
+	Body        string
+	BodyHTML    string
+	InReplyTo   string
+	References  string
+	Headers     []string
+	Attachments []string
+}
+
+var errAttachmentsDisabled = errors.New("attachments need api.attachment_dir")
+
+// resolveAttachment maps an agent-supplied attachment path to a file inside
+// dir. The broker reads attachments itself, outside any gog sandbox, so
+// anything else (its token files, the cursor key) must stay out of reach.
+func resolveAttachment(dir, path string) (string, error) {
+	if dir == "" {
+		return "", errAttachmentsDisabled
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("attachment dir: %w", err)
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", fmt.Errorf("attachment dir: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("attachment: %w", err)
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("attachment %s is outside the attachment directory", filepath.Base(path))
+	}
+	return real, nil
+}
+
+func buildMIME(m outgoingMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) error {
+		if value == "" {
+			return nil
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s contains a line break", name)
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		return nil
+	}
+	for _, h := range [][2]string{
+		{"From", m.From},
+		{"To", m.To},
+		{"Cc", m.Cc},
+		{"Bcc", m.Bcc},
+		{"Reply-To", m.ReplyTo},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"In-Reply-To", m.InReplyTo},
+		{"References", m.References},
+	} {
+		if err := header(h[0], h[1]); err != nil {
+			return nil, err
+		}
+	}
+	for _, raw := range m.Headers {
+		name, value, ok := strings.Cut(raw, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q", raw)
+		}
+		if err := header(textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value)); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(m.Attachments) == 0 {
+		if err := writeBody(&buf, m); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+	var body bytes.Buffer
+	if err := writeBody(&body, m); err != nil {
+		return nil, err
+	}
+	headers, content, _ := bytes.Cut(body.Bytes(), []byte("\r\n\r\n"))
+	part, err := mixed.CreatePart(parsePartHeader(headers))
+	if err != nil {
+		return nil, err
+	}
+	part.Write(content)
+	for _, path := range m.Attachments {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("attachment: %w", err)
+		}
+		name := filepath.Base(path)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, data)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody writes the Content-Type header, a blank line and the text, or
+// text and HTML alternatives.
+func writeBody(buf *bytes.Buffer, m outgoingMessage) error {
+	if m.BodyHTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		return writeQuotedPrintable(buf, m.Body)
+	}
+	alt := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alt.Boundary())
+	for _, p := range []struct{ contentType, text string }{
+		{"text/plain; charset=UTF-8", m.Body},
+		{"text/html; charset=UTF-8", m.BodyHTML},
+	} {
+		part, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		w := quotedprintable.NewWriter(part)
+		if _, err := w.Write([]byte(p.text)); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return alt.Close()
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, text string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(text)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func parsePartHeader(raw []byte) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			header.Set(name, strings.TrimSpace(value))
+		}
+	}
+	return header
+}
+
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+var errEmptyRecipients = errors.New("at least one of to, cc or bcc is required")
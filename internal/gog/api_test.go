@@ -0,0 +1,264 @@
+package gog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+)
+
+type fakeGoogle struct {
+	*httptest.Server
+	refreshes atomic.Int32
+	sent      atomic.Value
+}
+
+func newFakeGoogle(t *testing.T) *fakeGoogle {
+	t.Helper()
+	f := &fakeGoogle{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		f.refreshes.Add(1)
+		if r.FormValue("refresh_token") != "refresh-1" || r.FormValue("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]any{"access_token": "access-1", "expires_in": 3600})
+	})
+	mux.HandleFunc("/gmail/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch path := strings.TrimPrefix(r.URL.Path, "/gmail"); {
+		case path == "/labels":
+			writeJSON(w, map[string]any{"labels": []any{
+				map[string]any{"id": "INBOX", "name": "INBOX"},
+				map[string]any{"id": "Label_1", "name": "Project"},
+			}})
+		case path == "/threads" && r.URL.Query().Get("q") == "in:inbox":
+			writeJSON(w, map[string]any{"threads": []any{map[string]any{"id": "t1"}}, "nextPageToken": "p2"})
+		case path == "/threads/t1" && r.URL.Query().Get("format") == "metadata":
+			writeJSON(w, map[string]any{"id": "t1", "messages": []any{
+				map[string]any{"id": "m1", "labelIds": []any{"INBOX"}, "payload": map[string]any{"headers": []any{
+					map[string]any{"name": "From", "value": "a@example.com"},
+					map[string]any{"name": "Subject", "value": "first"},
+				}}},
+				map[string]any{"id": "m2", "labelIds": []any{"INBOX", "Label_1"}, "payload": map[string]any{"headers": []any{
+					map[string]any{"name": "From", "value": "b@example.com"},
+					map[string]any{"name": "Subject", "value": "Re: first"},
+				}}},
+			}})
+		case path == "/threads/t1/modify":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			writeJSON(w, map[string]any{"id": "t1", "request": body})
+		case path == "/messages/m1":
+			writeJSON(w, map[string]any{"id": "m1", "threadId": "t1", "payload": map[string]any{"headers": []any{
+				map[string]any{"name": "Message-ID", "value": "<m1@example.com>"},
+				map[string]any{"name": "Subject", "value": "Plans"},
+				map[string]any{"name": "From", "value": "Ann <ann@example.com>"},
+				map[string]any{"name": "To", "value": "me@example.com, bob@example.com"},
+			}}})
+		case path == "/messages/send":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.sent.Store(body)
+			writeJSON(w, map[string]any{"id": "m9", "threadId": body["threadId"]})
+		case path == "/messages/missing":
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"error": map[string]any{"code": 404, "message": "Requested entity was not found."}})
+		case path == "/messages/limited":
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]any{"error": map[string]any{"errors": []any{map[string]any{"reason": "userRateLimitExceeded"}}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/calendar/users/me/calendarList", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"items": []any{map[string]any{"id": "primary", "primary": true, "timeZone": "Europe/Berlin"}}})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGoogle) factory(t *testing.T, token map[string]any) *APIFactory {
+	t.Helper()
+	dir := t.TempDir()
+	payload, _ := json.Marshal(token)
+	if err := os.WriteFile(filepath.Join(dir, "a@example.com.json"), payload, 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	creds := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(creds, []byte(`{"installed":{"client_id":"client","client_secret":"secret"}}`), 0o600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	return &APIFactory{
+		TokenFile:       filepath.Join(dir, "{account}.json"),
+		CredentialsFile: creds,
+		TokenURL:        f.URL + "/token",
+		GmailURL:        f.URL + "/gmail",
+		CalendarURL:     f.URL + "/calendar",
+		Timeout:         5 * time.Second,
+	}
+}
+
+func TestAPIRunnerSearchRefreshesToken(t *testing.T) {
+	google := newFakeGoogle(t)
+	factory := google.factory(t, map[string]any{"refresh_token": "refresh-1"})
+	runner := factory.RunnerFor("a@example.com")
+	ctx := context.Background()
+
+	data, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"query": "in:inbox", "max": float64(5)})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	root := data.(map[string]interface{})
+	threads := root["threads"].([]interface{})
+	thread := threads[0].(map[string]interface{})
+	if thread["subject"] != "Re: first" || thread["from"] != "b@example.com" || thread["messageCount"] != 2 {
+		t.Fatalf("unexpected thread summary: %v", thread)
+	}
+	if labels := thread["labelIds"].([]interface{}); len(labels) != 2 {
+		t.Fatalf("expected label union, got %v", labels)
+	}
+	if root["nextPageToken"] != "p2" {
+		t.Fatalf("expected next page token, got %v", root["nextPageToken"])
+	}
+	if _, err := factory.RunnerFor("a@example.com").Run(ctx, "calendar.list", nil); err != nil {
+		t.Fatalf("calendar list: %v", err)
+	}
+	if got := google.refreshes.Load(); got != 1 {
+		t.Fatalf("expected access token to be reused, got %d refreshes", got)
+	}
+}
+
+func TestAPIRunnerResolvesLabelNames(t *testing.T) {
+	google := newFakeGoogle(t)
+	runner := google.factory(t, map[string]any{"refresh_token": "refresh-1"}).RunnerFor("a@example.com")
+	data, err := runner.Run(context.Background(), "gmail.thread.modify", map[string]interface{}{"thread_id": "t1", "add": "Project", "remove": "INBOX"})
+	if err != nil {
+		t.Fatalf("modify: %v", err)
+	}
+	request := data.(map[string]interface{})["thread"].(map[string]interface{})["request"].(map[string]interface{})
+	if add := request["addLabelIds"].([]interface{}); len(add) != 1 || add[0] != "Label_1" {
+		t.Fatalf("expected label name to resolve to id, got %v", request)
+	}
+}
+
+func TestAPIRunnerSendsReply(t *testing.T) {
+	google := newFakeGoogle(t)
+	runner := google.factory(t, map[string]any{"refresh_token": "refresh-1"}).RunnerFor("a@example.com")
+	if _, err := runner.Run(context.Background(), "gmail.send", map[string]interface{}{"reply_to_message_id": "m1", "body": "Sounds good"}); !errors.Is(err, errEmptyRecipients) {
+		t.Fatalf("expected reply without recipients to be rejected, got %v", err)
+	}
+	if google.sent.Load() != nil {
+		t.Fatalf("expected nothing to be sent")
+	}
+	_, err := runner.Run(context.Background(), "gmail.send", map[string]interface{}{
+		"to":                  "Ann <ann@example.com>",
+		"reply_to_message_id": "m1",
+		"body":                "Sounds good",
+		"headers":             []interface{}{"X-Agent: sandbox"},
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	body := google.sent.Load().(map[string]any)
+	if body["threadId"] != "t1" {
+		t.Fatalf("expected reply to stay in thread, got %v", body["threadId"])
+	}
+	raw, err := base64.URLEncoding.DecodeString(body["raw"].(string))
+	if err != nil {
+		t.Fatalf("decode raw: %v", err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if msg.Header.Get("To") != "Ann <ann@example.com>" || msg.Header.Get("Cc") != "" {
+		t.Fatalf("unexpected recipients: to=%q cc=%q", msg.Header.Get("To"), msg.Header.Get("Cc"))
+	}
+	if msg.Header.Get("Subject") != "Re: Plans" || msg.Header.Get("In-Reply-To") != "<m1@example.com>" || msg.Header.Get("X-Agent") != "sandbox" {
+		t.Fatalf("unexpected headers: %v", msg.Header)
+	}
+	text, _ := io.ReadAll(msg.Body)
+	if !strings.Contains(string(text), "Sounds good") {
+		t.Fatalf("unexpected body: %q", text)
+	}
+}
+
+func TestAPIRunnerClassifiesErrors(t *testing.T) {
+	google := newFakeGoogle(t)
+	runner := google.factory(t, map[string]any{"refresh_token": "refresh-1"}).RunnerFor("a@example.com")
+	ctx := context.Background()
+	for id, want := range map[string]ErrorKind{"missing": KindNotFound, "limited": KindRateLimited} {
+		_, err := runner.Run(ctx, "gmail.get", map[string]interface{}{"message_id": id})
+		if kind, _ := ErrorKindOf(err); kind != want {
+			t.Fatalf("%s: expected %s, got %v", id, want, err)
+		}
+	}
+
+	revoked := google.factory(t, map[string]any{"refresh_token": "revoked"}).RunnerFor("a@example.com")
+	_, err := revoked.Run(ctx, "gmail.labels.list", nil)
+	if kind, _ := ErrorKindOf(err); kind != KindAuthExpired {
+		t.Fatalf("expected auth_expired, got %v", err)
+	}
+	if _, err := runner.Run(ctx, "gmail.labels.list", map[string]interface{}{"bogus": true}); err == nil || !strings.Contains(err.Error(), "unknown params") {
+		t.Fatalf("expected unknown params to be rejected, got %v", err)
+	}
+}
+
+func TestAPIRunnerCoversAllActions(t *testing.T) {
+	for _, action := range actions.Names() {
+		if spec, _ := actions.Lookup(action); len(spec.Command) == 0 {
+			continue
+		}
+		if _, ok := apiActions[action]; !ok {
+			t.Errorf("api runner does not implement %s", action)
+		}
+	}
+}
+
+func TestResolveAttachmentStaysInDir(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	for name, parent := range map[string]string{"report.txt": dir, "token.json": outside} {
+		if err := os.WriteFile(filepath.Join(parent, name), []byte("x"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "token.json"), filepath.Join(dir, "link.json")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	if _, err := resolveAttachment("", "report.txt"); !errors.Is(err, errAttachmentsDisabled) {
+		t.Fatalf("expected attachments to be disabled, got %v", err)
+	}
+	if got, err := resolveAttachment(dir, "report.txt"); err != nil || filepath.Base(got) != "report.txt" {
+		t.Fatalf("expected file in dir, got %q %v", got, err)
+	}
+	for _, path := range []string{filepath.Join(outside, "token.json"), "../" + filepath.Base(outside) + "/token.json", "link.json"} {
+		if _, err := resolveAttachment(dir, path); err == nil {
+			t.Fatalf("expected %s to be rejected", path)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package gog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultTokenURL = "https://oauth2.googleapis.com/token"
+
+const tokenExpiryMargin = time.Minute
+
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// FileTokenSource reads an OAuth token exported from gog's token store and
+// refreshes the access token in memory when it expires. gog keeps the store
+// in the OS keyring, which the standard library cannot read, hence the
+// export. The file is reread on each refresh, so a re-export takes effect
+// without a restart.
+type FileTokenSource struct {
+	Path            string
+	CredentialsPath string
+	TokenURL        string
+	Client          *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+type tokenFile struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Expiry       string `json:"expiry"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type clientCredentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func (s *FileTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Now().Add(tokenExpiryMargin).Before(s.expiry) {
+		return s.accessToken, nil
+	}
+	tok, err := readTokenFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+	if tok.AccessToken != "" && tok.Expiry != "" {
+		if expiry, err := time.Parse(time.RFC3339, tok.Expiry); err == nil && time.Now().Add(tokenExpiryMargin).Before(expiry) {
+			s.accessToken, s.expiry = tok.AccessToken, expiry
+			return s.accessToken, nil
+		}
+	}
+	if tok.RefreshToken == "" {
+		return "", &Error{Kind: KindAuthExpired, err: errors.New("token file has no refresh_token")}
+	}
+	creds := clientCredentials{ClientID: tok.ClientID, ClientSecret: tok.ClientSecret}
+	if creds.ClientID == "" {
+		creds, err = readClientCredentials(s.CredentialsPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	access, expiry, err := s.refresh(ctx, creds, tok.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+	s.accessToken, s.expiry = access, expiry
+	return access, nil
+}
+
+func (s *FileTokenSource) refresh(ctx context.Context, creds clientCredentials, refreshToken string) (string, time.Time, error) {
+	tokenURL := s.TokenURL
+	if tokenURL == "" {
+		tokenURL = creds.TokenURI
+	}
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, classifyTransport(ctx, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		kind := classifyStatus(resp.StatusCode, body)
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			kind = KindAuthExpired
+		}
+		return "", time.Time{}, &Error{Kind: kind, ExitCode: resp.StatusCode, err: fmt.Errorf("token refresh failed: %s", resp.Status)}
+	}
+	var payload struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.AccessToken == "" {
+		return "", time.Time{}, &Error{Kind: KindAuthExpired, err: errors.New("token refresh returned no access_token")}
+	}
+	if payload.ExpiresIn <= 0 {
+		payload.ExpiresIn = 3600
+	}
+	return payload.AccessToken, time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second), nil
+}
+
+func readTokenFile(path string) (tokenFile, error) {
+	var tok tokenFile
+	if path == "" {
+		return tok, &Error{Kind: KindAuthExpired, err: errors.New("token file is not configured")}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tok, &Error{Kind: KindAuthExpired, err: err}
+	}
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return tok, fmt.Errorf("invalid token file: %w", err)
+	}
+	return tok, nil
+}
+
+// readClientCredentials accepts the client JSON downloaded from the Google
+// Cloud console ({"installed": {...}} or {"web": {...}}) or a flat object.
+func readClientCredentials(path string) (clientCredentials, error) {
+	var creds clientCredentials
+	if path == "" {
+		return creds, errors.New("credentials file is not configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return creds, err
+	}
+	var wrapped struct {
+		Installed *clientCredentials `json:"installed"`
+		Web       *clientCredentials `json:"web"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return creds, fmt.Errorf("invalid credentials file: %w", err)
+	}
+	switch {
+	case wrapped.Installed != nil:
+		creds = *wrapped.Installed
+	case wrapped.Web != nil:
+		creds = *wrapped.Web
+	default:
+		if err := json.Unmarshal(data, &creds); err != nil {
+			return creds, fmt.Errorf("invalid credentials file: %w", err)
+		}
+	}
+	if creds.ClientID == "" {
+		return creds, errors.New("credentials file has no client_id")
+	}
+	return creds, nil
+}
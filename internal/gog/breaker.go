@@ -0,0 +1,217 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 3
+	DefaultBreakerCooldown  = 30 * time.Second
+	DefaultProbeAction      = "gmail.labels.list"
+)
+
+var ErrUnavailable = errors.New("upstream unavailable")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// UnavailableError is returned without running gog while an account's
+// breaker is open.
+type UnavailableError struct {
+	Kind    ErrorKind
+	RetryAt time.Time
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("gog is unavailable for this account after repeated %s failures; retry after %s", e.Kind, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// BreakerProvider stops forking gog for an account after Threshold
+// consecutive auth or network failures. After Cooldown one request probes
+// with ProbeAction, or runs as the probe itself when ProbeAllowed says the
+// account's policy does not allow ProbeAction; success closes the breaker,
+// failure reopens it.
+type BreakerProvider struct {
+	Next         RunnerProvider
+	Threshold    int
+	Cooldown     time.Duration
+	ProbeAction  string
+	ProbeAllowed func(account, action string) bool
+
+	mu       sync.Mutex
+	accounts map[string]*breaker
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	kind     ErrorKind
+	openedAt time.Time
+	retryAt  time.Time
+}
+
+type BreakerStatus struct {
+	Account   string       `json:"account"`
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures,omitempty"`
+	LastError ErrorKind    `json:"last_error,omitempty"`
+	OpenedAt  string       `json:"opened_at,omitempty"`
+	RetryAt   string       `json:"retry_at,omitempty"`
+}
+
+func (p *BreakerProvider) RunnerFor(account string) Runner {
+	return &breakerRunner{next: p.Next.RunnerFor(account), account: normalizeCacheAccount(account), provider: p}
+}
+
+func (p *BreakerProvider) Status() []BreakerStatus {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]BreakerStatus, 0, len(p.accounts))
+	for account, br := range p.accounts {
+		status := BreakerStatus{Account: account, State: br.state, Failures: br.failures, LastError: br.kind}
+		if account == "" {
+			status.Account = "_default"
+		}
+		if br.state != BreakerClosed {
+			status.OpenedAt = br.openedAt.UTC().Format(time.RFC3339)
+			status.RetryAt = br.retryAt.UTC().Format(time.RFC3339)
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Account < out[j].Account })
+	return out
+}
+
+func (p *BreakerProvider) threshold() int {
+	if p.Threshold > 0 {
+		return p.Threshold
+	}
+	return DefaultBreakerThreshold
+}
+
+func (p *BreakerProvider) cooldown() time.Duration {
+	if p.Cooldown > 0 {
+		return p.Cooldown
+	}
+	return DefaultBreakerCooldown
+}
+
+func (p *BreakerProvider) probeAction() string {
+	if p.ProbeAction != "" {
+		return p.ProbeAction
+	}
+	return DefaultProbeAction
+}
+
+func (p *BreakerProvider) breakerLocked(account string) *breaker {
+	if p.accounts == nil {
+		p.accounts = map[string]*breaker{}
+	}
+	br, ok := p.accounts[account]
+	if !ok {
+		br = &breaker{state: BreakerClosed}
+		p.accounts[account] = br
+	}
+	return br
+}
+
+// admit reports whether the request must probe first, or fails while the
+// breaker is open.
+func (p *BreakerProvider) admit(account string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	br := p.breakerLocked(account)
+	switch br.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerOpen:
+		if time.Now().Before(br.retryAt) {
+			return false, &UnavailableError{Kind: br.kind, RetryAt: br.retryAt}
+		}
+		br.state = BreakerHalfOpen
+		return true, nil
+	default:
+		return false, &UnavailableError{Kind: br.kind, RetryAt: br.retryAt}
+	}
+}
+
+func (p *BreakerProvider) record(account string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	br := p.breakerLocked(account)
+	if err != nil {
+		if _, ok := ErrorKindOf(err); !ok {
+			// Cancellation or a local limit: gog did not answer, so the
+			// state stands and a probe slot is handed back.
+			if br.state == BreakerHalfOpen {
+				br.state = BreakerOpen
+			}
+			return
+		}
+	}
+	if !tripsBreaker(err) {
+		br.state = BreakerClosed
+		br.failures = 0
+		return
+	}
+	br.failures++
+	br.kind, _ = ErrorKindOf(err)
+	if br.state == BreakerHalfOpen || br.failures >= p.threshold() {
+		now := time.Now()
+		if br.state == BreakerClosed {
+			br.openedAt = now
+		}
+		br.state = BreakerOpen
+		br.retryAt = now.Add(p.cooldown())
+	}
+}
+
+func tripsBreaker(err error) bool {
+	kind, ok := ErrorKindOf(err)
+	return ok && (kind == KindAuthExpired || kind == KindNetwork)
+}
+
+type breakerRunner struct {
+	next     Runner
+	account  string
+	provider *BreakerProvider
+}
+
+func (r *breakerRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	probe, err := r.provider.admit(r.account)
+	if err != nil {
+		return nil, err
+	}
+	if probe {
+		action := r.provider.probeAction()
+		if allowed := r.provider.ProbeAllowed; allowed == nil || allowed(r.account, action) {
+			_, err := r.next.Run(ctx, action, nil)
+			r.provider.record(r.account, err)
+			if err != nil {
+				if _, ok := ErrorKindOf(err); !ok || tripsBreaker(err) {
+					return nil, err
+				}
+			}
+		}
+	}
+	data, err := r.next.Run(ctx, action, params)
+	r.provider.record(r.account, err)
+	return data, err
+}
@@ -0,0 +1,127 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type scriptedRunner struct {
+	actions []string
+	errs    []error
+}
+
+func (s *scriptedRunner) RunnerFor(account string) Runner {
+	return s
+}
+
+func (s *scriptedRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	s.actions = append(s.actions, action)
+	if len(s.errs) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return nil, err
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	authErr := &Error{Kind: KindAuthExpired}
+	next := &scriptedRunner{errs: []error{authErr, authErr}}
+	provider := &BreakerProvider{Next: next, Threshold: 2, Cooldown: time.Hour}
+	runner := provider.RunnerFor("a@example.com")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, authErr) {
+			t.Fatalf("expected auth error, got %v", err)
+		}
+	}
+	_, err := runner.Run(ctx, "gmail.search", nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected short circuit, got %v", err)
+	}
+	if len(next.actions) != 2 {
+		t.Fatalf("expected gog not to run while open, got %d calls", len(next.actions))
+	}
+	if _, err := provider.RunnerFor("b@example.com").Run(ctx, "gmail.search", nil); err != nil {
+		t.Fatalf("expected other accounts to be unaffected, got %v", err)
+	}
+	status := provider.Status()
+	if len(status) != 2 || status[0].State != BreakerOpen || status[0].LastError != KindAuthExpired {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	netErr := &Error{Kind: KindNetwork}
+	next := &scriptedRunner{errs: []error{netErr, netErr}}
+	provider := &BreakerProvider{Next: next, Threshold: 1, Cooldown: time.Hour}
+	runner := provider.RunnerFor("a@example.com")
+	ctx := context.Background()
+
+	if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, netErr) {
+		t.Fatalf("expected network error, got %v", err)
+	}
+	provider.mu.Lock()
+	provider.accounts["a@example.com"].retryAt = time.Now()
+	provider.mu.Unlock()
+	if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, netErr) {
+		t.Fatalf("expected failed probe to be returned, got %v", err)
+	}
+	if next.actions[1] != DefaultProbeAction || len(next.actions) != 2 {
+		t.Fatalf("expected a single probe call, got %v", next.actions)
+	}
+	if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected breaker to reopen, got %v", err)
+	}
+
+	provider.mu.Lock()
+	provider.accounts["a@example.com"].retryAt = time.Now()
+	provider.mu.Unlock()
+	if _, err := runner.Run(ctx, "gmail.search", nil); err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	if got := next.actions[2:]; len(got) != 2 || got[0] != DefaultProbeAction || got[1] != "gmail.search" {
+		t.Fatalf("expected probe then request, got %v", got)
+	}
+	if status := provider.Status(); status[0].State != BreakerClosed {
+		t.Fatalf("expected breaker to close, got %+v", status)
+	}
+}
+
+func TestBreakerProbeIgnoresLocalErrors(t *testing.T) {
+	netErr := &Error{Kind: KindNetwork}
+	next := &scriptedRunner{errs: []error{netErr, ErrQueueTimeout}}
+	provider := &BreakerProvider{Next: next, Threshold: 1, Cooldown: time.Hour}
+	runner := provider.RunnerFor("a@example.com")
+	ctx := context.Background()
+	reopen := func() {
+		provider.mu.Lock()
+		provider.accounts["a@example.com"].retryAt = time.Now()
+		provider.mu.Unlock()
+	}
+
+	if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, netErr) {
+		t.Fatalf("expected network error, got %v", err)
+	}
+	reopen()
+	if _, err := runner.Run(ctx, "gmail.search", nil); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected busy probe to be returned, got %v", err)
+	}
+	if status := provider.Status(); status[0].State != BreakerOpen {
+		t.Fatalf("expected breaker to stay open, got %+v", status)
+	}
+
+	provider.ProbeAllowed = func(account, action string) bool { return false }
+	if _, err := runner.Run(ctx, "calendar.list", nil); err != nil {
+		t.Fatalf("expected the request to probe, got %v", err)
+	}
+	if got := next.actions[2:]; len(got) != 1 || got[0] != "calendar.list" {
+		t.Fatalf("expected the request itself as probe, got %v", got)
+	}
+	if status := provider.Status(); status[0].State != BreakerClosed {
+		t.Fatalf("expected breaker to close, got %+v", status)
+	}
+}
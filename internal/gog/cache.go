@@ -0,0 +1,253 @@
+package gog
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultCacheMaxEntries = 512
+
+var DefaultCacheTTLs = map[string]time.Duration{
+	"gmail.labels.list": 5 * time.Minute,
+	"calendar.list":     5 * time.Minute,
+}
+
+type noCacheKey struct{}
+
+// NoCache marks a call that must reach gog. The fresh result still replaces
+// whatever was cached for the same key.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+type Cache struct {
+	ttls       map[string]time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	// gens counts invalidations per account and flushes all of them, so a
+	// read that overlapped one does not store what it fetched before.
+	gens    map[string]uint64
+	flushes uint64
+	hits    uint64
+	misses  uint64
+}
+
+type CacheStats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+type cacheItem struct {
+	key     string
+	account string
+	value   any
+	expires time.Time
+}
+
+func NewCache(ttls map[string]time.Duration, maxEntries int) *Cache {
+	if ttls == nil {
+		ttls = DefaultCacheTTLs
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &Cache{ttls: ttls, maxEntries: maxEntries, ll: list.New(), items: map[string]*list.Element{}, gens: map[string]uint64{}}
+}
+
+func (c *Cache) TTL(action string) time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.ttls[action]
+}
+
+func (c *Cache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	item := el.Value.(*cacheItem)
+	if time.Now().After(item.expires) {
+		c.removeLocked(el)
+		c.misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits++
+	return item.value, true
+}
+
+func (c *Cache) generation(account string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[account] + c.flushes
+}
+
+// set stores value unless the account was invalidated since gen was taken.
+func (c *Cache) set(key, account string, value any, ttl time.Duration, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[account]+c.flushes != gen {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*cacheItem)
+		item.value = value
+		item.expires = time.Now().Add(ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+	el := c.ll.PushFront(&cacheItem{key: key, account: account, value: value, expires: time.Now().Add(ttl)})
+	c.items[key] = el
+	for c.ll.Len() > c.maxEntries {
+		c.removeLocked(c.ll.Back())
+	}
+}
+
+func (c *Cache) InvalidateAccount(account string) {
+	if c == nil {
+		return
+	}
+	account = normalizeCacheAccount(account)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[account]++
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cacheItem).account == account {
+			c.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+func (c *Cache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+	c.flushes++
+}
+
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: c.ll.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	item := el.Value.(*cacheItem)
+	delete(c.items, item.key)
+	c.ll.Remove(el)
+}
+
+type CachedProvider struct {
+	Next  RunnerProvider
+	Cache *Cache
+}
+
+func (p *CachedProvider) RunnerFor(account string) Runner {
+	return &cachedRunner{next: p.Next.RunnerFor(account), account: normalizeCacheAccount(account), cache: p.Cache}
+}
+
+type cachedRunner struct {
+	next    Runner
+	account string
+	cache   *Cache
+}
+
+func (r *cachedRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	if !IsReadOnly(action) {
+		data, err := r.next.Run(ctx, action, params)
+		if err == nil || !writeRejected(err) {
+			r.cache.InvalidateAccount(r.account)
+		}
+		return data, err
+	}
+	ttl := r.cache.TTL(action)
+	if ttl <= 0 {
+		return r.next.Run(ctx, action, params)
+	}
+	key, ok := cacheKey(r.account, action, params)
+	if !ok {
+		return r.next.Run(ctx, action, params)
+	}
+	if skip, _ := ctx.Value(noCacheKey{}).(bool); !skip {
+		if value, ok := r.cache.get(key); ok {
+			return cloneJSON(value), nil
+		}
+	}
+	gen := r.cache.generation(r.account)
+	data, err := r.next.Run(ctx, action, params)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(key, r.account, cloneJSON(data), ttl, gen)
+	return data, nil
+}
+
+// writeRejected reports whether a failed write certainly changed nothing:
+// it never reached Google or Google refused it. After a timeout, a network
+// error or an unknown failure it may have been applied.
+func writeRejected(err error) bool {
+	if errors.Is(err, ErrBusy) || errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	switch kind, _ := ErrorKindOf(err); kind {
+	case KindAuthExpired, KindRateLimited, KindNotFound, KindPermissionDenied:
+		return true
+	}
+	return false
+}
+
+func cacheKey(account, action string, params map[string]interface{}) (string, bool) {
+	if len(params) == 0 {
+		return account + "\x00" + action, true
+	}
+	blob, err := json.Marshal(params)
+	if err != nil {
+		return "", false
+	}
+	return account + "\x00" + action + "\x00" + string(blob), true
+}
+
+func normalizeCacheAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+func cloneJSON(val any) any {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = cloneJSON(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = cloneJSON(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,158 @@
+package gog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type countingRunner struct {
+	calls map[string]int
+}
+
+func (c *countingRunner) RunnerFor(account string) Runner {
+	return c
+}
+
+func (c *countingRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[action]++
+	return map[string]interface{}{"labels": []interface{}{map[string]interface{}{"id": "INBOX"}}}, nil
+}
+
+func TestCachedRunnerMemoizesReadActions(t *testing.T) {
+	next := &countingRunner{}
+	provider := &CachedProvider{Next: next, Cache: NewCache(map[string]time.Duration{"gmail.search": time.Minute}, 0)}
+	runner := provider.RunnerFor("a@example.com")
+	ctx := context.Background()
+
+	first, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"query": "in:inbox", "max": float64(10)})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	first.(map[string]interface{})["labels"] = nil
+	second, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"max": 10, "query": "in:inbox"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if next.calls["gmail.search"] != 1 {
+		t.Fatalf("expected one upstream call, got %d", next.calls["gmail.search"])
+	}
+	if second.(map[string]interface{})["labels"] == nil {
+		t.Fatalf("expected cached value to be isolated from caller mutation")
+	}
+	if _, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"query": "in:sent"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if next.calls["gmail.search"] != 2 {
+		t.Fatalf("expected different params to miss")
+	}
+}
+
+func TestCachedRunnerInvalidatesOnWrite(t *testing.T) {
+	next := &countingRunner{}
+	cache := NewCache(map[string]time.Duration{"gmail.labels.list": time.Minute}, 0)
+	provider := &CachedProvider{Next: next, Cache: cache}
+	ctx := context.Background()
+
+	other := provider.RunnerFor("b@example.com")
+	if _, err := other.Run(ctx, "gmail.labels.list", nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	runner := provider.RunnerFor("a@example.com")
+	if _, err := runner.Run(ctx, "gmail.labels.list", nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, err := runner.Run(ctx, "gmail.thread.modify", map[string]interface{}{"thread_id": "t1", "add": "Label_1"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Fatalf("expected only the other account to stay cached, got %d entries", stats.Entries)
+	}
+	if _, err := runner.Run(ctx, "gmail.labels.list", nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if next.calls["gmail.labels.list"] != 3 {
+		t.Fatalf("expected refetch after write, got %d calls", next.calls["gmail.labels.list"])
+	}
+}
+
+func TestCacheEvictsOldestEntries(t *testing.T) {
+	next := &countingRunner{}
+	cache := NewCache(map[string]time.Duration{"gmail.search": time.Minute}, 2)
+	runner := (&CachedProvider{Next: next, Cache: cache}).RunnerFor("a@example.com")
+	ctx := context.Background()
+	for _, q := range []string{"a", "b", "c"} {
+		if _, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"query": q}); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	}
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Fatalf("expected 2 entries, got %d", stats.Entries)
+	}
+	if _, err := runner.Run(ctx, "gmail.search", map[string]interface{}{"query": "a"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if next.calls["gmail.search"] != 4 {
+		t.Fatalf("expected evicted entry to be refetched")
+	}
+}
+
+// hookRunner runs during inside each read, before it returns, and fails
+// writes with writeErr.
+type hookRunner struct {
+	countingRunner
+	during   func()
+	writeErr error
+}
+
+func (h *hookRunner) RunnerFor(account string) Runner {
+	return h
+}
+
+func (h *hookRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	if !IsReadOnly(action) {
+		h.countingRunner.Run(ctx, action, params)
+		return nil, h.writeErr
+	}
+	if during := h.during; during != nil {
+		h.during = nil
+		during()
+	}
+	return h.countingRunner.Run(ctx, action, params)
+}
+
+func TestCachedRunnerSkipsReadsOverlappingWrites(t *testing.T) {
+	next := &hookRunner{}
+	cache := NewCache(map[string]time.Duration{"gmail.labels.list": time.Minute}, 0)
+	runner := (&CachedProvider{Next: next, Cache: cache}).RunnerFor("a@example.com")
+	ctx := context.Background()
+
+	next.during = func() {
+		if _, err := runner.Run(ctx, "gmail.thread.modify", map[string]interface{}{"thread_id": "t1"}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if _, err := runner.Run(ctx, "gmail.labels.list", nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Fatalf("expected read overlapping a write not to be cached, got %d entries", stats.Entries)
+	}
+
+	if _, err := runner.Run(ctx, "gmail.labels.list", nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	next.writeErr = &Error{Kind: KindNotFound}
+	runner.Run(ctx, "gmail.thread.modify", map[string]interface{}{"thread_id": "missing"})
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Fatalf("expected rejected write to keep the cache, got %d entries", stats.Entries)
+	}
+	next.writeErr = &Error{Kind: KindTimeout}
+	runner.Run(ctx, "gmail.thread.modify", map[string]interface{}{"thread_id": "t1"})
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Fatalf("expected timed out write to invalidate, got %d entries", stats.Entries)
+	}
+}
@@ -0,0 +1,113 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+type ErrorKind string
+
+const (
+	KindAuthExpired      ErrorKind = "auth_expired"
+	KindRateLimited      ErrorKind = "rate_limited"
+	KindNotFound         ErrorKind = "not_found"
+	KindPermissionDenied ErrorKind = "permission_denied"
+	KindNetwork          ErrorKind = "network_error"
+	KindTimeout          ErrorKind = "timeout"
+	KindOutputTooLarge   ErrorKind = "output_too_large"
+	KindFailed           ErrorKind = "upstream_error"
+)
+
+var kindMessages = map[ErrorKind]string{
+	KindAuthExpired:      "gog credentials expired or were revoked; re-authenticate the account",
+	KindRateLimited:      "google api rate limit reached",
+	KindNotFound:         "requested resource was not found",
+	KindPermissionDenied: "google api denied access to the resource",
+	KindNetwork:          "google api is unreachable",
+	KindTimeout:          "gog timed out",
+	KindOutputTooLarge:   "gog output exceeded the size limit",
+	KindFailed:           "gog command failed",
+}
+
+// Error is a classified gog failure. Its message never includes gog output,
+// which can carry account names, message ids or tokens.
+type Error struct {
+	Kind     ErrorKind
+	ExitCode int
+	err      error
+}
+
+func (e *Error) Error() string {
+	msg := kindMessages[e.Kind]
+	if msg == "" {
+		msg = kindMessages[KindFailed]
+	}
+	if e.Kind == KindFailed && e.ExitCode > 0 {
+		return fmt.Sprintf("%s (exit %d)", msg, e.ExitCode)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Transient reports whether retrying may help. Timeouts are not transient:
+// each attempt already used the full gog timeout, and retries would outlast
+// the server's write deadline.
+func (e *Error) Transient() bool {
+	switch e.Kind {
+	case KindRateLimited, KindNetwork:
+		return true
+	default:
+		return false
+	}
+}
+
+func ErrorKindOf(err error) (ErrorKind, bool) {
+	var gerr *Error
+	if errors.As(err, &gerr) {
+		return gerr.Kind, true
+	}
+	return "", false
+}
+
+// stderrPatterns match gog's Google API errors ("googleapi: Error 403: ...,
+// reason") and OAuth errors. Bare phrases such as "permission denied" are
+// left out: local file and exec errors use them too.
+var stderrPatterns = []struct {
+	kind ErrorKind
+	re   *regexp.Regexp
+}{
+	{KindAuthExpired, regexp.MustCompile(`(?i)invalid_grant|token has been expired|expired or revoked|unauthenticated|invalid credentials|error 401|\b401 unauthorized|no (oauth )?token|not logged in|login required`)},
+	{KindRateLimited, regexp.MustCompile(`(?i)error 429|\b429 too many|ratelimitexceeded|userratelimitexceeded|quota exceeded|quotaexceeded|too many requests|rate limit`)},
+	{KindPermissionDenied, regexp.MustCompile(`(?i)error 403|\b403 forbidden|insufficientpermissions|insufficient permission`)},
+	{KindNotFound, regexp.MustCompile(`(?i)error 404|\b404 not found|\bnotfound\b`)},
+	{KindNetwork, regexp.MustCompile(`(?i)dial tcp|no such host|connection refused|connection reset|network is unreachable|i/o timeout|tls handshake|unexpected eof|error 50[0234]|backenderror|service unavailable|bad gateway`)},
+}
+
+func classifyFailure(ctx context.Context, runErr error, stderr string) *Error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &Error{Kind: KindTimeout, err: runErr}
+	}
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	return &Error{Kind: classifyStderr(stderr), ExitCode: exitCode, err: runErr}
+}
+
+func classifyStderr(stderr string) ErrorKind {
+	stderr = strings.TrimSpace(stderr)
+	for _, pattern := range stderrPatterns {
+		if pattern.re.MatchString(stderr) {
+			return pattern.kind
+		}
+	}
+	return KindFailed
+}
@@ -0,0 +1,63 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	cases := map[string]ErrorKind{
+		"oauth2: cannot fetch token: 400 Bad Request\n{\"error\": \"invalid_grant\"}":                    KindAuthExpired,
+		"googleapi: Error 429: Quota exceeded for quota metric, rateLimitExceeded":                       KindRateLimited,
+		"googleapi: Error 403: User-rate limit exceeded., userRateLimitExceeded":                         KindRateLimited,
+		"googleapi: Error 403: Request had insufficient authentication scopes., insufficientPermissions": KindPermissionDenied,
+		"googleapi: Error 404: Requested entity was not found., notFound":                                KindNotFound,
+		"Get \"https://gmail.googleapis.com/\": dial tcp: lookup gmail.googleapis.com: no such host":     KindNetwork,
+		"googleapi: Error 503: The service is currently unavailable., backendError":                      KindNetwork,
+		"unexpected flag --frobnicate":                               KindFailed,
+		"open /home/agent/.config/gog/token.json: permission denied": KindFailed,
+		"exec: \"gog-helper\": executable file not found in $PATH":   KindFailed,
+	}
+	for stderr, want := range cases {
+		if got := classifyStderr(stderr); got != want {
+			t.Errorf("classifyStderr(%q) = %s, want %s", stderr, got, want)
+		}
+	}
+}
+
+func TestGogRunnerSanitizesStderr(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	script := t.TempDir() + "/gog"
+	writeScript(t, script, "echo 'googleapi: Error 404: message secret@example.com not found' >&2\nexit 3\n")
+	runner := &GogRunner{Path: script, Account: "secret@example.com", Timeout: 5 * time.Second}
+	_, err := runner.Run(context.Background(), "gmail.get", map[string]interface{}{"message_id": "m1"})
+	var gerr *Error
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected classified error, got %v", err)
+	}
+	if gerr.Kind != KindNotFound || gerr.ExitCode != 3 {
+		t.Fatalf("unexpected error: %+v", gerr)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected stderr to be dropped from message, got %q", err.Error())
+	}
+}
+
+func TestGogRunnerTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	script := t.TempDir() + "/gog"
+	writeScript(t, script, "exec sleep 5\n")
+	runner := &GogRunner{Path: script, Timeout: 50 * time.Millisecond}
+	_, err := runner.Run(context.Background(), "gmail.labels.list", nil)
+	if kind, _ := ErrorKindOf(err); kind != KindTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
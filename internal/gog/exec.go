@@ -0,0 +1,149 @@
+package gog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxOutputBytes = 16 << 20
+	maxStderrBytes        = 64 << 10
+	waitDelay             = 2 * time.Second
+	helperEnv             = "GOGCLI_SANDBOX_EXEC"
+)
+
+var errHelperRequired = errors.New("gog limits require the exec helper")
+
+// DefaultEnv lists the variables gog needs to find its config and keyring.
+// Entries ending in "*" match a prefix.
+var DefaultEnv = []string{
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"PATH",
+	"TMPDIR",
+	"TZ",
+	"LANG",
+	"LC_*",
+	"XDG_CONFIG_HOME",
+	"XDG_DATA_HOME",
+	"XDG_CACHE_HOME",
+	"XDG_STATE_HOME",
+	"XDG_RUNTIME_DIR",
+	"DBUS_SESSION_BUS_ADDRESS",
+	"GOG_*",
+	"SYSTEMROOT",
+	"APPDATA",
+	"LOCALAPPDATA",
+	"USERPROFILE",
+}
+
+// Limits are applied to gog by re-executing the broker binary as a small
+// helper that sets them on itself and then execs gog.
+type Limits struct {
+	CPUSeconds    uint64   `json:"cpu_seconds,omitempty"`
+	MemoryBytes   uint64   `json:"memory_bytes,omitempty"`
+	FileSizeBytes uint64   `json:"file_size_bytes,omitempty"`
+	OpenFiles     uint64   `json:"open_files,omitempty"`
+	Landlock      bool     `json:"landlock,omitempty"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
+}
+
+func (l *Limits) enabled() bool {
+	return l != nil && (l.CPUSeconds > 0 || l.MemoryBytes > 0 || l.FileSizeBytes > 0 || l.OpenFiles > 0 || l.Landlock)
+}
+
+func FilterEnv(environ, allow []string) []string {
+	out := []string{}
+	for _, kv := range environ {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || name == helperEnv {
+			continue
+		}
+		for _, pattern := range allow {
+			if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard && strings.HasPrefix(name, prefix) || name == pattern {
+				out = append(out, kv)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (g *GogRunner) command(ctx context.Context, args []string) (*exec.Cmd, error) {
+	env := FilterEnv(os.Environ(), g.envAllowlist())
+	var cmd *exec.Cmd
+	if g.Limits.enabled() {
+		if g.Helper == "" {
+			return nil, errHelperRequired
+		}
+		payload, err := json.Marshal(g.Limits)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(ctx, g.Helper, append([]string{g.Path}, args...)...)
+		env = append(env, helperEnv+"="+string(payload))
+	} else {
+		cmd = exec.CommandContext(ctx, g.Path, args...)
+	}
+	cmd.Env = env
+	cmd.Dir = g.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = os.TempDir()
+	}
+	cmd.WaitDelay = waitDelay
+	configureProcessGroup(cmd)
+	return cmd, nil
+}
+
+func (g *GogRunner) envAllowlist() []string {
+	if g.Env == nil {
+		return DefaultEnv
+	}
+	return g.Env
+}
+
+func (g *GogRunner) maxOutput() int {
+	if g.MaxOutputBytes > 0 {
+		return g.MaxOutputBytes
+	}
+	return DefaultMaxOutputBytes
+}
+
+// cappedBuffer keeps at most max bytes and swallows the rest, so gog is
+// never blocked on a full pipe. onOverflow lets the caller kill gog early.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	max        int
+	overflow   bool
+	onOverflow func()
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if c.overflow {
+		return len(p), nil
+	}
+	if room := c.max - c.buf.Len(); len(p) > room {
+		c.buf.Write(p[:room])
+		c.overflow = true
+		if c.onOverflow != nil {
+			c.onOverflow()
+		}
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+func (c *cappedBuffer) Bytes() []byte {
+	return c.buf.Bytes()
+}
+
+func (c *cappedBuffer) String() string {
+	return c.buf.String()
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package gog
+
+import "os/exec"
+
+func configureProcessGroup(cmd *exec.Cmd) {}
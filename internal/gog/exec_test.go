@@ -0,0 +1,51 @@
+package gog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	MaybeExecHelper()
+	os.Exit(m.Run())
+}
+
+func TestFilterEnv(t *testing.T) {
+	env := FilterEnv([]string{"HOME=/home/a", "GOG_KEYRING_BACKEND=file", "AWS_SECRET_ACCESS_KEY=x", "LC_ALL=C", helperEnv + "={}"}, DefaultEnv)
+	if strings.Join(env, " ") != "HOME=/home/a GOG_KEYRING_BACKEND=file LC_ALL=C" {
+		t.Fatalf("unexpected env: %v", env)
+	}
+}
+
+func TestGogRunnerUsesCleanEnv(t *testing.T) {
+	t.Setenv("GOGCLI_TEST_SECRET", "leak")
+	dir := t.TempDir()
+	script := dir + "/gog"
+	writeScript(t, script, `printf '{"secret":"%s","dir":"%s"}' "$GOGCLI_TEST_SECRET" "$(pwd -P)"`+"\n")
+	runner := &GogRunner{Path: script, Dir: dir, Timeout: 5 * time.Second}
+	data, err := runner.Run(context.Background(), "gmail.labels.list", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	root := data.(map[string]interface{})
+	if root["secret"] != "" {
+		t.Fatalf("expected env to be filtered, got %v", root["secret"])
+	}
+	if resolved, _ := filepath.EvalSymlinks(dir); root["dir"] != resolved {
+		t.Fatalf("expected working dir %s, got %v", dir, root["dir"])
+	}
+}
+
+func TestGogRunnerCapsOutput(t *testing.T) {
+	script := t.TempDir() + "/gog"
+	writeScript(t, script, "head -c 100000 /dev/zero\n")
+	runner := &GogRunner{Path: script, Timeout: 5 * time.Second, MaxOutputBytes: 1024}
+	_, err := runner.Run(context.Background(), "gmail.labels.list", nil)
+	if kind, _ := ErrorKindOf(err); kind != KindOutputTooLarge {
+		t.Fatalf("expected output_too_large, got %v", err)
+	}
+}
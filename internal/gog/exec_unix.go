@@ -0,0 +1,17 @@
+//go:build unix
+
+package gog
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup starts gog in its own process group so a timeout
+// also kills anything gog spawned.
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -13,6 +13,12 @@ type RunnerFactory struct {
 	Path           string
 	DefaultAccount string
 	Timeout        time.Duration
+	Env            []string
+	Dir            string
+	MaxOutputBytes int
+	Limits         *Limits
+	Helper         string
+	Observer       func(action string, elapsed time.Duration, err error)
 }
 
 func (f *RunnerFactory) RunnerFor(account string) Runner {
@@ -20,5 +26,15 @@ func (f *RunnerFactory) RunnerFor(account string) Runner {
 	if resolved == "" {
 		resolved = strings.TrimSpace(f.DefaultAccount)
 	}
-	return &GogRunner{Path: f.Path, Account: resolved, Timeout: f.Timeout}
+	return &GogRunner{
+		Path:           f.Path,
+		Account:        resolved,
+		Timeout:        f.Timeout,
+		Env:            f.Env,
+		Dir:            f.Dir,
+		MaxOutputBytes: f.MaxOutputBytes,
+		Limits:         f.Limits,
+		Helper:         f.Helper,
+		Observer:       f.Observer,
+	}
 }
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package gog
+
+const HelperSupported = false
+
+func MaybeExecHelper() {}
@@ -0,0 +1,73 @@
+//go:build linux || darwin
+
+package gog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+const HelperSupported = true
+
+// MaybeExecHelper turns the current process into the gog exec helper when it
+// was started by GogRunner with limits. It must run before flag parsing.
+func MaybeExecHelper() {
+	raw, ok := os.LookupEnv(helperEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(helperEnv)
+	err := execHelper(raw, os.Args[1:])
+	fmt.Fprintf(os.Stderr, "gog exec helper: %v\n", err)
+	os.Exit(126)
+}
+
+func execHelper(raw string, args []string) error {
+	var limits Limits
+	if err := json.Unmarshal([]byte(raw), &limits); err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+	if len(args) == 0 {
+		return errors.New("gog path is required")
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	runtime.LockOSThread()
+	if err := applyRlimits(limits); err != nil {
+		return err
+	}
+	if limits.Landlock {
+		if err := restrictFilesystem(limits.WritablePaths); err != nil {
+			return fmt.Errorf("landlock: %w", err)
+		}
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
+
+func applyRlimits(limits Limits) error {
+	for _, rl := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"cpu", syscall.RLIMIT_CPU, limits.CPUSeconds},
+		{"memory", syscall.RLIMIT_AS, limits.MemoryBytes},
+		{"file size", syscall.RLIMIT_FSIZE, limits.FileSizeBytes},
+		{"open files", syscall.RLIMIT_NOFILE, limits.OpenFiles},
+	} {
+		if rl.value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(rl.resource, &syscall.Rlimit{Cur: rl.value, Max: rl.value}); err != nil {
+			return fmt.Errorf("set %s limit: %w", rl.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin
+
+package gog
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGogRunnerAppliesLimitsThroughHelper(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Skip("test binary path unavailable")
+	}
+	script := t.TempDir() + "/gog"
+	writeScript(t, script, `printf '{"open_files":"%s"}' "$(ulimit -n)"`+"\n")
+	runner := &GogRunner{Path: script, Timeout: 5 * time.Second, Helper: self, Limits: &Limits{OpenFiles: 64}}
+	data, err := runner.Run(context.Background(), "gmail.labels.list", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := data.(map[string]interface{})["open_files"]; got != "64" {
+		t.Fatalf("expected open file limit 64, got %v", got)
+	}
+}
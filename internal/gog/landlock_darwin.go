@@ -0,0 +1,7 @@
+package gog
+
+import "errors"
+
+func restrictFilesystem(writable []string) error {
+	return errors.New("only available on Linux")
+}
@@ -0,0 +1,100 @@
+package gog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+	prSetNoNewPrivs              = 38
+	oPath                        = 0x200000
+
+	accessFSWriteFile  = 1 << 1
+	accessFSRemoveDir  = 1 << 4
+	accessFSRemoveFile = 1 << 5
+	accessFSMakeChar   = 1 << 6
+	accessFSMakeDir    = 1 << 7
+	accessFSMakeReg    = 1 << 8
+	accessFSMakeSock   = 1 << 9
+	accessFSMakeFifo   = 1 << 10
+	accessFSMakeBlock  = 1 << 11
+	accessFSMakeSym    = 1 << 12
+	accessFSRefer      = 1 << 13
+	accessFSTruncate   = 1 << 14
+)
+
+// restrictFilesystem denies gog every filesystem write outside writable.
+// Reads are left alone so gog can load its binary, config and certificates.
+func restrictFilesystem(writable []string) error {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return fmt.Errorf("not supported by this kernel: %w", errno)
+	}
+	handled := uint64(accessFSWriteFile | accessFSRemoveDir | accessFSRemoveFile | accessFSMakeChar | accessFSMakeDir |
+		accessFSMakeReg | accessFSMakeSock | accessFSMakeFifo | accessFSMakeBlock | accessFSMakeSym)
+	fileAccess := uint64(accessFSWriteFile)
+	if abi >= 2 {
+		handled |= accessFSRefer
+	}
+	if abi >= 3 {
+		handled |= accessFSTruncate
+		fileAccess |= accessFSTruncate
+	}
+
+	attr := handled
+	rulesetFd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("create ruleset: %w", errno)
+	}
+	defer syscall.Close(int(rulesetFd))
+
+	for _, path := range append([]string{"/dev/null"}, writable...) {
+		var st syscall.Stat_t
+		if err := syscall.Stat(path, &st); err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				continue
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		access := handled
+		if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			access = fileAccess
+		}
+		if err := addPathRule(int(rulesetFd), path, access); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, rulesetFd, 0, 0); errno != 0 {
+		return fmt.Errorf("restrict self: %w", errno)
+	}
+	return nil
+}
+
+func addPathRule(rulesetFd int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	// struct landlock_path_beneath_attr is packed: u64 allowed_access, s32 parent_fd.
+	var attr [12]byte
+	binary.NativeEndian.PutUint64(attr[0:8], access)
+	binary.NativeEndian.PutUint32(attr[8:12], uint32(int32(fd)))
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package gog
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGogRunnerLandlockBlocksWrites(t *testing.T) {
+	if _, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion); errno != 0 {
+		t.Skipf("landlock unavailable: %v", errno)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Skip("test binary path unavailable")
+	}
+	allowed := t.TempDir()
+	denied := t.TempDir()
+	script := allowed + "/gog"
+	t.Setenv("GOG_TEST_ALLOWED", allowed)
+	t.Setenv("GOG_TEST_DENIED", denied)
+	writeScript(t, script, `a=no; b=no
+touch "$GOG_TEST_ALLOWED/ok" 2>/dev/null && a=yes
+touch "$GOG_TEST_DENIED/nope" 2>/dev/null && b=yes
+printf '{"allowed":"%s","denied":"%s"}' "$a" "$b"`+"\n")
+	runner := &GogRunner{Path: script, Timeout: 5 * time.Second, Helper: self, Limits: &Limits{Landlock: true, WritablePaths: []string{allowed}}}
+	data, err := runner.Run(context.Background(), "gmail.labels.list", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	root := data.(map[string]interface{})
+	if root["allowed"] != "yes" || root["denied"] != "no" {
+		t.Fatalf("unexpected write results: %v", root)
+	}
+}
@@ -0,0 +1,201 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBusy         = errors.New("too many concurrent gog requests")
+	ErrQueueTimeout = fmt.Errorf("%w: timed out waiting for a slot", ErrBusy)
+)
+
+type Limiter struct {
+	MaxInFlight   int
+	MaxPerAccount int
+	MaxQueue      int
+	QueueTimeout  time.Duration
+
+	mu         sync.Mutex
+	inFlight   int
+	perAccount map[string]int
+	waiters    []*limitWaiter
+	rejected   uint64
+	timedOut   uint64
+}
+
+type limitWaiter struct {
+	account string
+	ready   chan struct{}
+	granted bool
+}
+
+type LimiterStats struct {
+	InFlight      int                            `json:"in_flight"`
+	Queued        int                            `json:"queued"`
+	MaxInFlight   int                            `json:"max_in_flight"`
+	MaxPerAccount int                            `json:"max_per_account"`
+	MaxQueue      int                            `json:"max_queue"`
+	Rejected      uint64                         `json:"rejected"`
+	TimedOut      uint64                         `json:"timed_out"`
+	Accounts      map[string]LimiterAccountStats `json:"accounts,omitempty"`
+}
+
+type LimiterAccountStats struct {
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+}
+
+func (l *Limiter) Acquire(ctx context.Context, account string) error {
+	account = normalizeCacheAccount(account)
+	l.mu.Lock()
+	if l.perAccount == nil {
+		l.perAccount = map[string]int{}
+	}
+	if l.canRunLocked(account) {
+		l.grantLocked(account)
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.MaxQueue {
+		l.rejected++
+		l.mu.Unlock()
+		return ErrBusy
+	}
+	w := &limitWaiter{account: account, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.QueueTimeout > 0 {
+		timer := time.NewTimer(l.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		if l.abandon(w) {
+			return ctx.Err()
+		}
+		return nil
+	case <-timeout:
+		if l.abandon(w) {
+			l.mu.Lock()
+			l.timedOut++
+			l.mu.Unlock()
+			return ErrQueueTimeout
+		}
+		return nil
+	}
+}
+
+func (l *Limiter) Release(account string) {
+	account = normalizeCacheAccount(account)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.perAccount[account]--
+	if l.perAccount[account] <= 0 {
+		delete(l.perAccount, account)
+	}
+	for i := 0; i < len(l.waiters); {
+		w := l.waiters[i]
+		if !l.canRunLocked(w.account) {
+			i++
+			continue
+		}
+		l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+		l.grantLocked(w.account)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	if l == nil {
+		return LimiterStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := LimiterStats{
+		InFlight:      l.inFlight,
+		Queued:        len(l.waiters),
+		MaxInFlight:   l.MaxInFlight,
+		MaxPerAccount: l.MaxPerAccount,
+		MaxQueue:      l.MaxQueue,
+		Rejected:      l.rejected,
+		TimedOut:      l.timedOut,
+		Accounts:      map[string]LimiterAccountStats{},
+	}
+	for account, n := range l.perAccount {
+		entry := stats.Accounts[account]
+		entry.InFlight = n
+		stats.Accounts[account] = entry
+	}
+	for _, w := range l.waiters {
+		entry := stats.Accounts[w.account]
+		entry.Queued++
+		stats.Accounts[w.account] = entry
+	}
+	return stats
+}
+
+// abandon removes a waiter that gave up. It reports false when the slot was
+// granted concurrently, in which case the caller owns the slot.
+func (l *Limiter) abandon(w *limitWaiter) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		return false
+	}
+	for i, other := range l.waiters {
+		if other == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (l *Limiter) canRunLocked(account string) bool {
+	if l.MaxInFlight > 0 && l.inFlight >= l.MaxInFlight {
+		return false
+	}
+	if l.MaxPerAccount > 0 && l.perAccount[account] >= l.MaxPerAccount {
+		return false
+	}
+	return true
+}
+
+func (l *Limiter) grantLocked(account string) {
+	l.inFlight++
+	l.perAccount[account]++
+}
+
+type LimitedProvider struct {
+	Next    RunnerProvider
+	Limiter *Limiter
+}
+
+func (p *LimitedProvider) RunnerFor(account string) Runner {
+	return &limitedRunner{next: p.Next.RunnerFor(account), account: account, limiter: p.Limiter}
+}
+
+type limitedRunner struct {
+	next    Runner
+	account string
+	limiter *Limiter
+}
+
+func (r *limitedRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	if err := r.limiter.Acquire(ctx, r.account); err != nil {
+		return nil, err
+	}
+	defer r.limiter.Release(r.account)
+	return r.next.Run(ctx, action, params)
+}
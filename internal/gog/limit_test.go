@@ -0,0 +1,76 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterQueuesAndRejects(t *testing.T) {
+	limiter := &Limiter{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Second}
+	ctx := context.Background()
+	if err := limiter.Acquire(ctx, "a@example.com"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- limiter.Acquire(ctx, "b@example.com")
+	}()
+	deadline := time.Now().Add(time.Second)
+	for limiter.Stats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected waiter to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := limiter.Acquire(ctx, "c@example.com"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected busy on full queue, got %v", err)
+	}
+
+	limiter.Release("a@example.com")
+	if err := <-acquired; err != nil {
+		t.Fatalf("expected queued waiter to run, got %v", err)
+	}
+	stats := limiter.Stats()
+	if stats.InFlight != 1 || stats.Queued != 0 || stats.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Accounts["b@example.com"].InFlight != 1 {
+		t.Fatalf("expected slot to move to b, got %+v", stats.Accounts)
+	}
+}
+
+func TestLimiterPerAccountDoesNotBlockOthers(t *testing.T) {
+	limiter := &Limiter{MaxInFlight: 4, MaxPerAccount: 1, MaxQueue: 4, QueueTimeout: 20 * time.Millisecond}
+	ctx := context.Background()
+	if err := limiter.Acquire(ctx, "a@example.com"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := limiter.Acquire(ctx, "b@example.com"); err != nil {
+		t.Fatalf("expected other account to get a slot, got %v", err)
+	}
+	err := limiter.Acquire(ctx, "A@example.com")
+	if !errors.Is(err, ErrQueueTimeout) || !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected queue timeout, got %v", err)
+	}
+	if stats := limiter.Stats(); stats.Queued != 0 || stats.TimedOut != 1 {
+		t.Fatalf("expected timed out waiter to leave the queue: %+v", stats)
+	}
+}
+
+func TestLimitedRunnerReleasesSlot(t *testing.T) {
+	next := &countingRunner{}
+	limiter := &Limiter{MaxInFlight: 1}
+	runner := (&LimitedProvider{Next: next, Limiter: limiter}).RunnerFor("a@example.com")
+	for i := 0; i < 3; i++ {
+		if _, err := runner.Run(context.Background(), "gmail.search", nil); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	if stats := limiter.Stats(); stats.InFlight != 0 {
+		t.Fatalf("expected slot to be released, got %+v", stats)
+	}
+}
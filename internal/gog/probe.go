@@ -0,0 +1,175 @@
+package gog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gogcli-sandbox/internal/actions"
+)
+
+const maxProbeOutput = 256 << 10
+
+// globalFlags are passed on every gog invocation by GogRunner.Run.
+var globalFlags = []string{"--account", "--json", "--no-input"}
+
+var versionRe = regexp.MustCompile(`\bv?(\d+)\.(\d+)\.(\d+)`)
+
+// Capabilities is what the broker learned about the installed gog at
+// startup. Problems affect every action; Disabled maps an action to the
+// reason its gog command cannot be used.
+type Capabilities struct {
+	Version   string            `json:"version"`
+	Supported bool              `json:"supported"`
+	Problems  []string          `json:"problems,omitempty"`
+	Disabled  map[string]string `json:"disabled,omitempty"`
+}
+
+func (c *Capabilities) DisabledReason(action string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	reason, ok := c.Disabled[action]
+	return reason, ok
+}
+
+// Probe runs gog --version and --help for every mapped command and checks
+// the version against [minVersion, maxVersion) and the flags the action
+// specs use. An error means gog could not be run at all.
+func (f *RunnerFactory) Probe(ctx context.Context, minVersion, maxVersion string) (*Capabilities, error) {
+	g := &GogRunner{
+		Path:    f.Path,
+		Timeout: f.Timeout,
+		Env:     f.Env,
+		Dir:     f.Dir,
+		Limits:  f.Limits,
+		Helper:  f.Helper,
+	}
+	out, err := g.output(ctx, "--version")
+	if err != nil {
+		return nil, fmt.Errorf("gog --version: %w", err)
+	}
+	caps := &Capabilities{Version: parseVersion(out), Disabled: map[string]string{}}
+	switch {
+	case caps.Version == "":
+		caps.Problems = append(caps.Problems, "could not parse gog --version output")
+	case !versionInRange(caps.Version, minVersion, maxVersion):
+		caps.Problems = append(caps.Problems, fmt.Sprintf("gog %s is outside the supported range >=%s <%s", caps.Version, minVersion, maxVersion))
+	}
+
+	if help, err := g.output(ctx, "--help"); err != nil {
+		caps.Problems = append(caps.Problems, "gog --help failed")
+	} else {
+		for _, flag := range globalFlags {
+			if !hasFlag(help, flag) {
+				caps.Problems = append(caps.Problems, "gog --help does not list "+flag)
+			}
+		}
+	}
+
+	helps := map[string]string{}
+	for _, name := range actions.Names() {
+		spec, _ := actions.Lookup(name)
+		if len(spec.Command) == 0 {
+			continue
+		}
+		command := strings.Join(spec.Command, " ")
+		help, ok := helps[command]
+		if !ok {
+			help, _ = g.output(ctx, append(append([]string{}, spec.Command...), "--help")...)
+			helps[command] = help
+		}
+		if help == "" {
+			caps.Disabled[name] = fmt.Sprintf("gog %s --help failed", command)
+			continue
+		}
+		missing := []string{}
+		for _, flags := range []map[string]string{spec.Flags, spec.MultiFlags} {
+			for _, flag := range flags {
+				if !hasFlag(help, flag) {
+					missing = append(missing, flag)
+				}
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			caps.Disabled[name] = fmt.Sprintf("gog %s does not support %s", command, strings.Join(missing, ", "))
+		}
+	}
+	caps.Supported = len(caps.Problems) == 0
+	return caps, nil
+}
+
+// output runs gog without an account and returns stdout and stderr
+// combined. Help output is accepted even with a non-zero exit status.
+func (g *GogRunner) output(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+	cmd, err := g.command(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	out := &cappedBuffer{max: maxProbeOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	runErr := cmd.Run()
+	if runErr != nil && len(strings.TrimSpace(out.String())) == 0 {
+		return "", classifyFailure(ctx, runErr, "")
+	}
+	return out.String(), nil
+}
+
+func hasFlag(help, flag string) bool {
+	re := regexp.MustCompile(`(^|[^A-Za-z0-9-])` + regexp.QuoteMeta(flag) + `($|[^A-Za-z0-9-])`)
+	return re.MatchString(help)
+}
+
+func parseVersion(out string) string {
+	m := versionRe.FindStringSubmatch(out)
+	if m == nil {
+		return ""
+	}
+	return m[1] + "." + m[2] + "." + m[3]
+}
+
+// versionInRange reports min <= version < max; an empty bound is open.
+func versionInRange(version, min, max string) bool {
+	v, ok := semver(version)
+	if !ok {
+		return false
+	}
+	if lo, ok := semver(min); ok && compareVersions(v, lo) < 0 {
+		return false
+	}
+	if hi, ok := semver(max); ok && compareVersions(v, hi) >= 0 {
+		return false
+	}
+	return true
+}
+
+func semver(s string) ([3]int, bool) {
+	var out [3]int
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return out, false
+	}
+	for i := range out {
+		out[i], _ = strconv.Atoi(m[i+1])
+	}
+	return out, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package gog
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeGogHelp = `case "$*" in
+--version) echo "gog version v0.9.2 (abc123)" ;;
+"calendar events --help") echo "Usage: gog calendar events <calendarId> --from=STRING --to=STRING --max=INT --page=STRING" ;;
+"gmail labels get --help") exit 2 ;;
+*) echo "Usage: gog [flags] --account=STRING --json --no-input --max --page --oldest --add --remove --format --headers --to --cc --bcc --subject --body --body-html --reply-to-message-id --thread-id --reply-all --reply-to --from --track --track-split --attach --header --query" ;;
+esac
+`
+
+func TestProbeDetectsVersionAndMissingFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gog")
+	writeScript(t, path, fakeGogHelp)
+	factory := &RunnerFactory{Path: path, Timeout: 5 * time.Second}
+
+	caps, err := factory.Probe(context.Background(), "0.4.0", "1.0.0")
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if caps.Version != "0.9.2" || !caps.Supported {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	if reason, ok := caps.DisabledReason("calendar.events"); !ok || reason != "gog calendar events does not support --query" {
+		t.Fatalf("expected calendar.events to be disabled, got %q", reason)
+	}
+	if _, ok := caps.DisabledReason("gmail.labels.get"); !ok {
+		t.Fatalf("expected gmail.labels.get to be disabled when --help fails")
+	}
+	for _, action := range []string{"gmail.search", "gmail.send", "calendar.freebusy"} {
+		if reason, ok := caps.DisabledReason(action); ok {
+			t.Fatalf("%s unexpectedly disabled: %s", action, reason)
+		}
+	}
+
+	caps, err = factory.Probe(context.Background(), "0.4.0", "0.9.0")
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if caps.Supported || len(caps.Problems) != 1 || !strings.Contains(caps.Problems[0], "outside the supported range") {
+		t.Fatalf("expected version to be out of range, got %+v", caps)
+	}
+}
@@ -0,0 +1,81 @@
+package gog
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts  = 3
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+)
+
+// RetryProvider retries transient failures of read-only actions. Writes are
+// never retried because gog may have applied them before failing.
+type RetryProvider struct {
+	Next        RunnerProvider
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p *RetryProvider) RunnerFor(account string) Runner {
+	return &retryRunner{next: p.Next.RunnerFor(account), provider: p}
+}
+
+type retryRunner struct {
+	next     Runner
+	provider *RetryProvider
+}
+
+func (r *retryRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	attempts := r.provider.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	if !IsReadOnly(action) {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var data any
+		data, err = r.next.Run(ctx, action, params)
+		if err == nil {
+			return data, nil
+		}
+		var gerr *Error
+		if !errors.As(err, &gerr) || !gerr.Transient() || attempt == attempts {
+			return nil, err
+		}
+		timer := time.NewTimer(r.provider.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+	return nil, err
+}
+
+func (p *RetryProvider) backoff(attempt int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	max := p.MaxDelay
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
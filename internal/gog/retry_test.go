@@ -0,0 +1,73 @@
+package gog
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+type flakyRunner struct {
+	calls    int
+	failures int
+	kind     ErrorKind
+}
+
+func (f *flakyRunner) RunnerFor(account string) Runner {
+	return f
+}
+
+func (f *flakyRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, &Error{Kind: f.kind}
+	}
+	return map[string]interface{}{}, nil
+}
+
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o700); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+}
+
+func TestRetryRunnerRetriesTransientReads(t *testing.T) {
+	next := &flakyRunner{failures: 2, kind: KindRateLimited}
+	runner := (&RetryProvider{Next: next, MaxAttempts: 3, BaseDelay: time.Millisecond}).RunnerFor("")
+	if _, err := runner.Run(context.Background(), "gmail.search", nil); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if next.calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", next.calls)
+	}
+}
+
+func TestRetryRunnerSkipsWritesAndPermanentErrors(t *testing.T) {
+	next := &flakyRunner{failures: 1, kind: KindNetwork}
+	runner := (&RetryProvider{Next: next, BaseDelay: time.Millisecond}).RunnerFor("")
+	if _, err := runner.Run(context.Background(), "gmail.send", nil); err == nil {
+		t.Fatalf("expected write failure to be returned")
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected no retry for writes, got %d calls", next.calls)
+	}
+
+	next = &flakyRunner{failures: 1, kind: KindAuthExpired}
+	runner = (&RetryProvider{Next: next, BaseDelay: time.Millisecond}).RunnerFor("")
+	if _, err := runner.Run(context.Background(), "gmail.search", nil); err == nil {
+		t.Fatalf("expected auth failure to be returned")
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected no retry for auth failures, got %d calls", next.calls)
+	}
+
+	next = &flakyRunner{failures: 1, kind: KindTimeout}
+	runner = (&RetryProvider{Next: next, BaseDelay: time.Millisecond}).RunnerFor("")
+	if _, err := runner.Run(context.Background(), "gmail.search", nil); err == nil {
+		t.Fatalf("expected timeout to be returned")
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected no retry for timeouts, got %d calls", next.calls)
+	}
+}
@@ -1,16 +1,17 @@
 package gog
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"gogcli-sandbox/internal/actions"
 )
 
 type Runner interface {
@@ -18,141 +19,25 @@ type Runner interface {
 }
 
 type GogRunner struct {
-	Path    string
-	Account string
-	Timeout time.Duration
-}
-
-type ActionSpec struct {
-	Command        []string
-	Positional     []string
-	ParamFlags     map[string]string
-	MultiValueFlag map[string]string
+	Path           string
+	Account        string
+	Timeout        time.Duration
+	Env            []string
+	Dir            string
+	MaxOutputBytes int
+	Limits         *Limits
+	Helper         string
+	Observer       func(action string, elapsed time.Duration, err error)
 }
 
-var actionSpecs = map[string]ActionSpec{
-	"gmail.search": {
-		Command:    []string{"gmail", "search"},
-		Positional: []string{"query"},
-		ParamFlags: map[string]string{
-			"max":    "--max",
-			"page":   "--page",
-			"oldest": "--oldest",
-		},
-	},
-	"gmail.thread.list": {
-		Command:    []string{"gmail", "search"},
-		Positional: []string{"query"},
-		ParamFlags: map[string]string{
-			"max":    "--max",
-			"page":   "--page",
-			"oldest": "--oldest",
-		},
-	},
-	"gmail.thread.get": {
-		Command:    []string{"gmail", "thread", "get"},
-		Positional: []string{"thread_id"},
-	},
-	"gmail.thread.modify": {
-		Command:    []string{"gmail", "thread", "modify"},
-		Positional: []string{"thread_id"},
-		ParamFlags: map[string]string{
-			"add":    "--add",
-			"remove": "--remove",
-		},
-	},
-	"gmail.get": {
-		Command:    []string{"gmail", "get"},
-		Positional: []string{"message_id"},
-		ParamFlags: map[string]string{
-			"format":  "--format",
-			"headers": "--headers",
-		},
-	},
-	"gmail.send": {
-		Command: []string{"gmail", "send"},
-		ParamFlags: map[string]string{
-			"to":                  "--to",
-			"cc":                  "--cc",
-			"bcc":                 "--bcc",
-			"subject":             "--subject",
-			"body":                "--body",
-			"body_html":           "--body-html",
-			"reply_to_message_id": "--reply-to-message-id",
-			"thread_id":           "--thread-id",
-			"reply_all":           "--reply-all",
-			"reply_to":            "--reply-to",
-			"from":                "--from",
-			"track":               "--track",
-			"track_split":         "--track-split",
-		},
-		MultiValueFlag: map[string]string{
-			"attach": "--attach",
-		},
-	},
-	"gmail.drafts.create": {
-		Command: []string{"gmail", "drafts", "create"},
-		ParamFlags: map[string]string{
-			"to":                  "--to",
-			"cc":                  "--cc",
-			"bcc":                 "--bcc",
-			"subject":             "--subject",
-			"body":                "--body",
-			"body_html":           "--body-html",
-			"reply_to_message_id": "--reply-to-message-id",
-			"reply_to":            "--reply-to",
-			"from":                "--from",
-		},
-		MultiValueFlag: map[string]string{
-			"attach": "--attach",
-		},
-	},
-	"gmail.labels.list": {
-		Command: []string{"gmail", "labels", "list"},
-	},
-	"gmail.labels.get": {
-		Command:    []string{"gmail", "labels", "get"},
-		Positional: []string{"label"},
-	},
-	"gmail.labels.modify": {
-		Command:    []string{"gmail", "labels", "modify"},
-		Positional: []string{"thread_ids"},
-		ParamFlags: map[string]string{
-			"add":    "--add",
-			"remove": "--remove",
-		},
-	},
-	"calendar.list": {
-		Command: []string{"calendar", "calendars"},
-		ParamFlags: map[string]string{
-			"max":  "--max",
-			"page": "--page",
-		},
-	},
-	"calendar.events": {
-		Command:    []string{"calendar", "events"},
-		Positional: []string{"calendar_id"},
-		ParamFlags: map[string]string{
-			"time_min": "--from",
-			"time_max": "--to",
-			"max":      "--max",
-			"page":     "--page",
-			"query":    "--query",
-		},
-	},
-	"calendar.freebusy": {
-		Command:    []string{"calendar", "freebusy"},
-		Positional: []string{"calendar_ids"},
-		ParamFlags: map[string]string{
-			"time_min": "--from",
-			"time_max": "--to",
-		},
-	},
+func IsReadOnly(action string) bool {
+	spec, ok := actions.Lookup(action)
+	return ok && spec.ReadOnly
 }
 
 func (g *GogRunner) Run(ctx context.Context, action string, params map[string]interface{}) (any, error) {
-	spec, ok := actionSpecs[action]
-	if !ok {
+	spec, ok := actions.Lookup(action)
+	if !ok || len(spec.Command) == 0 {
 		return nil, fmt.Errorf("no command mapping for action: %s", action)
 	}
 
@@ -176,26 +61,49 @@ func (g *GogRunner) Run(ctx context.Context, action string, params map[string]in
 	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, g.Path, baseArgs...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("gog failed: %w: %s", err, truncate(stderr.String(), 256))
+	cmd, err := g.command(ctx, baseArgs)
+	if err != nil {
+		return nil, err
 	}
-	if ctx.Err() != nil {
-		return nil, fmt.Errorf("gog timed out: %w", ctx.Err())
+	stdout := &cappedBuffer{max: g.maxOutput(), onOverflow: cancel}
+	stderr := &cappedBuffer{max: maxStderrBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	started := time.Now()
+	runErr := cmd.Run()
+	if err := g.runError(ctx, runErr, stdout, stderr); err != nil {
+		g.observe(action, started, err)
+		return nil, err
 	}
+	g.observe(action, started, nil)
 
 	var data any
 	if err := json.Unmarshal(stdout.Bytes(), &data); err != nil {
-		return nil, fmt.Errorf("invalid gog json: %w", err)
+		return nil, &Error{Kind: KindFailed, err: fmt.Errorf("invalid gog json: %w", err)}
 	}
 	return data, nil
 }
 
-func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error) {
+func (g *GogRunner) runError(ctx context.Context, runErr error, stdout, stderr *cappedBuffer) error {
+	if stdout.overflow {
+		return &Error{Kind: KindOutputTooLarge}
+	}
+	if runErr != nil {
+		return classifyFailure(ctx, runErr, stderr.String())
+	}
+	if ctx.Err() != nil {
+		return &Error{Kind: KindTimeout, err: ctx.Err()}
+	}
+	return nil
+}
+
+func (g *GogRunner) observe(action string, started time.Time, err error) {
+	if g.Observer != nil {
+		g.Observer(action, time.Since(started), err)
+	}
+}
+
+func buildArgs(spec actions.Spec, params map[string]interface{}) ([]string, error) {
 	args := []string{}
 	seen := map[string]struct{}{}
 
@@ -204,7 +112,7 @@ func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error)
 		if !ok {
 			return nil, fmt.Errorf("missing required param: %s", key)
 		}
-		argVals, err := normalizePositional(key, val)
+		argVals, err := normalizePositional(key, val, spec.Params[key].Type == actions.TypeStringList)
 		if err != nil {
 			return nil, fmt.Errorf("param %s: %w", key, err)
 		}
@@ -212,7 +120,7 @@ func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error)
 		seen[key] = struct{}{}
 	}
 
-	for key, flag := range spec.ParamFlags {
+	for key, flag := range spec.Flags {
 		if val, ok := params[key]; ok {
 			if b, ok := val.(bool); ok {
 				if b {
@@ -228,13 +136,18 @@ func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error)
 			if len(argVals) == 0 {
 				continue
 			}
-			args = append(args, flag)
-			args = append(args, argVals[0])
+			if len(argVals) > 1 {
+				if spec.Params[key].Type != actions.TypeStringList {
+					return nil, fmt.Errorf("param %s: expected a single value", key)
+				}
+				argVals = []string{strings.Join(argVals, ",")}
+			}
+			args = append(args, flag, argVals[0])
 			seen[key] = struct{}{}
 		}
 	}
 
-	for key, flag := range spec.MultiValueFlag {
+	for key, flag := range spec.MultiFlags {
 		if val, ok := params[key]; ok {
 			argVals, err := normalizeValue(val)
 			if err != nil {
@@ -252,10 +165,10 @@ func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error)
 		if _, ok := seen[key]; ok {
 			continue
 		}
-		if _, ok := spec.ParamFlags[key]; ok {
+		if _, ok := spec.Flags[key]; ok {
 			continue
 		}
-		if _, ok := spec.MultiValueFlag[key]; ok {
+		if _, ok := spec.MultiFlags[key]; ok {
 			continue
 		}
 		unknown = append(unknown, key)
@@ -268,7 +181,7 @@ func buildArgs(spec ActionSpec, params map[string]interface{}) ([]string, error)
 	return args, nil
 }
 
-func normalizePositional(key string, val interface{}) ([]string, error) {
+func normalizePositional(key string, val interface{}, list bool) ([]string, error) {
 	vals, err := normalizeValue(val)
 	if err != nil {
 		return nil, err
@@ -276,6 +189,9 @@ func normalizePositional(key string, val interface{}) ([]string, error) {
 	if len(vals) == 0 {
 		return nil, errors.New("empty value")
 	}
+	if len(vals) > 1 && !list {
+		return nil, errors.New("expected a single value")
+	}
 	switch key {
 	case "calendar_ids":
 		return []string{strings.Join(vals, ",")}, nil
@@ -289,6 +205,9 @@ func normalizeValue(val interface{}) ([]string, error) {
 	case string:
 		return []string{v}, nil
 	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
 		return []string{strconv.FormatInt(int64(v), 10)}, nil
 	case int:
 		return []string{strconv.Itoa(v)}, nil
@@ -297,6 +216,8 @@ func normalizeValue(val interface{}) ([]string, error) {
 			return []string{"true"}, nil
 		}
 		return []string{"false"}, nil
+	case []string:
+		return v, nil
 	case []interface{}:
 		out := make([]string, 0, len(v))
 		for _, item := range v {
@@ -311,10 +232,3 @@ func normalizeValue(val interface{}) ([]string, error) {
 		return nil, fmt.Errorf("unsupported value type %T", val)
 	}
 }
-
-func truncate(s string, max int) string {
-	if len(s) <= max {
-		return s
-	}
-	return s[:max]
-}
@@ -0,0 +1,32 @@
+package gog
+
+import (
+	"strings"
+	"testing"
+
+	"gogcli-sandbox/internal/actions"
+)
+
+func TestBuildArgsRejectsLossyValues(t *testing.T) {
+	search, _ := actions.Lookup("gmail.search")
+	if _, err := buildArgs(search, map[string]interface{}{"query": "in:inbox", "max": 10.7}); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Fatalf("expected fractional max to be rejected, got %v", err)
+	}
+	if _, err := buildArgs(search, map[string]interface{}{"query": []interface{}{"a", "b"}}); err == nil || !strings.Contains(err.Error(), "single value") {
+		t.Fatalf("expected list query to be rejected, got %v", err)
+	}
+	args, err := buildArgs(search, map[string]interface{}{"query": "in:inbox", "max": float64(25)})
+	if err != nil || strings.Join(args, " ") != "in:inbox --max 25" {
+		t.Fatalf("unexpected args %v (%v)", args, err)
+	}
+
+	modify, _ := actions.Lookup("gmail.labels.modify")
+	args, err = buildArgs(modify, map[string]interface{}{"thread_ids": []string{"t1", "t2"}, "add": "Work"})
+	if err != nil || strings.Join(args, " ") != "t1 t2 --add Work" {
+		t.Fatalf("unexpected args %v (%v)", args, err)
+	}
+	args, err = buildArgs(modify, map[string]interface{}{"thread_ids": "t1", "remove": []interface{}{"A", "B"}})
+	if err != nil || strings.Join(args, " ") != "t1 --remove A,B" {
+		t.Fatalf("unexpected args %v (%v)", args, err)
+	}
+}
@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit durations in seconds, from a cache hit to a slow gog
+// call.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Sample is one series of a function-backed metric.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and renders them in the Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	names   map[string]struct{}
+	metrics []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]struct{}{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.names[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = struct{}{}
+	r.metrics = append(r.metrics, c)
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, kind: "counter", labels: labels}, values: map[string]*counterSeries{}}
+	r.register(name, c)
+	return c
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{desc: desc{name: name, help: help, kind: "histogram", labels: labels}, buckets: append([]float64{}, buckets...), values: map[string]*histogramSeries{}}
+	sort.Float64s(h.buckets)
+	r.register(name, h)
+	return h
+}
+
+// GaugeFunc and CounterFunc read their series from fn at scrape time, for
+// state that already lives elsewhere (caches, limiters).
+func (r *Registry) GaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, fn: fn})
+}
+
+func (r *Registry) CounterFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "counter", labels: labels}, fn: fn})
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]collector{}, r.metrics...)
+	r.mu.Unlock()
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	if c == nil {
+		return
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &counterSeries{labels: append([]string{}, values...)}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, s := range c.values {
+		samples = append(samples, Sample{Labels: s.labels, Value: s.value})
+	}
+	c.mu.Unlock()
+	writeSamples(w, c.desc, samples)
+}
+
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	if h == nil {
+		return
+	}
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSeries{labels: append([]string{}, values...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	series := make([]histogramSeries, 0, len(h.values))
+	for _, s := range h.values {
+		series = append(series, histogramSeries{labels: s.labels, counts: append([]uint64{}, s.counts...), sum: s.sum, count: s.count})
+	}
+	h.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool { return lessLabels(series[i].labels, series[j].labels) })
+
+	h.header(w)
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+	for _, s := range series {
+		for i, bound := range h.buckets {
+			writeLine(w, h.name+"_bucket", bucketLabels, append(append([]string{}, s.labels...), formatFloat(bound)), float64(s.counts[i]))
+		}
+		writeLine(w, h.name+"_bucket", bucketLabels, append(append([]string{}, s.labels...), "+Inf"), float64(s.count))
+		writeLine(w, h.name+"_sum", h.labels, s.labels, s.sum)
+		writeLine(w, h.name+"_count", h.labels, s.labels, float64(s.count))
+	}
+}
+
+type funcMetric struct {
+	desc
+	fn func() []Sample
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	writeSamples(w, f.desc, f.fn())
+}
+
+func writeSamples(w *bufio.Writer, d desc, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool { return lessLabels(samples[i].Labels, samples[j].Labels) })
+	d.header(w)
+	for _, s := range samples {
+		if len(s.Labels) != len(d.labels) {
+			continue
+		}
+		writeLine(w, d.name, d.labels, s.Labels, s.Value)
+	}
+}
+
+func writeLine(w *bufio.Writer, name string, labels, values []string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeValue(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func lessLabels(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("requests_total", "Requests handled.", "action", "decision")
+	requests.Inc("gmail.search", "allow")
+	requests.Inc("gmail.search", "allow")
+	requests.Inc("gmail.send", "deny")
+	latency := reg.Histogram("duration_seconds", "Duration.", []float64{0.1, 1}, "action")
+	latency.Observe(0.05, "gmail.search")
+	latency.Observe(0.5, "gmail.search")
+	reg.GaugeFunc("queued", "Queued \"calls\".", []string{"account"}, func() []Sample {
+		return []Sample{{Labels: []string{`a"b`}, Value: 3}}
+	})
+
+	var out strings.Builder
+	if err := reg.WriteText(&out); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{action="gmail.search",decision="allow"} 2
+requests_total{action="gmail.send",decision="deny"} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{action="gmail.search",le="0.1"} 1
+duration_seconds_bucket{action="gmail.search",le="1"} 2
+duration_seconds_bucket{action="gmail.search",le="+Inf"} 2
+duration_seconds_sum{action="gmail.search"} 0.55
+duration_seconds_count{action="gmail.search"} 2
+# HELP queued Queued "calls".
+# TYPE queued gauge
+queued{account="a\"b"} 3
+`
+	if out.String() != want {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,307 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("pending send not found")
+	ErrInFlight = errors.New("pending send is already being delivered")
+)
+
+type Entry struct {
+	ID        string                 `json:"id"`
+	Account   string                 `json:"account"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Params    map[string]interface{} `json:"params"`
+	CreatedAt time.Time              `json:"created_at"`
+	SendAt    time.Time              `json:"send_at"`
+	Attempts  int                    `json:"attempts,omitempty"`
+}
+
+type Summary struct {
+	ID        string    `json:"id"`
+	Account   string    `json:"account"`
+	RequestID string    `json:"request_id,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Cc        string    `json:"cc,omitempty"`
+	Bcc       string    `json:"bcc,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	SendAt    time.Time `json:"send_at"`
+	Attempts  int       `json:"attempts,omitempty"`
+}
+
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*Entry
+	claimed map[string]struct{}
+	changed chan struct{}
+}
+
+type fileFormat struct {
+	Entries []*Entry `json:"entries"`
+}
+
+func Open(path string) (*Store, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("outbox path is empty")
+	}
+	s := &Store{path: path, entries: map[string]*Entry{}, claimed: map[string]struct{}{}, changed: make(chan struct{}, 1)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var payload fileFormat
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("invalid outbox json: %w", err)
+	}
+	for _, entry := range payload.Entries {
+		if entry == nil || entry.ID == "" {
+			continue
+		}
+		s.entries[entry.ID] = entry
+	}
+	return s, nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) Changed() <-chan struct{} {
+	return s.changed
+}
+
+func (s *Store) Add(entry Entry) (Entry, error) {
+	if entry.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.ID = id
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[entry.ID]; exists {
+		return Entry{}, fmt.Errorf("duplicate pending id %s", entry.ID)
+	}
+	stored := entry
+	s.entries[entry.ID] = &stored
+	if err := s.saveLocked(); err != nil {
+		delete(s.entries, entry.ID)
+		return Entry{}, err
+	}
+	s.notify()
+	return entry, nil
+}
+
+func (s *Store) Cancel(account, id string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[id]
+	if !ok || (account != "" && entry.Account != account) {
+		return Entry{}, ErrNotFound
+	}
+	if _, busy := s.claimed[id]; busy {
+		return Entry{}, ErrInFlight
+	}
+	delete(s.entries, id)
+	if err := s.saveLocked(); err != nil {
+		s.entries[id] = entry
+		return Entry{}, err
+	}
+	s.notify()
+	return *entry, nil
+}
+
+func (s *Store) Claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return false
+	}
+	if _, busy := s.claimed[id]; busy {
+		return false
+	}
+	s.claimed[id] = struct{}{}
+	return true
+}
+
+func (s *Store) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, id)
+}
+
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, id)
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, id)
+	return s.saveLocked()
+}
+
+func (s *Store) Reschedule(id string, sendAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, id)
+	entry, ok := s.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	entry.SendAt = sendAt
+	entry.Attempts++
+	return s.saveLocked()
+}
+
+// Postpone moves an entry's send time without counting a failed attempt.
+func (s *Store) Postpone(id string, sendAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, id)
+	entry, ok := s.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	entry.SendAt = sendAt
+	return s.saveLocked()
+}
+
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		out = append(out, *entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SendAt.Equal(out[j].SendAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].SendAt.Before(out[j].SendAt)
+	})
+	return out
+}
+
+func (s *Store) Due(now time.Time) []Entry {
+	due := []Entry{}
+	for _, entry := range s.List() {
+		if entry.SendAt.After(now) {
+			break
+		}
+		due = append(due, entry)
+	}
+	return due
+}
+
+func (s *Store) Next() (time.Time, bool) {
+	entries := s.List()
+	if len(entries) == 0 {
+		return time.Time{}, false
+	}
+	return entries[0].SendAt, true
+}
+
+func (e Entry) Summary() Summary {
+	str := func(key string) string {
+		switch v := e.Params[key].(type) {
+		case string:
+			return v
+		case []interface{}:
+			parts := []string{}
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					parts = append(parts, s)
+				}
+			}
+			return strings.Join(parts, ", ")
+		default:
+			return ""
+		}
+	}
+	return Summary{
+		ID:        e.ID,
+		Account:   e.Account,
+		RequestID: e.RequestID,
+		To:        str("to"),
+		Cc:        str("cc"),
+		Bcc:       str("bcc"),
+		Subject:   str("subject"),
+		CreatedAt: e.CreatedAt,
+		SendAt:    e.SendAt,
+		Attempts:  e.Attempts,
+	}
+}
+
+func (s *Store) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Store) saveLocked() error {
+	payload := fileFormat{Entries: make([]*Entry, 0, len(s.entries))}
+	for _, entry := range s.entries {
+		payload.Entries = append(payload.Entries, entry)
+	}
+	sort.Slice(payload.Entries, func(i, j int) bool { return payload.Entries[i].ID < payload.Entries[j].ID })
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".outbox-*.json")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, s.path)
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "pending_" + hex.EncodeToString(buf), nil
+}
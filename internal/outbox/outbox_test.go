@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePersistsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	now := time.Now().UTC()
+	entry, err := store.Add(Entry{Account: "a@example.com", Params: map[string]interface{}{"to": "b@example.com"}, SendAt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if entry.ID == "" {
+		t.Fatalf("expected id")
+	}
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	entries := reloaded.List()
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if due := reloaded.Due(now); len(due) != 0 {
+		t.Fatalf("expected nothing due yet")
+	}
+	if due := reloaded.Due(now.Add(2 * time.Minute)); len(due) != 1 {
+		t.Fatalf("expected entry to be due")
+	}
+}
+
+func TestStoreCancelChecksAccount(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	entry, err := store.Add(Entry{Account: "a@example.com", SendAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := store.Cancel("b@example.com", entry.ID); err != ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := store.Cancel("a@example.com", entry.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if len(store.List()) != 0 {
+		t.Fatalf("expected empty outbox")
+	}
+}
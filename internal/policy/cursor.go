@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gogcli-sandbox/internal/cursor"
+)
+
+// pageCursorKind keeps page cursors apart from other sealed cursors.
+const pageCursorKind = "page"
+
+// pageCursor is what the agent gets in place of an upstream page token. It
+// only unlocks the next page of the same rewritten query for the same
+// account and action, until it expires.
+type pageCursor struct {
+	Account string `json:"acct"`
+	Action  string `json:"act"`
+	Query   string `json:"q"`
+	Token   string `json:"tok"`
+	TimeMin string `json:"time_min,omitempty"`
+	TimeMax string `json:"time_max,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+type pageCursors struct {
+	account string
+	sealer  *cursor.Sealer
+	ttl     time.Duration
+}
+
+// SetPageCursors makes the policy hand out sealed page cursors instead of
+// raw page tokens and accept only those in params.page. Without it page
+// tokens pass through unchanged.
+func (p *Policy) SetPageCursors(account string, sealer *cursor.Sealer, ttl time.Duration) {
+	if p == nil {
+		return
+	}
+	if sealer == nil {
+		p.cursors = nil
+		return
+	}
+	p.cursors = &pageCursors{account: account, sealer: sealer, ttl: ttl}
+}
+
+// WrapPageToken seals an upstream page token for the rewritten params that
+// produced it.
+func (p *Policy) WrapPageToken(action string, params map[string]interface{}, token string) (string, error) {
+	if p == nil || p.cursors == nil || token == "" {
+		return token, nil
+	}
+	c := pageCursor{
+		Account: p.cursors.account,
+		Action:  action,
+		Query:   queryDigest(params),
+		Token:   token,
+		Expires: time.Now().Add(p.cursors.ttl).Unix(),
+	}
+	c.TimeMin, _ = getString(params, "time_min")
+	c.TimeMax, _ = getString(params, "time_max")
+	return p.cursors.sealer.Seal(pageCursorKind, c)
+}
+
+// openPageCursor opens params.page. Calendar ranges are pinned to the
+// window of the first page so that relative ranges ("today", defaults)
+// still match once time has moved on.
+func (p *Policy) openPageCursor(action string, params map[string]interface{}) (*pageCursor, error) {
+	if p == nil || p.cursors == nil {
+		return nil, nil
+	}
+	raw, ok := params["page"]
+	if !ok {
+		return nil, nil
+	}
+	page, ok := raw.(string)
+	if !ok || page == "" {
+		return nil, errors.New("params.page must be a page cursor")
+	}
+	var c pageCursor
+	if err := p.cursors.sealer.Open(pageCursorKind, page, &c); err != nil {
+		return nil, errors.New("invalid page cursor")
+	}
+	if c.Account != p.cursors.account || c.Action != action {
+		return nil, errors.New("page cursor was issued for a different query")
+	}
+	if time.Now().Unix() > c.Expires {
+		return nil, errors.New("page cursor expired")
+	}
+	if c.TimeMin != "" && c.TimeMax != "" {
+		cleanupTimeParams(params)
+		params["time_min"] = c.TimeMin
+		params["time_max"] = c.TimeMax
+	}
+	return &c, nil
+}
+
+// queryDigest identifies a rewritten query, ignoring the page and page size.
+func queryDigest(params map[string]interface{}) string {
+	query := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if k != "page" && k != "max" {
+			query[k] = v
+		}
+	}
+	data, _ := json.Marshal(query)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,280 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"gogcli-sandbox/internal/actions"
+)
+
+// Finding is one lint result. Errors make the policy unusable or unsafe;
+// warnings flag settings that have no effect or contradict each other.
+type Finding struct {
+	Severity string        `json:"severity"`
+	Account  string        `json:"account,omitempty"`
+	Extends  []ProfileTree `json:"extends,omitempty"`
+	Message  string        `json:"message"`
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Inventory lists the label ids or names and calendar ids that exist in an
+// account, so Lint can flag policy references to ones that do not.
+type Inventory struct {
+	Labels    []string
+	Calendars []string
+}
+
+// Lint checks a policy file without loading it. inventories is keyed by
+// account; the "" entry applies to accounts without their own.
+func Lint(data []byte, inventories map[string]*Inventory) []Finding {
+	l := &linter{}
+	var file setFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		l.errorf("", "%v", err)
+		if err := json.Unmarshal(data, &file); err != nil {
+			return l.findings
+		}
+	}
+	if len(file.Accounts) == 0 {
+		l.errorf("", "accounts must not be empty")
+	}
+
+	keys := make([]string, 0, len(file.Accounts))
+	for key := range file.Accounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	profiles := newProfileResolver(file.Profiles)
+	set := PolicySet{Accounts: map[string]*Policy{}, Clients: file.Clients}
+	for _, key := range keys {
+		account := normalizeAccount(key)
+		if account == "" {
+			l.errorf("", "accounts contains empty key")
+			continue
+		}
+		if _, dup := set.Accounts[account]; dup {
+			l.errorf(account, "duplicate account")
+		}
+		raw := file.Accounts[key]
+		if raw == nil {
+			l.errorf(account, "policy is null")
+			continue
+		}
+		obj, extends, err := profiles.resolve(raw)
+		if err != nil {
+			l.errorf(account, "%v", err)
+			continue
+		}
+		first := len(l.findings)
+		pol, err := decodePolicy(obj, true)
+		if err != nil {
+			l.errorf(account, "%v", err)
+			pol, err = decodePolicy(obj, false)
+		}
+		if err == nil {
+			set.Accounts[account] = pol
+			inv := inventories[account]
+			if inv == nil {
+				inv = inventories[""]
+			}
+			l.account(account, pol, inv)
+		}
+		for i := first; i < len(l.findings); i++ {
+			l.findings[i].Extends = extends
+		}
+	}
+
+	reached := maps.Clone(profiles.reached)
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !reached[name] {
+			if _, err := profiles.profile(name); err != nil {
+				l.errorf("", "%v", err)
+			} else {
+				l.warnf("", "profile %s is not used by any account", name)
+			}
+		}
+	}
+
+	if file.DefaultAccount != "" && set.Accounts[normalizeAccount(file.DefaultAccount)] == nil {
+		l.errorf("", "default_account %s not found", file.DefaultAccount)
+	}
+	if len(set.Accounts) > 0 {
+		if err := set.validateClients(); err != nil {
+			l.errorf("", "%v", err)
+		}
+	}
+	return l.findings
+}
+
+type linter struct {
+	findings []Finding
+}
+
+func (l *linter) errorf(account, format string, args ...any) {
+	l.findings = append(l.findings, Finding{Severity: SeverityError, Account: account, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(account, format string, args ...any) {
+	l.findings = append(l.findings, Finding{Severity: SeverityWarning, Account: account, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) account(account string, p *Policy, inv *Inventory) {
+	before := l.errors()
+	services := map[string]bool{}
+	allowed := map[string]bool{}
+	for _, action := range p.AllowedActions {
+		action = strings.TrimSpace(action)
+		if allowed[action] {
+			l.warnf(account, "action %s is listed twice", action)
+		}
+		allowed[action] = true
+		spec, ok := actions.Lookup(action)
+		if !ok {
+			if guess := closestAction(action); guess != "" {
+				l.errorf(account, "unknown action %q (did you mean %s?)", action, guess)
+			} else {
+				l.errorf(account, "unknown action %q", action)
+			}
+			continue
+		}
+		services[spec.Service] = true
+	}
+
+	if p.Gmail != nil && !services["gmail"] {
+		l.warnf(account, "gmail section is unused: no gmail action is allowed")
+	}
+	if p.Calendar != nil && !services["calendar"] {
+		l.warnf(account, "calendar section is unused: no calendar action is allowed")
+	}
+	if g := p.Gmail; g != nil {
+		for _, field := range []struct {
+			name  string
+			value int
+		}{{"max_days", g.MaxDays}, {"max_recipients", g.MaxRecipients}, {"send_delay_minutes", g.SendDelayMinutes}, {"max_iterate_items", g.MaxIterateItems}} {
+			if field.value < 0 {
+				l.errorf(account, "gmail.%s must not be negative (got %d)", field.name, field.value)
+			}
+		}
+		sends := allowed["gmail.send"]
+		if g.DraftOnly {
+			if len(g.AllowedSendRecipients) > 0 {
+				l.warnf(account, "gmail.allowed_send_recipients has no effect with draft_only: every send becomes a draft")
+			}
+			if g.ReplyRecipientsOnly {
+				l.warnf(account, "gmail.reply_recipients_only has no effect with draft_only: every send becomes a draft")
+			}
+			if g.SendDelayMinutes > 0 {
+				l.warnf(account, "gmail.send_delay_minutes has no effect with draft_only: drafts are never delayed")
+			}
+		}
+		if !sends && (len(g.AllowedSendRecipients) > 0 || g.ReplyRecipientsOnly || g.SendDelayMinutes > 0) {
+			l.warnf(account, "gmail send settings are unused: gmail.send is not allowed")
+		}
+		if (len(g.AllowedAddLabels) > 0 || len(g.AllowedRemoveLabels) > 0) && !allowed["gmail.thread.modify"] && !allowed["gmail.labels.modify"] {
+			l.warnf(account, "gmail.allowed_add_labels and allowed_remove_labels are unused: no modify action is allowed")
+		}
+		for _, rcpt := range g.AllowedSendRecipients {
+			if recipientMatchesAny(rcpt, g.DeniedSendRecipients) {
+				l.warnf(account, "gmail send recipient %s is both allowed and denied", rcpt)
+			}
+		}
+		if inv != nil && len(inv.Labels) > 0 {
+			for _, field := range []struct {
+				name   string
+				labels []string
+			}{{"allowed_read_labels", g.AllowedReadLabels}, {"allowed_add_labels", g.AllowedAddLabels}, {"allowed_remove_labels", g.AllowedRemoveLabels}} {
+				for _, label := range field.labels {
+					if !containsFold(inv.Labels, label) {
+						l.errorf(account, "gmail.%s: label %q not found", field.name, label)
+					}
+				}
+			}
+		}
+	}
+	if c := p.Calendar; c != nil {
+		if c.MaxDays < 0 {
+			l.errorf(account, "calendar.max_days must not be negative (got %d)", c.MaxDays)
+		}
+		if inv != nil && len(inv.Calendars) > 0 {
+			for _, id := range c.AllowedCalendars {
+				if !strings.EqualFold(id, "primary") && !containsFold(inv.Calendars, id) {
+					l.errorf(account, "calendar.allowed_calendars: calendar %q not found", id)
+				}
+			}
+		}
+	}
+
+	// Validate catches what the checks above do not, such as bad extra
+	// headers; its first error would only repeat one of theirs.
+	if l.errors() == before {
+		if err := p.Validate(); err != nil {
+			l.errorf(account, "%v", err)
+		}
+	}
+}
+
+func (l *linter) errors() int {
+	n := 0
+	for _, f := range l.findings {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+func containsFold(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// closestAction suggests the known action nearest to a misspelled name.
+func closestAction(name string) string {
+	best, bestDist := "", 3
+	for _, known := range actions.Names() {
+		if d := editDistance(name, known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintFlagsTyposConflictsAndMissingLabels(t *testing.T) {
+	data := []byte(`{
+  "accounts": {
+    "User@Example.com": {
+      "allowed_actions": ["gmail.serach", "gmail.send"],
+      "gmail": { "max_days": -1, "draft_only": true, "allowed_send_recipients": ["*@example.com"], "allowed_read_labels": ["INBOX", "Label_9"] },
+      "calendar": { "allowed_calendars": ["primary"] }
+    }
+  },
+  "clients": { "agent-1": { "accounts": ["user@example.com"] } }
+}`)
+	findings := Lint(data, map[string]*Inventory{"": {Labels: []string{"INBOX", "Label_1"}}})
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Severity+": "+f.Message)
+	}
+	want := []string{
+		`error: unknown action "gmail.serach" (did you mean gmail.search?)`,
+		"warning: calendar section is unused: no calendar action is allowed",
+		"error: gmail.max_days must not be negative (got -1)",
+		"warning: gmail.allowed_send_recipients has no effect with draft_only: every send becomes a draft",
+		`error: gmail.allowed_read_labels: label "Label_9" not found`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected findings:\n%s", strings.Join(got, "\n"))
+	}
+	if findings[0].Account != "user@example.com" {
+		t.Fatalf("expected normalized account, got %q", findings[0].Account)
+	}
+}
+
+func TestLintRejectsUnknownFields(t *testing.T) {
+	findings := Lint([]byte(`{"accounts": {"a@example.com": {"allowed_actions": ["gmail.search"], "gmail": {"max_day": 7}}}}`), nil)
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, `unknown field "max_day"`) {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+}
+
+func TestLintReportsProfileChainAndUnusedProfiles(t *testing.T) {
+	findings := Lint([]byte(`{
+  "profiles": {
+    "base": { "allowed_actions": ["calendar.list"], "calendar": { "max_days": -1 } },
+    "spare": { "allowed_actions": ["gmail.search"] }
+  },
+  "accounts": { "a@example.com": { "extends": "base" } }
+}`), nil)
+	if len(findings) != 2 {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+	if f := findings[0]; f.Account != "a@example.com" || FormatExtends(f.Extends) != "base" || !strings.Contains(f.Message, "calendar.max_days") {
+		t.Fatalf("unexpected account finding: %+v", f)
+	}
+	if f := findings[1]; f.Severity != SeverityWarning || f.Message != "profile spare is not used by any account" {
+		t.Fatalf("unexpected profile finding: %+v", f)
+	}
+}
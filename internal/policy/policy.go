@@ -11,9 +11,13 @@ import (
 	"sync"
 	"time"
 
+	"gogcli-sandbox/internal/actions"
 	"gogcli-sandbox/internal/timerange"
+	"gogcli-sandbox/internal/trace"
 )
 
+const DefaultMaxIterateItems = 200
+
 type Policy struct {
 	AllowedActions []string        `json:"allowed_actions"`
 	Gmail          *GmailPolicy    `json:"gmail,omitempty"`
@@ -24,25 +28,39 @@ type Policy struct {
 	labelNameToID    map[string]string
 	labelMu          sync.RWMutex
 	timeZoneProvider func(context.Context) (*time.Location, error)
+	replyProvider    func(context.Context, string) ([]string, error)
+	labelRefresher   func(context.Context) error
+	cursors          *pageCursors
 }
 
 type GmailPolicy struct {
-	AllowedReadLabels     []string `json:"allowed_read_labels"`
-	AllowedAddLabels      []string `json:"allowed_add_labels"`
-	AllowedRemoveLabels   []string `json:"allowed_remove_labels"`
-	AllowedSenders        []string `json:"allowed_senders"`
-	AllowedSendRecipients []string `json:"allowed_send_recipients"`
-	MaxDays               int      `json:"max_days"`
-	AllowBody             bool     `json:"allow_body"`
-	AllowLinks            bool     `json:"allow_links"`
-	DraftOnly             bool     `json:"draft_only"`
-	AllowAttachments      bool     `json:"allow_attachments"`
+	AllowedReadLabels     []string          `json:"allowed_read_labels"`
+	AllowedAddLabels      []string          `json:"allowed_add_labels"`
+	AllowedRemoveLabels   []string          `json:"allowed_remove_labels"`
+	AllowedSenders        []string          `json:"allowed_senders"`
+	AllowedSendRecipients []string          `json:"allowed_send_recipients"`
+	MaxDays               int               `json:"max_days"`
+	AllowBody             bool              `json:"allow_body"`
+	AllowLinks            bool              `json:"allow_links"`
+	DraftOnly             bool              `json:"draft_only"`
+	AllowAttachments      bool              `json:"allow_attachments"`
+	DeniedSendRecipients  []string          `json:"denied_send_recipients"`
+	MaxRecipients         int               `json:"max_recipients"`
+	RecipientFields       *RecipientFields  `json:"recipient_fields,omitempty"`
+	ReplyRecipientsOnly   bool              `json:"reply_recipients_only"`
+	SendDelayMinutes      int               `json:"send_delay_minutes"`
+	SubjectPrefix         string            `json:"subject_prefix"`
+	BodyFooter            string            `json:"body_footer"`
+	BodyFooterHTML        string            `json:"body_footer_html"`
+	ExtraHeaders          map[string]string `json:"extra_headers"`
+	MaxIterateItems       int               `json:"max_iterate_items"`
 }
 
 type CalendarPolicy struct {
 	AllowedCalendars []string `json:"allowed_calendars"`
 	AllowDetails     bool     `json:"allow_details"`
 	MaxDays          int      `json:"max_days"`
+	MaxIterateItems  int      `json:"max_iterate_items"`
 }
 
 func (p *Policy) Validate() error {
@@ -58,10 +76,14 @@ func (p *Policy) Validate() error {
 			return errors.New("allowed_actions contains empty action")
 		}
 		p.allowedActionSet[action] = struct{}{}
-		if strings.HasPrefix(action, "gmail.") {
-			needsGmail = true
+		spec, ok := actions.Lookup(action)
+		if !ok {
+			return fmt.Errorf("allowed action %s has no action spec", action)
 		}
-		if strings.HasPrefix(action, "calendar.") {
+		switch spec.Service {
+		case "gmail":
+			needsGmail = true
+		case "calendar":
 			needsCalendar = true
 		}
 	}
@@ -71,6 +93,23 @@ func (p *Policy) Validate() error {
 	if needsCalendar && p.Calendar == nil {
 		return errors.New("calendar policy is required for calendar actions")
 	}
+	if p.Gmail != nil {
+		if err := validateExtraHeaders(p.Gmail.ExtraHeaders); err != nil {
+			return err
+		}
+		if err := validateRecipientRules(p.Gmail); err != nil {
+			return err
+		}
+		if p.Gmail.SendDelayMinutes < 0 {
+			return errors.New("send_delay_minutes must not be negative")
+		}
+		if p.Gmail.MaxIterateItems < 0 {
+			return errors.New("gmail.max_iterate_items must not be negative")
+		}
+	}
+	if p.Calendar != nil && p.Calendar.MaxIterateItems < 0 {
+		return errors.New("calendar.max_iterate_items must not be negative")
+	}
 	return nil
 }
 
@@ -128,6 +167,20 @@ func (p *Policy) SetTimeZoneProvider(fn func(context.Context) (*time.Location, e
 	p.timeZoneProvider = fn
 }
 
+func (p *Policy) SetLabelRefresher(fn func(context.Context) error) {
+	if p == nil {
+		return
+	}
+	p.labelRefresher = fn
+}
+
+func (p *Policy) SetReplyRecipientsProvider(fn func(context.Context, string) ([]string, error)) {
+	if p == nil {
+		return
+	}
+	p.replyProvider = fn
+}
+
 func (p *Policy) IsActionAllowed(action string) bool {
 	_, ok := p.allowedActionSet[action]
 	return ok
@@ -137,6 +190,22 @@ func (p *Policy) ValidateAndRewrite(ctx context.Context, action string, params m
 	if params == nil {
 		params = map[string]interface{}{}
 	}
+	page, err := p.openPageCursor(action, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, warnings, err := p.rewrite(ctx, action, params)
+	if err != nil || page == nil {
+		return params, warnings, err
+	}
+	if queryDigest(params) != page.Query {
+		return nil, nil, errors.New("page cursor was issued for a different query")
+	}
+	params["page"] = page.Token
+	return params, warnings, nil
+}
+
+func (p *Policy) rewrite(ctx context.Context, action string, params map[string]interface{}) (map[string]interface{}, []string, error) {
 	warnings := []string{}
 
 	switch action {
@@ -145,19 +214,21 @@ func (p *Policy) ValidateAndRewrite(ctx context.Context, action string, params m
 	case "gmail.thread.get":
 		return p.rewriteGmailThreadGet(params, warnings)
 	case "gmail.thread.modify":
-		return p.rewriteGmailThreadModify(params, warnings)
+		return p.rewriteGmailThreadModify(ctx, params, warnings)
 	case "gmail.get":
 		return p.rewriteGmailGet(params, warnings)
 	case "gmail.send":
-		return p.rewriteGmailSend(params, warnings)
+		return p.rewriteGmailSend(ctx, params, warnings)
 	case "gmail.drafts.create":
 		return p.rewriteGmailDraftCreate(params, warnings)
+	case "gmail.send.cancel":
+		return p.rewriteGmailSendCancel(params, warnings)
 	case "gmail.labels.list":
 		return params, warnings, nil
 	case "gmail.labels.get":
-		return p.rewriteGmailLabelsGet(params, warnings)
+		return p.rewriteGmailLabelsGet(ctx, params, warnings)
 	case "gmail.labels.modify":
-		return p.rewriteGmailLabelsModify(params, warnings)
+		return p.rewriteGmailLabelsModify(ctx, params, warnings)
 	case "calendar.list":
 		return params, warnings, nil
 	case "calendar.events":
@@ -169,8 +240,15 @@ func (p *Policy) ValidateAndRewrite(ctx context.Context, action string, params m
 			return nil, nil, errors.New("params must be empty")
 		}
 		return params, warnings, nil
+	case "policy.schema", "policy.explain":
+		return params, warnings, nil
 	default:
-		return nil, nil, fmt.Errorf("unsupported action: %s", action)
+		// Actions from the operator's spec file have no rewriter; the broker
+		// has already checked their params against the schema.
+		if _, ok := actions.Lookup(action); !ok || actions.IsBuiltin(action) {
+			return nil, nil, fmt.Errorf("unsupported action: %s", action)
+		}
+		return params, warnings, nil
 	}
 }
 
@@ -220,7 +298,7 @@ func (p *Policy) rewriteGmailThreadGet(params map[string]interface{}, warnings [
 	return nil, nil, errors.New("params.id or params.thread_id is required")
 }
 
-func (p *Policy) rewriteGmailThreadModify(params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
+func (p *Policy) rewriteGmailThreadModify(ctx context.Context, params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
 	threadID, ok := getStringAny(params, "thread_id", "id")
 	if !ok || strings.TrimSpace(threadID) == "" {
 		return nil, nil, errors.New("params.thread_id is required")
@@ -231,10 +309,10 @@ func (p *Policy) rewriteGmailThreadModify(params map[string]interface{}, warning
 	if len(addLabels) == 0 && len(removeLabels) == 0 {
 		return nil, nil, errors.New("params.add or params.remove is required")
 	}
-	if err := p.validateLabels(addLabels, p.Gmail.AllowedAddLabels, "add", false); err != nil {
+	if err := p.validateLabels(ctx, addLabels, p.Gmail.AllowedAddLabels, "add", false); err != nil {
 		return nil, nil, err
 	}
-	if err := p.validateLabels(removeLabels, p.Gmail.AllowedRemoveLabels, "remove", false); err != nil {
+	if err := p.validateLabels(ctx, removeLabels, p.Gmail.AllowedRemoveLabels, "remove", false); err != nil {
 		return nil, nil, err
 	}
 
@@ -270,7 +348,7 @@ func (p *Policy) rewriteGmailGet(params map[string]interface{}, warnings []strin
 	return params, warnings, nil
 }
 
-func (p *Policy) rewriteGmailSend(params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
+func (p *Policy) rewriteGmailSend(ctx context.Context, params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
 	if p.Gmail == nil {
 		return nil, nil, errors.New("gmail policy missing")
 	}
@@ -294,9 +372,16 @@ func (p *Policy) rewriteGmailSend(params map[string]interface{}, warnings []stri
 		return nil, nil, errors.New("attachments are not allowed")
 	}
 
-	if reason := p.draftSendReason(params); reason != "" {
+	if err := p.checkRecipients(params); err != nil {
+		return nil, nil, err
+	}
+	if reason := p.draftSendReason(ctx, params); reason != "" {
 		warnings = append(warnings, "draft_only:"+reason)
 	}
+	if _, ok := params["headers"]; ok {
+		return nil, nil, errors.New("custom headers are not allowed")
+	}
+	warnings = p.applyOutgoingMarkers(params, warnings)
 	return params, warnings, nil
 }
 
@@ -322,23 +407,62 @@ func (p *Policy) rewriteGmailDraftCreate(params map[string]interface{}, warnings
 	if _, ok := params["attach"]; ok && !p.Gmail.AllowAttachments {
 		return nil, nil, errors.New("attachments are not allowed")
 	}
+	if err := p.checkRecipients(params); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := params["headers"]; ok {
+		return nil, nil, errors.New("custom headers are not allowed")
+	}
+	warnings = p.applyOutgoingMarkers(params, warnings)
 	return params, warnings, nil
 }
 
-func (p *Policy) rewriteGmailLabelsGet(params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
+func (p *Policy) rewriteGmailSendCancel(params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
+	id, ok := getStringAny(params, "id", "pending_id")
+	if !ok || strings.TrimSpace(id) == "" {
+		return nil, nil, errors.New("params.id is required")
+	}
+	return map[string]interface{}{"id": strings.TrimSpace(id)}, warnings, nil
+}
+
+func (p *Policy) SendDelay() time.Duration {
+	if p == nil || p.Gmail == nil || p.Gmail.SendDelayMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(p.Gmail.SendDelayMinutes) * time.Minute
+}
+
+// MaxIterateItems caps how many items one iterate call may return for action.
+func (p *Policy) MaxIterateItems(action string) int {
+	limit := 0
+	if spec, ok := actions.Lookup(action); ok && p != nil {
+		switch {
+		case spec.Service == "gmail" && p.Gmail != nil:
+			limit = p.Gmail.MaxIterateItems
+		case spec.Service == "calendar" && p.Calendar != nil:
+			limit = p.Calendar.MaxIterateItems
+		}
+	}
+	if limit <= 0 {
+		return DefaultMaxIterateItems
+	}
+	return limit
+}
+
+func (p *Policy) rewriteGmailLabelsGet(ctx context.Context, params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
 	label, ok := getStringAny(params, "label", "label_id", "id")
 	if !ok || strings.TrimSpace(label) == "" {
 		return nil, nil, errors.New("params.label is required")
 	}
 	label = strings.TrimSpace(label)
-	if err := p.validateLabels([]string{label}, p.Gmail.AllowedReadLabels, "read", true); err != nil {
+	if err := p.validateLabels(ctx, []string{label}, p.Gmail.AllowedReadLabels, "read", true); err != nil {
 		return nil, nil, err
 	}
 	params["label"] = label
 	return params, warnings, nil
 }
 
-func (p *Policy) rewriteGmailLabelsModify(params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
+func (p *Policy) rewriteGmailLabelsModify(ctx context.Context, params map[string]interface{}, warnings []string) (map[string]interface{}, []string, error) {
 	threadIDs, ok := getStringSlice(params, "thread_ids")
 	if !ok {
 		if tid, ok := getStringAny(params, "thread_id", "id"); ok {
@@ -354,10 +478,10 @@ func (p *Policy) rewriteGmailLabelsModify(params map[string]interface{}, warning
 	if len(addLabels) == 0 && len(removeLabels) == 0 {
 		return nil, nil, errors.New("params.add or params.remove is required")
 	}
-	if err := p.validateLabels(addLabels, p.Gmail.AllowedAddLabels, "add", false); err != nil {
+	if err := p.validateLabels(ctx, addLabels, p.Gmail.AllowedAddLabels, "add", false); err != nil {
 		return nil, nil, err
 	}
-	if err := p.validateLabels(removeLabels, p.Gmail.AllowedRemoveLabels, "remove", false); err != nil {
+	if err := p.validateLabels(ctx, removeLabels, p.Gmail.AllowedRemoveLabels, "remove", false); err != nil {
 		return nil, nil, err
 	}
 
@@ -371,14 +495,14 @@ func (p *Policy) rewriteGmailLabelsModify(params map[string]interface{}, warning
 	return params, warnings, nil
 }
 
-func (p *Policy) DraftSendRequired(params map[string]interface{}) bool {
+func (p *Policy) DraftSendRequired(ctx context.Context, params map[string]interface{}) bool {
 	if p == nil || p.Gmail == nil {
 		return false
 	}
-	return p.draftSendReason(params) != ""
+	return p.draftSendReason(ctx, params) != ""
 }
 
-func (p *Policy) validateLabels(labels []string, allowed []string, mode string, allowEmpty bool) error {
+func (p *Policy) validateLabels(ctx context.Context, labels []string, allowed []string, mode string, allowEmpty bool) error {
 	if len(labels) == 0 {
 		return nil
 	}
@@ -391,18 +515,34 @@ func (p *Policy) validateLabels(labels []string, allowed []string, mode string,
 		}
 		return fmt.Errorf("no labels allowed for %s", mode)
 	}
+	refreshed := false
 	for _, label := range labels {
 		label = strings.TrimSpace(label)
 		if label == "" {
 			continue
 		}
-		if !p.isLabelAllowed(label, allowed) {
-			return fmt.Errorf("label not allowed: %s", label)
+		if p.isLabelAllowed(label, allowed) {
+			continue
+		}
+		if !refreshed && p.labelRefresher != nil && !p.isLabelKnown(label) {
+			refreshed = true
+			if err := p.labelRefresher(ctx); err == nil && p.isLabelAllowed(label, allowed) {
+				continue
+			}
 		}
+		return fmt.Errorf("label not allowed: %s", label)
 	}
 	return nil
 }
 
+func (p *Policy) isLabelKnown(label string) bool {
+	if _, ok := p.LabelIDForName(label); ok {
+		return true
+	}
+	_, ok := p.LabelNameForID(label)
+	return ok
+}
+
 func (p *Policy) isLabelAllowed(label string, allowed []string) bool {
 	if p == nil || p.Gmail == nil {
 		return false
@@ -439,22 +579,39 @@ func (p *Policy) isLabelAllowed(label string, allowed []string) bool {
 	return false
 }
 
-func (p *Policy) draftSendReason(params map[string]interface{}) string {
+func (p *Policy) draftSendReason(ctx context.Context, params map[string]interface{}) string {
 	if p == nil || p.Gmail == nil {
 		return ""
 	}
 	if p.Gmail.DraftOnly {
 		return "policy"
 	}
-	if len(p.Gmail.AllowedSendRecipients) == 0 {
-		return ""
+	if p.Gmail.ReplyRecipientsOnly {
+		if reason := p.replyRecipientsReason(ctx, params); reason != "" {
+			return reason
+		}
 	}
-	recipients, ok := collectRecipients(params)
-	if !ok {
-		return "recipients_missing"
+	if len(p.Gmail.AllowedSendRecipients) > 0 {
+		recipients, err := collectRecipients(params)
+		if err != nil {
+			return "recipient_invalid"
+		}
+		if len(recipients) == 0 {
+			return "recipients_missing"
+		}
+		if !recipientsAllowed(recipients, p.Gmail.AllowedSendRecipients) {
+			return "recipient_not_allowed"
+		}
 	}
-	if !recipientsAllowed(recipients, p.Gmail.AllowedSendRecipients) {
-		return "recipient_not_allowed"
+	for _, field := range recipientFieldNames {
+		rule := p.Gmail.RecipientFields.rule(field)
+		if rule == nil || len(rule.Allowed) == 0 {
+			continue
+		}
+		recipients, err := fieldRecipients(params, field)
+		if err != nil || !recipientsAllowed(recipients, rule.Allowed) {
+			return "recipient_not_allowed:" + field
+		}
 	}
 	return ""
 }
@@ -668,7 +825,9 @@ func parseAbsoluteTime(val string) (time.Time, bool) {
 }
 
 func cleanupTimeParams(params map[string]interface{}) {
-	cleanupTimeParams(params)
+	for _, key := range []string{"from", "to", "today", "tomorrow", "week", "days", "week_start"} {
+		delete(params, key)
+	}
 }
 
 func (p *Policy) resolveCalendarRange(ctx context.Context, params map[string]interface{}, require bool) ([]string, error) {
@@ -735,7 +894,10 @@ func (p *Policy) resolveCalendarRange(ctx context.Context, params map[string]int
 	if p.timeZoneProvider == nil {
 		return nil, errors.New("timezone provider not configured")
 	}
-	loc, err := p.timeZoneProvider(ctx)
+	tzCtx, span := trace.Start(ctx, "policy.timezone")
+	loc, err := p.timeZoneProvider(tzCtx)
+	span.SetError(err)
+	span.Finish()
 	if err != nil {
 		return nil, err
 	}
@@ -758,72 +920,72 @@ func (p *Policy) resolveCalendarRange(ctx context.Context, params map[string]int
 		}
 	}
 
-	delete(params, "from")
-	delete(params, "to")
-	delete(params, "time_min")
-	delete(params, "time_max")
-	delete(params, "today")
-	delete(params, "tomorrow")
-	delete(params, "week")
-	delete(params, "days")
-	delete(params, "week_start")
-
+	cleanupTimeParams(params)
 	params["time_min"] = tr.From.Format(time.RFC3339)
 	params["time_max"] = tr.To.Format(time.RFC3339)
 	return nil, nil
 }
 
-func collectRecipients(params map[string]interface{}) ([]string, bool) {
+func collectRecipients(params map[string]interface{}) ([]string, error) {
 	recipients := []string{}
-	for _, key := range []string{"to", "cc", "bcc"} {
-		raw, ok := params[key]
-		if !ok || raw == nil {
-			continue
+	for _, key := range recipientFieldNames {
+		list, err := fieldRecipients(params, key)
+		if err != nil {
+			return nil, err
 		}
-		switch v := raw.(type) {
-		case string:
-			recipients = append(recipients, splitRecipients(v)...)
-		case []interface{}:
-			for _, item := range v {
-				if s, ok := item.(string); ok {
-					recipients = append(recipients, splitRecipients(s)...)
-				}
+		recipients = append(recipients, list...)
+	}
+	return recipients, nil
+}
+
+// fieldRecipients returns the lowercased addresses in one recipient field.
+// An entry that does not parse as an address list is an error, so callers
+// never match rules against a raw fragment.
+func fieldRecipients(params map[string]interface{}, key string) ([]string, error) {
+	recipients := []string{}
+	raw, ok := params[key]
+	if !ok || raw == nil {
+		return recipients, nil
+	}
+	var entries []string
+	switch v := raw.(type) {
+	case string:
+		entries = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				entries = append(entries, s)
 			}
 		}
 	}
-	if len(recipients) == 0 {
-		return nil, false
+	for _, entry := range entries {
+		list, err := parseRecipients(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s recipient %q", key, strings.TrimSpace(entry))
+		}
+		recipients = append(recipients, list...)
 	}
-	return recipients, true
+	return recipients, nil
 }
 
-func splitRecipients(input string) []string {
-	out := []string{}
-	for _, part := range strings.Split(input, ",") {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
-		addr, err := mail.ParseAddress(part)
-		if err == nil && addr != nil && addr.Address != "" {
-			out = append(out, strings.ToLower(addr.Address))
-			continue
-		}
-		out = append(out, strings.ToLower(part))
+func parseRecipients(input string) ([]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
 	}
-	return out
+	list, err := mail.ParseAddressList(input)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(list))
+	for _, addr := range list {
+		out = append(out, strings.ToLower(addr.Address))
+	}
+	return out, nil
 }
 
 func recipientsAllowed(recipients []string, allowed []string) bool {
-	allowedSet := map[string]struct{}{}
-	for _, addr := range allowed {
-		addr = strings.ToLower(strings.TrimSpace(addr))
-		if addr != "" {
-			allowedSet[addr] = struct{}{}
-		}
-	}
 	for _, rcpt := range recipients {
-		if _, ok := allowedSet[strings.ToLower(rcpt)]; !ok {
+		if !recipientMatchesAny(rcpt, allowed) {
 			return false
 		}
 	}
@@ -3,6 +3,9 @@ package policy
 import (
 	"context"
 	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/cursor"
 )
 
 func TestRewriteGmailQueryAddsNewerThan(t *testing.T) {
@@ -132,3 +135,287 @@ func TestRewriteGmailLabelsModifyRejectsDisallowed(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestRewriteGmailSendAppliesOutgoingMarkers(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{
+		SubjectPrefix: "[bot]",
+		BodyFooter:    "Sent by an agent.",
+		ExtraHeaders:  map[string]string{"X-Agent": "gogcli-sandbox"},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "a@b.com", "subject": "hi", "body": "yo", "body_html": "<html><body>yo</body></html>"}
+	out, warnings, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if out["subject"] != "[bot] hi" {
+		t.Fatalf("unexpected subject: %v", out["subject"])
+	}
+	if out["body"] != "yo\n\nSent by an agent." {
+		t.Fatalf("unexpected body: %q", out["body"])
+	}
+	if out["body_html"] != "<html><body>yo<p>Sent by an agent.</p></body></html>" {
+		t.Fatalf("unexpected html body: %q", out["body_html"])
+	}
+	headers := out["headers"].([]interface{})
+	if len(headers) != 1 || headers[0] != "X-Agent: gogcli-sandbox" {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("expected 3 warnings, got %v", warnings)
+	}
+}
+
+func TestRewriteGmailSendFooterOnlySkippedAtEnd(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{BodyFooter: "Sent by an agent."}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "a@b.com", "body": "Sent by an agent. Not really.", "body_html": "<p>Sent by an agent.</p><p>Not really.</p>"}
+	out, _, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if out["body"] != "Sent by an agent. Not really.\n\nSent by an agent." {
+		t.Fatalf("expected footer after quoted text, got %q", out["body"])
+	}
+	if out["body_html"] != "<p>Sent by an agent.</p><p>Not really.</p><p>Sent by an agent.</p>" {
+		t.Fatalf("expected html footer after quoted text, got %q", out["body_html"])
+	}
+
+	params = map[string]interface{}{"to": "a@b.com", "body": "hi\n\nSent by an agent.\n", "body_html": "<body>hi<p>Sent by an agent.</p></body>"}
+	out, warnings, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if out["body"] != "hi\n\nSent by an agent.\n" || out["body_html"] != "<body>hi<p>Sent by an agent.</p></body>" || len(warnings) != 0 {
+		t.Fatalf("expected existing footers to be kept, got %q %q %v", out["body"], out["body_html"], warnings)
+	}
+}
+
+func TestRewriteGmailSendDerivesPlainFooterFromHTML(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{BodyFooterHTML: `<b>Sent by an agent</b><br>for <a href="https://example.com">Tom &amp; Co</a>`}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	out, warnings, err := p.ValidateAndRewrite(context.Background(), "gmail.send", map[string]interface{}{"to": "a@b.com", "body": "hi"})
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if out["body"] != "hi\n\nSent by an agent\nfor Tom & Co" || len(warnings) != 1 {
+		t.Fatalf("expected plain footer from html, got %q %v", out["body"], warnings)
+	}
+	if _, ok := out["body_html"]; ok {
+		t.Fatalf("expected no html body to be added, got %q", out["body_html"])
+	}
+}
+
+func TestRewriteGmailDraftCreateRejectsAgentHeaders(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.drafts.create"}, Gmail: &GmailPolicy{ExtraHeaders: map[string]string{"X-Agent": "bot"}}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "a@b.com", "headers": []interface{}{"X-Agent: human"}}
+	_, _, err := p.ValidateAndRewrite(context.Background(), "gmail.drafts.create", params)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestValidateRejectsReservedExtraHeader(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{ExtraHeaders: map[string]string{"subject": "x"}}}
+	if err := p.Validate(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRewriteGmailSendAllowlistDomainWildcard(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{AllowedSendRecipients: []string{"*@example.com"}}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "Alice <alice@example.com>", "subject": "hi", "body": "yo"}
+	if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if p.DraftSendRequired(context.Background(), params) {
+		t.Fatalf("expected direct send to be allowed")
+	}
+	params = map[string]interface{}{"to": "alice@example.org", "subject": "hi", "body": "yo"}
+	if !p.DraftSendRequired(context.Background(), params) {
+		t.Fatalf("expected draft for other domain")
+	}
+}
+
+func TestRewriteGmailDraftCreateRejectsDeniedRecipient(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.drafts.create"}, Gmail: &GmailPolicy{DeniedSendRecipients: []string{"*@competitor.com"}}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "a@b.com", "cc": "ceo@competitor.com"}
+	_, _, err := p.ValidateAndRewrite(context.Background(), "gmail.drafts.create", params)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRewriteGmailDraftCreateParsesRecipientLists(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.drafts.create"}, Gmail: &GmailPolicy{DeniedSendRecipients: []string{"*@competitor.com"}}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for _, to := range []string{`"Smith, Jo" <ceo@competitor.com>`, `ceo@competitor.com <`} {
+		params := map[string]interface{}{"to": to}
+		if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.drafts.create", params); err == nil {
+			t.Fatalf("expected %q to be rejected", to)
+		}
+	}
+	params := map[string]interface{}{"to": `"Smith, Jo" <jo@example.com>, a@b.com`}
+	if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.drafts.create", params); err != nil {
+		t.Fatalf("expected quoted comma to parse: %v", err)
+	}
+}
+
+func TestRewriteGmailSendRecipientCaps(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{
+		MaxRecipients:   2,
+		RecipientFields: &RecipientFields{Bcc: &RecipientRule{Forbidden: true}},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	params := map[string]interface{}{"to": "a@b.com", "bcc": "c@d.com"}
+	if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params); err == nil {
+		t.Fatalf("expected bcc to be rejected")
+	}
+	params = map[string]interface{}{"to": "a@b.com, c@d.com", "cc": "e@f.com"}
+	if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.send", params); err == nil {
+		t.Fatalf("expected recipient cap to be enforced")
+	}
+}
+
+func TestRewriteGmailSendReplyRecipientsOnly(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.send"}, Gmail: &GmailPolicy{ReplyRecipientsOnly: true}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	lookups := 0
+	p.SetReplyRecipientsProvider(func(ctx context.Context, messageID string) ([]string, error) {
+		if messageID != "m1" {
+			t.Fatalf("unexpected message id: %s", messageID)
+		}
+		lookups++
+		return []string{"alice@example.com", "me@example.com"}, nil
+	})
+	ctx := context.Background()
+	if !p.DraftSendRequired(ctx, map[string]interface{}{"to": "alice@example.com"}) {
+		t.Fatalf("expected draft without reply_to_message_id")
+	}
+	if p.DraftSendRequired(ctx, map[string]interface{}{"to": "alice@example.com", "reply_to_message_id": "m1"}) {
+		t.Fatalf("expected reply to thread participant to be sent")
+	}
+	if !p.DraftSendRequired(ctx, map[string]interface{}{"to": "bob@example.com", "reply_to_message_id": "m1"}) {
+		t.Fatalf("expected draft for recipient outside thread")
+	}
+
+	lookups = 0
+	ctx = WithReplyLookups(ctx)
+	params := map[string]interface{}{"to": "alice@example.com", "reply_to_message_id": "m1"}
+	if _, warnings, err := p.ValidateAndRewrite(ctx, "gmail.send", params); err != nil || len(warnings) != 0 {
+		t.Fatalf("expected send to pass, got %v %v", warnings, err)
+	}
+	if p.DraftSendRequired(ctx, params) || lookups != 1 {
+		t.Fatalf("expected one thread lookup per request, got %d", lookups)
+	}
+}
+
+func TestValidateRejectsActionsWithoutSpec(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.search", "drive.files.list"}, Gmail: &GmailPolicy{}}
+	if err := p.Validate(); err == nil || err.Error() != "allowed action drive.files.list has no action spec" {
+		t.Fatalf("expected missing spec error, got %v", err)
+	}
+}
+
+func TestPageCursorsBindQueryAndExpire(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"gmail.search", "gmail.thread.list"}, Gmail: &GmailPolicy{MaxDays: 7}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	sealer, err := cursor.NewSealer(nil)
+	if err != nil {
+		t.Fatalf("sealer: %v", err)
+	}
+	p.SetPageCursors("a@example.com", sealer, time.Hour)
+
+	first, _, err := p.ValidateAndRewrite(context.Background(), "gmail.search", map[string]interface{}{"query": "from:boss", "max": 10})
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	page, err := p.WrapPageToken("gmail.search", first, "raw-token")
+	if err != nil || page == "raw-token" {
+		t.Fatalf("wrap: %q (%v)", page, err)
+	}
+
+	out, _, err := p.ValidateAndRewrite(context.Background(), "gmail.search", map[string]interface{}{"query": "from:boss", "max": 20, "page": page})
+	if err != nil || out["page"] != "raw-token" {
+		t.Fatalf("expected the cursor to unwrap, got %v (%v)", out, err)
+	}
+
+	bad := []struct {
+		action string
+		params map[string]interface{}
+	}{
+		{"gmail.search", map[string]interface{}{"query": "from:ceo", "page": page}},
+		{"gmail.thread.list", map[string]interface{}{"query": "from:boss", "page": page}},
+		{"gmail.search", map[string]interface{}{"query": "from:boss", "page": "raw-token"}},
+	}
+	for _, tc := range bad {
+		if _, _, err := p.ValidateAndRewrite(context.Background(), tc.action, tc.params); err == nil {
+			t.Fatalf("expected %s %v to be rejected", tc.action, tc.params)
+		}
+	}
+
+	other := &Policy{AllowedActions: []string{"gmail.search"}, Gmail: &GmailPolicy{MaxDays: 7}}
+	if err := other.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	other.SetPageCursors("b@example.com", sealer, time.Hour)
+	if _, _, err := other.ValidateAndRewrite(context.Background(), "gmail.search", map[string]interface{}{"query": "from:boss", "page": page}); err == nil {
+		t.Fatalf("expected a cursor from another account to be rejected")
+	}
+
+	p.SetPageCursors("a@example.com", sealer, -time.Minute)
+	expired, _ := p.WrapPageToken("gmail.search", first, "raw-token")
+	if _, _, err := p.ValidateAndRewrite(context.Background(), "gmail.search", map[string]interface{}{"query": "from:boss", "page": expired}); err == nil || err.Error() != "page cursor expired" {
+		t.Fatalf("expected an expired cursor error, got %v", err)
+	}
+}
+
+func TestPageCursorsPinCalendarRange(t *testing.T) {
+	p := &Policy{AllowedActions: []string{"calendar.events"}, Calendar: &CalendarPolicy{MaxDays: 7}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	p.SetTimeZoneProvider(func(context.Context) (*time.Location, error) { return time.UTC, nil })
+	sealer, _ := cursor.NewSealer(nil)
+	p.SetPageCursors("a@example.com", sealer, time.Hour)
+
+	first, _, err := p.ValidateAndRewrite(context.Background(), "calendar.events", map[string]interface{}{"calendar_id": "primary", "days": 2})
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	// The first page was fetched a while ago; "days: 2" now resolves to a
+	// different window.
+	first["time_min"] = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	page, _ := p.WrapPageToken("calendar.events", first, "raw-token")
+
+	out, _, err := p.ValidateAndRewrite(context.Background(), "calendar.events", map[string]interface{}{"calendar_id": "primary", "days": 2, "page": page})
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if out["time_min"] != first["time_min"] || out["time_max"] != first["time_max"] || out["page"] != "raw-token" {
+		t.Fatalf("expected the first page's window, got %v", out)
+	}
+}
@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// setFile is the policy file as written. Accounts and profiles are kept as
+// raw objects until their extends chains are resolved.
+type setFile struct {
+	DefaultAccount string                    `json:"default_account,omitempty"`
+	Profiles       map[string]map[string]any `json:"profiles,omitempty"`
+	Accounts       map[string]map[string]any `json:"accounts,omitempty"`
+	Clients        map[string]*ClientPolicy  `json:"clients,omitempty"`
+}
+
+// profileResolver applies named profiles to accounts and to each other.
+// Each profile is resolved once.
+type profileResolver struct {
+	profiles map[string]map[string]any
+	done     map[string]resolvedProfile
+	active   []string
+	reached  map[string]bool
+}
+
+type resolvedProfile struct {
+	obj     map[string]any
+	extends []ProfileTree
+}
+
+// ProfileTree is one profile a policy extends and the profiles it extends
+// in turn. Siblings apply in order, later ones winning, each after its own
+// parents.
+type ProfileTree struct {
+	Profile string        `json:"profile"`
+	Extends []ProfileTree `json:"extends,omitempty"`
+}
+
+// FormatExtends renders an extends tree on one line, for example
+// "drafter -> (reader, sender), audit".
+func FormatExtends(tree []ProfileTree) string {
+	parts := make([]string, 0, len(tree))
+	for _, node := range tree {
+		part := node.Profile
+		switch len(node.Extends) {
+		case 0:
+		case 1:
+			part += " -> " + FormatExtends(node.Extends)
+		default:
+			part += " -> (" + FormatExtends(node.Extends) + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newProfileResolver(profiles map[string]map[string]any) *profileResolver {
+	return &profileResolver{profiles: profiles, done: map[string]resolvedProfile{}, reached: map[string]bool{}}
+}
+
+// resolve returns raw with the profiles it extends applied, and the tree of
+// profiles it went through.
+func (r *profileResolver) resolve(raw map[string]any) (map[string]any, []ProfileTree, error) {
+	obj, tree, err := r.compose(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return finalizePolicy(obj), tree, nil
+}
+
+// compose is resolve without the final step: "key+" appends that found no
+// inherited list and null drops stay in the result, so a profile used next
+// to siblings still appends to their lists instead of replacing them.
+func (r *profileResolver) compose(raw map[string]any) (map[string]any, []ProfileTree, error) {
+	names, err := extendsList(raw["extends"])
+	if err != nil {
+		return nil, nil, err
+	}
+	base := map[string]any{}
+	tree := []ProfileTree{}
+	for _, name := range names {
+		p, err := r.profile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if base, err = mergePolicy(base, p.obj); err != nil {
+			return nil, nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		tree = append(tree, ProfileTree{Profile: name, Extends: p.extends})
+	}
+	own := make(map[string]any, len(raw))
+	for key, val := range raw {
+		if key != "extends" {
+			own[key] = val
+		}
+	}
+	out, err := mergePolicy(base, own)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, tree, nil
+}
+
+func (r *profileResolver) profile(name string) (resolvedProfile, error) {
+	if p, ok := r.done[name]; ok {
+		return p, nil
+	}
+	r.reached[name] = true
+	for i, active := range r.active {
+		if active == name {
+			cycle := append(append([]string{}, r.active[i:]...), name)
+			return resolvedProfile{}, fmt.Errorf("extends cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	raw, ok := r.profiles[name]
+	if !ok {
+		return resolvedProfile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	if raw == nil {
+		return resolvedProfile{}, fmt.Errorf("profile %s is null", name)
+	}
+	r.active = append(r.active, name)
+	obj, tree, err := r.compose(raw)
+	r.active = r.active[:len(r.active)-1]
+	if err != nil {
+		return resolvedProfile{}, fmt.Errorf("profile %s: %w", name, err)
+	}
+	p := resolvedProfile{obj: obj, extends: tree}
+	r.done[name] = p
+	return p, nil
+}
+
+func extendsList(val any) ([]string, error) {
+	var names []string
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []string{v}
+	case []any:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("extends must be a profile name or a list of names")
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, errors.New("extends must be a profile name or a list of names")
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if names[i] == "" {
+			return nil, errors.New("extends contains an empty profile name")
+		}
+	}
+	return names, nil
+}
+
+// mergePolicy overlays child on parent. Objects merge key by key; a list
+// under "key+" is appended to the inherited list, skipping duplicates; null
+// drops the inherited value; anything else, lists and booleans included,
+// replaces it. Without an inherited list "key+" and null are kept as they
+// are, for finalizePolicy or a later merge onto a sibling profile.
+func mergePolicy(parent, child map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(parent)+len(child))
+	for key, val := range parent {
+		out[key] = val
+	}
+	keys := make([]string, 0, len(child))
+	for key := range child {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := child[key]
+		if name, ok := strings.CutSuffix(key, "+"); ok {
+			if _, both := child[name]; both {
+				return nil, fmt.Errorf("set either %s or %s, not both", name, key)
+			}
+			add, ok := val.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list", key)
+			}
+			inherited, set := out[name]
+			switch list := inherited.(type) {
+			case []any:
+				out[name] = appendUnique(list, add)
+			case nil:
+				if set {
+					// Dropped, then appended to: the list is just add.
+					out[name] = appendUnique(nil, add)
+				} else {
+					pending, _ := out[key].([]any)
+					out[key] = appendUnique(pending, add)
+				}
+			default:
+				return nil, fmt.Errorf("%s: inherited %s is not a list", key, name)
+			}
+			continue
+		}
+		delete(out, key+"+")
+		if obj, ok := val.(map[string]any); ok {
+			current, present := out[key]
+			inherited, isObj := current.(map[string]any)
+			if present && !isObj {
+				// Replacing a dropped or non-object value: nothing to merge into.
+				inherited = nil
+				obj = finalizePolicy(obj)
+			}
+			merged, err := mergePolicy(inherited, obj)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = merged
+			continue
+		}
+		out[key] = val
+	}
+	return out, nil
+}
+
+// finalizePolicy applies what mergePolicy left pending: "key+" lists become
+// the list and null values are dropped.
+func finalizePolicy(obj map[string]any) map[string]any {
+	out := make(map[string]any, len(obj))
+	for key, val := range obj {
+		if val == nil {
+			continue
+		}
+		if name, ok := strings.CutSuffix(key, "+"); ok {
+			add, _ := val.([]any)
+			out[name] = appendUnique(nil, add)
+			continue
+		}
+		if child, ok := val.(map[string]any); ok {
+			val = finalizePolicy(child)
+		}
+		out[key] = val
+	}
+	return out
+}
+
+func appendUnique(list, add []any) []any {
+	out := append([]any{}, list...)
+	for _, item := range add {
+		seen := false
+		for _, existing := range out {
+			if reflect.DeepEqual(existing, item) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// decodePolicy turns a resolved policy object into a Policy. In strict mode
+// unknown fields are errors.
+func decodePolicy(obj map[string]any, strict bool) (*Policy, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	var pol Policy
+	if err := dec.Decode(&pol); err != nil {
+		return nil, err
+	}
+	return &pol, nil
+}
+
+// describeAccount names an account and, when it extends profiles, the
+// profiles its policy came from.
+func describeAccount(account string, extends []ProfileTree) string {
+	if len(extends) == 0 {
+		return "account " + account
+	}
+	return fmt.Sprintf("account %s (extends %s)", account, FormatExtends(extends))
+}
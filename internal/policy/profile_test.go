@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadSetFromString(t *testing.T, data string) (*PolicySet, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return LoadSet(path)
+}
+
+func TestLoadSetAppliesProfiles(t *testing.T) {
+	set, err := loadSetFromString(t, `{
+  "profiles": {
+    "reader": {
+      "allowed_actions": ["gmail.search", "calendar.list"],
+      "gmail": { "allowed_read_labels": ["INBOX"], "max_days": 30, "allow_links": true },
+      "calendar": {}
+    },
+    "drafter": {
+      "extends": "reader",
+      "allowed_actions+": ["gmail.send", "gmail.search"],
+      "gmail": { "draft_only": true }
+    }
+  },
+  "accounts": {
+    "a@example.com": { "extends": "drafter" },
+    "b@example.com": {
+      "extends": ["drafter"],
+      "allowed_actions": ["gmail.search"],
+      "gmail": { "allowed_read_labels+": ["Label_1"], "allow_links": false, "max_days": 7 },
+      "calendar": null
+    }
+  }
+}`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	a := set.Accounts["a@example.com"]
+	if strings.Join(a.AllowedActions, ",") != "gmail.search,calendar.list,gmail.send" {
+		t.Fatalf("expected appended actions without duplicates, got %v", a.AllowedActions)
+	}
+	if !a.Gmail.DraftOnly || a.Gmail.MaxDays != 30 || !a.Gmail.AllowLinks || a.Calendar == nil {
+		t.Fatalf("expected inherited settings, got %+v", a.Gmail)
+	}
+	if got := FormatExtends(set.Extends("A@example.com")); got != "drafter -> reader" {
+		t.Fatalf("unexpected chain: %s", got)
+	}
+
+	b := set.Accounts["b@example.com"]
+	if strings.Join(b.AllowedActions, ",") != "gmail.search" || b.Calendar != nil {
+		t.Fatalf("expected replaced actions and dropped calendar, got %v %+v", b.AllowedActions, b.Calendar)
+	}
+	if strings.Join(b.Gmail.AllowedReadLabels, ",") != "INBOX,Label_1" || b.Gmail.AllowLinks || b.Gmail.MaxDays != 7 || !b.Gmail.DraftOnly {
+		t.Fatalf("unexpected gmail policy: %+v", b.Gmail)
+	}
+}
+
+func TestLoadSetAppliesSiblingProfiles(t *testing.T) {
+	set, err := loadSetFromString(t, `{
+  "profiles": {
+    "base": {
+      "allowed_actions": ["gmail.search"],
+      "gmail": { "allowed_read_labels": ["INBOX"], "max_days": 7 }
+    },
+    "calendar": { "allowed_actions+": ["calendar.list"], "calendar": {} },
+    "labels": { "gmail": { "allowed_read_labels+": ["Label_1"] } },
+    "nocalendar": { "calendar": null },
+    "combined": { "extends": ["base", "calendar"] }
+  },
+  "accounts": {
+    "a@example.com": { "extends": ["combined", "labels"] },
+    "b@example.com": { "extends": ["combined", "nocalendar"], "allowed_actions": ["gmail.search"] }
+  }
+}`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	a := set.Accounts["a@example.com"]
+	if strings.Join(a.AllowedActions, ",") != "gmail.search,calendar.list" || a.Calendar == nil {
+		t.Fatalf("expected mixin to append to sibling actions, got %v", a.AllowedActions)
+	}
+	if strings.Join(a.Gmail.AllowedReadLabels, ",") != "INBOX,Label_1" || a.Gmail.MaxDays != 7 {
+		t.Fatalf("expected mixin to append to sibling labels, got %+v", a.Gmail)
+	}
+	if got := FormatExtends(set.Extends("a@example.com")); got != "combined -> (base, calendar), labels" {
+		t.Fatalf("unexpected extends tree: %s", got)
+	}
+	if b := set.Accounts["b@example.com"]; b.Calendar != nil {
+		t.Fatalf("expected mixin to drop sibling calendar, got %+v", b.Calendar)
+	}
+}
+
+func TestLoadSetProfileErrorsNameTheChain(t *testing.T) {
+	cases := map[string]string{
+		`{"profiles": {"base": {"allowed_actions": ["gmail.search"]}, "mid": {"extends": "base"}},
+		  "accounts": {"a@example.com": {"extends": "mid"}}}`: "account a@example.com (extends mid -> base): gmail policy is required for gmail actions",
+		`{"profiles": {"mid": {"extends": "base"}},
+		  "accounts": {"a@example.com": {"extends": "mid"}}}`: `account a@example.com: profile mid: unknown profile "base"`,
+		`{"profiles": {"x": {"extends": "y"}, "y": {"extends": "x"}},
+		  "accounts": {"a@example.com": {"extends": "x"}}}`: "account a@example.com: profile x: profile y: extends cycle: x -> y -> x",
+		`{"profiles": {"base": {"allowed_actions": "gmail.search"}},
+		  "accounts": {"a@example.com": {"extends": "base", "allowed_actions+": ["calendar.list"]}}}`: "account a@example.com: allowed_actions+: inherited allowed_actions is not a list",
+	}
+	for data, want := range cases {
+		if _, err := loadSetFromString(t, data); err == nil || err.Error() != want {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+}
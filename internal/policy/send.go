@@ -0,0 +1,408 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type RecipientFields struct {
+	To  *RecipientRule `json:"to,omitempty"`
+	Cc  *RecipientRule `json:"cc,omitempty"`
+	Bcc *RecipientRule `json:"bcc,omitempty"`
+}
+
+type RecipientRule struct {
+	Forbidden bool     `json:"forbidden"`
+	Allowed   []string `json:"allowed"`
+	Max       int      `json:"max"`
+}
+
+var recipientFieldNames = []string{"to", "cc", "bcc"}
+
+func (f *RecipientFields) rule(field string) *RecipientRule {
+	if f == nil {
+		return nil
+	}
+	switch field {
+	case "to":
+		return f.To
+	case "cc":
+		return f.Cc
+	case "bcc":
+		return f.Bcc
+	default:
+		return nil
+	}
+}
+
+func validateRecipientRules(gmail *GmailPolicy) error {
+	if gmail.MaxRecipients < 0 {
+		return errors.New("max_recipients must not be negative")
+	}
+	patterns := append([]string{}, gmail.AllowedSendRecipients...)
+	patterns = append(patterns, gmail.DeniedSendRecipients...)
+	for _, field := range recipientFieldNames {
+		rule := gmail.RecipientFields.rule(field)
+		if rule == nil {
+			continue
+		}
+		if rule.Max < 0 {
+			return fmt.Errorf("recipient_fields.%s.max must not be negative", field)
+		}
+		patterns = append(patterns, rule.Allowed...)
+	}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if strings.Contains(pattern, "*") && !strings.HasPrefix(pattern, "*@") {
+			return fmt.Errorf("invalid recipient pattern %q (wildcards must look like *@example.com)", pattern)
+		}
+		if strings.Count(pattern, "*") > 2 || (strings.Count(pattern, "*") == 2 && !strings.HasPrefix(pattern, "*@*.")) {
+			return fmt.Errorf("invalid recipient pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// checkRecipients enforces the hard recipient rules. Unlike the send
+// allowlists, which downgrade a send to a draft, these also block drafts.
+func (p *Policy) checkRecipients(params map[string]interface{}) error {
+	if p == nil || p.Gmail == nil {
+		return nil
+	}
+	// Unparsable recipients only matter when there is a rule to dodge;
+	// otherwise gog rejects them itself.
+	strict := len(p.Gmail.DeniedSendRecipients) > 0 || p.Gmail.MaxRecipients > 0 || p.Gmail.RecipientFields != nil
+	total := 0
+	for _, field := range recipientFieldNames {
+		recipients, err := fieldRecipients(params, field)
+		if err != nil {
+			if strict {
+				return err
+			}
+			continue
+		}
+		total += len(recipients)
+		for _, rcpt := range recipients {
+			if recipientMatchesAny(rcpt, p.Gmail.DeniedSendRecipients) {
+				return fmt.Errorf("recipient is denied: %s", rcpt)
+			}
+		}
+		rule := p.Gmail.RecipientFields.rule(field)
+		if rule == nil || len(recipients) == 0 {
+			continue
+		}
+		if rule.Forbidden {
+			return fmt.Errorf("%s recipients are not allowed", field)
+		}
+		if rule.Max > 0 && len(recipients) > rule.Max {
+			return fmt.Errorf("%s recipients exceed max (%d)", field, rule.Max)
+		}
+	}
+	if p.Gmail.MaxRecipients > 0 && total > p.Gmail.MaxRecipients {
+		return fmt.Errorf("recipients exceed max_recipients (%d)", p.Gmail.MaxRecipients)
+	}
+	return nil
+}
+
+func (p *Policy) replyRecipientsReason(ctx context.Context, params map[string]interface{}) string {
+	messageID, ok := getString(params, "reply_to_message_id")
+	if !ok || strings.TrimSpace(messageID) == "" {
+		return "reply_required"
+	}
+	recipients, err := collectRecipients(params)
+	if err != nil {
+		return "recipient_invalid"
+	}
+	if len(recipients) == 0 {
+		return "recipients_missing"
+	}
+	if skipReplyLookup(ctx) {
+		return ""
+	}
+	if p.replyProvider == nil {
+		return "reply_thread_unavailable"
+	}
+	participants, err := p.replyParticipants(ctx, strings.TrimSpace(messageID))
+	if err != nil || len(participants) == 0 {
+		return "reply_thread_unavailable"
+	}
+	known := map[string]struct{}{}
+	for _, addr := range participants {
+		known[strings.ToLower(strings.TrimSpace(addr))] = struct{}{}
+	}
+	for _, rcpt := range recipients {
+		if _, ok := known[strings.ToLower(rcpt)]; !ok {
+			return "recipient_not_in_thread"
+		}
+	}
+	return ""
+}
+
+type replyLookupsKey struct{}
+
+type replyLookups struct {
+	mu      sync.Mutex
+	threads map[string]replyLookup
+	skip    bool
+	skipped bool
+}
+
+type replyLookup struct {
+	participants []string
+	err          error
+}
+
+// WithReplyLookups memoizes reply thread lookups for the life of ctx, so a
+// request that checks the same send several times fetches the thread once.
+func WithReplyLookups(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(replyLookupsKey{}).(*replyLookups); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, replyLookupsKey{}, &replyLookups{threads: map[string]replyLookup{}})
+}
+
+// WithoutReplyLookups makes reply_recipients_only checks under ctx pass
+// without fetching the thread, for dry runs that must not call gog.
+// ReplyLookupSkipped then reports whether a send depended on the thread.
+func WithoutReplyLookups(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replyLookupsKey{}, &replyLookups{skip: true})
+}
+
+func ReplyLookupSkipped(ctx context.Context) bool {
+	lookups, ok := ctx.Value(replyLookupsKey{}).(*replyLookups)
+	if !ok {
+		return false
+	}
+	lookups.mu.Lock()
+	defer lookups.mu.Unlock()
+	return lookups.skipped
+}
+
+func skipReplyLookup(ctx context.Context) bool {
+	lookups, ok := ctx.Value(replyLookupsKey{}).(*replyLookups)
+	if !ok || !lookups.skip {
+		return false
+	}
+	lookups.mu.Lock()
+	defer lookups.mu.Unlock()
+	lookups.skipped = true
+	return true
+}
+
+func (p *Policy) replyParticipants(ctx context.Context, messageID string) ([]string, error) {
+	lookups, ok := ctx.Value(replyLookupsKey{}).(*replyLookups)
+	if !ok {
+		return p.replyProvider(ctx, messageID)
+	}
+	lookups.mu.Lock()
+	defer lookups.mu.Unlock()
+	if cached, ok := lookups.threads[messageID]; ok {
+		return cached.participants, cached.err
+	}
+	participants, err := p.replyProvider(ctx, messageID)
+	lookups.threads[messageID] = replyLookup{participants: participants, err: err}
+	return participants, err
+}
+
+func recipientMatchesAny(rcpt string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if recipientMatches(rcpt, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func recipientMatches(rcpt, pattern string) bool {
+	rcpt = strings.ToLower(strings.TrimSpace(rcpt))
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if rcpt == "" || pattern == "" {
+		return false
+	}
+	if !strings.HasPrefix(pattern, "*@") {
+		return rcpt == pattern
+	}
+	at := strings.LastIndex(rcpt, "@")
+	if at < 0 {
+		return false
+	}
+	domain := rcpt[at+1:]
+	want := strings.TrimPrefix(pattern, "*@")
+	if strings.HasPrefix(want, "*.") {
+		return strings.HasSuffix(domain, want[1:])
+	}
+	return domain == want
+}
+
+var reservedHeaders = map[string]struct{}{
+	"From":                      {},
+	"To":                        {},
+	"Cc":                        {},
+	"Bcc":                       {},
+	"Subject":                   {},
+	"Reply-To":                  {},
+	"Sender":                    {},
+	"Date":                      {},
+	"Message-Id":                {},
+	"In-Reply-To":               {},
+	"References":                {},
+	"Content-Type":              {},
+	"Content-Transfer-Encoding": {},
+	"Mime-Version":              {},
+}
+
+func validateExtraHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return errors.New("extra_headers contains empty header name")
+		}
+		for _, r := range name {
+			if r <= ' ' || r >= 0x7f || r == ':' {
+				return fmt.Errorf("extra_headers: invalid header name %q", name)
+			}
+		}
+		if _, ok := reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)]; ok {
+			return fmt.Errorf("extra_headers: header %s cannot be overridden", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("extra_headers: header %s contains a line break", name)
+		}
+	}
+	return nil
+}
+
+// applyOutgoingMarkers labels agent-authored mail with the policy subject
+// prefix, body footer and extra headers. It runs after the agent's params have
+// been checked, so the agent cannot strip or replace the markers.
+func (p *Policy) applyOutgoingMarkers(params map[string]interface{}, warnings []string) []string {
+	if p == nil || p.Gmail == nil {
+		return warnings
+	}
+
+	if prefix := strings.TrimSpace(p.Gmail.SubjectPrefix); prefix != "" {
+		subject, _ := getString(params, "subject")
+		if !strings.HasPrefix(strings.TrimSpace(subject), prefix) {
+			params["subject"] = strings.TrimSpace(prefix + " " + subject)
+			warnings = append(warnings, "content_rewritten:subject_prefix")
+		}
+	}
+
+	footer := strings.TrimSpace(p.Gmail.BodyFooter)
+	footerHTML := strings.TrimSpace(p.Gmail.BodyFooterHTML)
+	if footerHTML == "" && footer != "" {
+		footerHTML = strings.ReplaceAll(html.EscapeString(footer), "\n", "<br>")
+	}
+	if footer == "" && footerHTML != "" {
+		footer = plainFooter(footerHTML)
+	}
+	if footer != "" || footerHTML != "" {
+		changed := false
+		body, hasBody := getString(params, "body")
+		bodyHTML, hasHTML := getString(params, "body_html")
+		if footer != "" && (hasBody || !hasHTML) {
+			if !hasPlainFooter(body, footer) {
+				params["body"] = appendPlainFooter(body, footer)
+				changed = true
+			}
+		}
+		if footerHTML != "" && hasHTML {
+			if !hasHTMLFooter(bodyHTML, footerHTML) {
+				params["body_html"] = appendHTMLFooter(bodyHTML, footerHTML)
+				changed = true
+			}
+		}
+		if changed {
+			warnings = append(warnings, "content_rewritten:footer")
+		}
+	}
+
+	if len(p.Gmail.ExtraHeaders) > 0 {
+		names := make([]string, 0, len(p.Gmail.ExtraHeaders))
+		for name := range p.Gmail.ExtraHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			headers = append(headers, strings.TrimSpace(name)+": "+strings.TrimSpace(p.Gmail.ExtraHeaders[name]))
+		}
+		params["headers"] = headers
+		warnings = append(warnings, "content_rewritten:headers")
+	}
+	return warnings
+}
+
+// hasPlainFooter reports whether body already ends with the footer on its
+// own lines, as appendPlainFooter leaves it.
+func hasPlainFooter(body, footer string) bool {
+	rest, ok := strings.CutSuffix(strings.TrimRight(body, " \t\r\n"), footer)
+	return ok && (rest == "" || strings.HasSuffix(rest, "\n"))
+}
+
+// plainFooter derives the text footer from body_footer_html for plain bodies:
+// line breaks and block ends become newlines, other tags are dropped and
+// entities are decoded.
+func plainFooter(footerHTML string) string {
+	var b strings.Builder
+	for rest := footerHTML; rest != ""; {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+		end := strings.IndexByte(rest[start:], '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.ToLower(strings.Trim(rest[start+1:start+end], "/ "))
+		if name, _, _ := strings.Cut(tag, " "); name == "br" || name == "p" || name == "div" || name == "li" {
+			b.WriteString("\n")
+		}
+		rest = rest[start+end+1:]
+	}
+	lines := strings.Split(html.UnescapeString(b.String()), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func appendPlainFooter(body, footer string) string {
+	body = strings.TrimRight(body, " \t\r\n")
+	if body == "" {
+		return footer
+	}
+	return body + "\n\n" + footer
+}
+
+// hasHTMLFooter reports whether body already ends with the footer block
+// appendHTMLFooter adds, before any closing body tag.
+func hasHTMLFooter(body, footer string) bool {
+	body = strings.TrimSpace(body)
+	if idx := strings.LastIndex(strings.ToLower(body), "</body>"); idx >= 0 {
+		body = strings.TrimSpace(body[:idx])
+	}
+	return strings.HasSuffix(body, "<p>"+footer+"</p>")
+}
+
+func appendHTMLFooter(body, footer string) string {
+	block := "<p>" + footer + "</p>"
+	if idx := strings.LastIndex(strings.ToLower(body), "</body>"); idx >= 0 {
+		return body[:idx] + block + body[idx:]
+	}
+	return body + block
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"gogcli-sandbox/internal/actions"
 )
 
 var (
@@ -14,8 +16,19 @@ var (
 )
 
 type PolicySet struct {
-	DefaultAccount string             `json:"default_account,omitempty"`
-	Accounts       map[string]*Policy `json:"accounts,omitempty"`
+	DefaultAccount string                   `json:"default_account,omitempty"`
+	Accounts       map[string]*Policy       `json:"accounts,omitempty"`
+	Clients        map[string]*ClientPolicy `json:"clients,omitempty"`
+
+	extends map[string][]ProfileTree
+}
+
+// ClientPolicy scopes a TLS client certificate, keyed by its subject common
+// name or one of its SANs. Actions narrows the account policies further;
+// when empty the certificate may use every action its accounts allow.
+type ClientPolicy struct {
+	Accounts []string `json:"accounts"`
+	Actions  []string `json:"actions,omitempty"`
 }
 
 func LoadSet(path string) (*PolicySet, error) {
@@ -24,33 +37,53 @@ func LoadSet(path string) (*PolicySet, error) {
 		return nil, err
 	}
 
-	var set PolicySet
-	if err := json.Unmarshal(data, &set); err != nil {
+	var file setFile
+	if err := json.Unmarshal(data, &file); err != nil {
 		return nil, err
 	}
-	if len(set.Accounts) == 0 {
+	if len(file.Accounts) == 0 {
 		return nil, errors.New("accounts must not be empty")
 	}
 
+	set := PolicySet{DefaultAccount: file.DefaultAccount, Clients: file.Clients}
+	profiles := newProfileResolver(file.Profiles)
 	normalized := map[string]*Policy{}
-	for key, pol := range set.Accounts {
+	for key, raw := range file.Accounts {
 		account := normalizeAccount(key)
 		if account == "" {
 			return nil, errors.New("accounts contains empty key")
 		}
-		if pol == nil {
+		if raw == nil {
 			return nil, fmt.Errorf("account %s policy is null", account)
 		}
 		if _, exists := normalized[account]; exists {
 			return nil, fmt.Errorf("duplicate account %s", account)
 		}
-		if err := pol.Validate(); err != nil {
+		obj, extends, err := profiles.resolve(raw)
+		if err != nil {
 			return nil, fmt.Errorf("account %s: %w", account, err)
 		}
+		pol, err := decodePolicy(obj, false)
+		if err == nil {
+			err = pol.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", describeAccount(account, extends), err)
+		}
 		normalized[account] = pol
+		if len(extends) > 0 {
+			if set.extends == nil {
+				set.extends = map[string][]ProfileTree{}
+			}
+			set.extends[account] = extends
+		}
 	}
 	set.Accounts = normalized
 
+	if err := set.validateClients(); err != nil {
+		return nil, err
+	}
+
 	if set.DefaultAccount != "" {
 		set.DefaultAccount = normalizeAccount(set.DefaultAccount)
 		if set.DefaultAccount == "" {
@@ -64,6 +97,14 @@ func LoadSet(path string) (*PolicySet, error) {
 	return &set, nil
 }
 
+// Extends returns the profiles an account's policy was built from.
+func (s *PolicySet) Extends(account string) []ProfileTree {
+	if s == nil {
+		return nil
+	}
+	return s.extends[normalizeAccount(account)]
+}
+
 func (s *PolicySet) Resolve(account string, fallback string) (*Policy, string, error) {
 	if s == nil {
 		return nil, "", errors.New("policy is required")
@@ -95,6 +136,48 @@ func (s *PolicySet) Resolve(account string, fallback string) (*Policy, string, e
 	return pol, normalized, nil
 }
 
+func (s *PolicySet) validateClients() error {
+	normalized := map[string]*ClientPolicy{}
+	for key, client := range s.Clients {
+		name := strings.TrimSpace(key)
+		if name == "" {
+			return errors.New("clients contains empty key")
+		}
+		if client == nil || len(client.Accounts) == 0 {
+			return fmt.Errorf("client %s: accounts must not be empty", name)
+		}
+		for i, account := range client.Accounts {
+			account = normalizeAccount(account)
+			if _, ok := s.Accounts[account]; !ok {
+				return fmt.Errorf("client %s: account %s not found", name, account)
+			}
+			client.Accounts[i] = account
+		}
+		for _, action := range client.Actions {
+			if _, ok := actions.Lookup(action); !ok {
+				return fmt.Errorf("client %s: unknown action %s", name, action)
+			}
+		}
+		normalized[name] = client
+	}
+	s.Clients = normalized
+	return nil
+}
+
+// Client returns the first client entry matching one of a certificate's
+// identities, tried in order.
+func (s *PolicySet) Client(identities []string) (string, *ClientPolicy, bool) {
+	if s == nil {
+		return "", nil, false
+	}
+	for _, identity := range identities {
+		if client, ok := s.Clients[identity]; ok {
+			return identity, client, true
+		}
+	}
+	return "", nil, false
+}
+
 func normalizeAccount(account string) string {
 	return strings.ToLower(strings.TrimSpace(account))
 }
@@ -64,3 +64,38 @@ func TestResolveSingleAccountFallback(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestLoadSetClients(t *testing.T) {
+	dir := t.TempDir()
+	write := func(clients string) (*PolicySet, error) {
+		path := filepath.Join(dir, "policy.json")
+		data := []byte(`{
+  "accounts": {
+    "user@example.com": {"allowed_actions": ["gmail.search", "gmail.send"], "gmail": {}}
+  },
+  "clients": ` + clients + `
+}`)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return LoadSet(path)
+	}
+
+	set, err := write(`{"agent-1": {"accounts": ["User@Example.com"], "actions": ["gmail.search"]}}`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	name, client, ok := set.Client([]string{"unknown", "agent-1"})
+	if !ok || name != "agent-1" || client.Accounts[0] != "user@example.com" {
+		t.Fatalf("unexpected client: %s %+v", name, client)
+	}
+	for _, bad := range []string{
+		`{"agent-1": {"accounts": ["other@example.com"]}}`,
+		`{"agent-1": {"accounts": []}}`,
+		`{"agent-1": {"accounts": ["user@example.com"], "actions": ["gmail.serach"]}}`,
+	} {
+		if _, err := write(bad); err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	"gogcli-sandbox/internal/actions"
 	"gogcli-sandbox/internal/policy"
 )
 
@@ -42,8 +43,12 @@ var calendarDetailKeys = map[string]struct{}{
 
 func Redact(action string, data any, pol *policy.Policy) (any, []string, error) {
 	warnings := []string{}
-	switch action {
-	case "gmail.search", "gmail.thread.list", "gmail.thread.get", "gmail.thread.modify", "gmail.get", "gmail.send", "gmail.drafts.create", "gmail.labels.list", "gmail.labels.get", "gmail.labels.modify":
+	profile := actions.RedactNone
+	if spec, ok := actions.Lookup(action); ok {
+		profile = spec.Redaction
+	}
+	switch profile {
+	case actions.RedactGmail, actions.RedactGmailThreads, actions.RedactGmailLabels, actions.RedactGmailSent:
 		if pol.Gmail == nil {
 			return nil, nil, errors.New("gmail policy missing")
 		}
@@ -54,8 +59,8 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 		}
 		readAllowed := pol.Gmail.AllowedReadLabels
 		labelUnion := allowedLabelUnion(pol.Gmail)
-		switch action {
-		case "gmail.search", "gmail.thread.list":
+		switch profile {
+		case actions.RedactGmailThreads:
 			if len(readAllowed) > 0 {
 				filtered, fw, err := filterSearchResults(clean, readAllowed, pol)
 				if err != nil {
@@ -64,7 +69,7 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 				warnings = append(warnings, fw...)
 				return filtered, warnings, nil
 			}
-		case "gmail.labels.list":
+		case actions.RedactGmailLabels:
 			if len(labelUnion) > 0 {
 				filtered, fw, err := filterLabelsList(clean, labelUnion)
 				if err != nil {
@@ -73,7 +78,7 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 				warnings = append(warnings, fw...)
 				return filtered, warnings, nil
 			}
-		case "gmail.send", "gmail.drafts.create":
+		case actions.RedactGmailSent:
 			// Sends/drafts may not include label info; do not enforce label checks.
 			return clean, warnings, nil
 		default:
@@ -84,7 +89,7 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 			}
 		}
 		return clean, warnings, nil
-	case "calendar.list", "calendar.events", "calendar.freebusy":
+	case actions.RedactCalendar, actions.RedactCalendarList:
 		if pol.Calendar == nil {
 			return nil, nil, errors.New("calendar policy missing")
 		}
@@ -93,7 +98,7 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 		if err != nil {
 			return nil, nil, err
 		}
-		if action == "calendar.list" && len(pol.Calendar.AllowedCalendars) > 0 {
+		if profile == actions.RedactCalendarList && len(pol.Calendar.AllowedCalendars) > 0 {
 			filtered, fw, err := filterCalendarList(clean, pol.Calendar.AllowedCalendars)
 			if err != nil {
 				return nil, nil, err
@@ -107,6 +112,50 @@ func Redact(action string, data any, pol *policy.Policy) (any, []string, error)
 	}
 }
 
+// Rules names the redaction profile of action and the rules Redact would
+// apply to its responses under pol, without needing a response.
+func Rules(action string, pol *policy.Policy) (string, []string) {
+	profile := actions.RedactNone
+	if spec, ok := actions.Lookup(action); ok {
+		profile = spec.Redaction
+	}
+	if profile == actions.RedactNone || pol == nil {
+		return profile, []string{}
+	}
+	rules := []string{"drop:attachments", "drop:snippet_html"}
+	if pol.Gmail != nil && !pol.Gmail.AllowBody {
+		rules = append(rules, "drop:body")
+	}
+	if pol.Calendar != nil && !pol.Calendar.AllowDetails {
+		rules = append(rules, "drop:calendar_details")
+	}
+	if (pol.Gmail != nil && !pol.Gmail.AllowLinks) || (pol.Calendar != nil && !pol.Calendar.AllowDetails) {
+		rules = append(rules, "mask:links")
+	}
+	if pol.Gmail != nil && len(pol.Gmail.AllowedSenders) > 0 {
+		rules = append(rules, "mask:emails_outside_allowed_senders")
+	}
+	switch profile {
+	case actions.RedactGmailThreads:
+		if pol.Gmail != nil && len(pol.Gmail.AllowedReadLabels) > 0 {
+			rules = append(rules, "filter:labels")
+		}
+	case actions.RedactGmailLabels:
+		if len(allowedLabelUnion(pol.Gmail)) > 0 {
+			rules = append(rules, "filter:labels")
+		}
+	case actions.RedactGmail:
+		if pol.Gmail != nil && len(pol.Gmail.AllowedReadLabels) > 0 {
+			rules = append(rules, "require:allowed_labels")
+		}
+	case actions.RedactCalendarList:
+		if pol.Calendar != nil && len(pol.Calendar.AllowedCalendars) > 0 {
+			rules = append(rules, "filter:calendars")
+		}
+	}
+	return profile, rules
+}
+
 func redactAny(val any, pol *policy.Policy) (any, []string, error) {
 	warnings := []string{}
 	switch v := val.(type) {
@@ -0,0 +1,296 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema (draft 2020-12) used for action
+// params: type, properties, required, additionalProperties, items, enum,
+// numeric and length bounds, and pattern.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Types is a JSON Schema "type": a single name or a list of names.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return []byte(strconv.Quote(t[0])), nil
+	}
+	parts := make([]string, len(t))
+	for i, name := range t {
+		parts[i] = strconv.Quote(name)
+	}
+	return []byte("[" + strings.Join(parts, ",") + "]"), nil
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// Error reports the first value that does not match, with a path such as
+// params.calendar_ids[2].
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks val (as decoded by encoding/json, or built from Go ints,
+// strings and []string) against s. root names the value in error paths.
+func (s *Schema) Validate(root string, val interface{}) error {
+	return s.validate(root, val)
+}
+
+func (s *Schema) validate(path string, val interface{}) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Type) > 0 && !s.Type.match(val) {
+		return &Error{Path: path, Message: "must be " + s.Type.describe()}
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, val) {
+		return &Error{Path: path, Message: "must be one of " + describeEnum(s.Enum)}
+	}
+	switch v := val.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at least %d characters", *s.MinLength)}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at most %d characters", *s.MaxLength)}
+		}
+		if s.Pattern != "" {
+			re, err := compile(s.Pattern)
+			if err != nil {
+				return &Error{Path: path, Message: "schema has an invalid pattern"}
+			}
+			if !re.MatchString(v) {
+				return &Error{Path: path, Message: "does not match pattern " + s.Pattern}
+			}
+		}
+	case float64, int:
+		n := toFloat(v)
+		if s.Minimum != nil && n < *s.Minimum {
+			return &Error{Path: path, Message: "must be >= " + formatNumber(*s.Minimum)}
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return &Error{Path: path, Message: "must be <= " + formatNumber(*s.Maximum)}
+		}
+	case []interface{}:
+		return s.validateItems(path, len(v), func(i int) interface{} { return v[i] })
+	case []string:
+		return s.validateItems(path, len(v), func(i int) interface{} { return v[i] })
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	}
+	return nil
+}
+
+func (s *Schema) validateItems(path string, n int, item func(int) interface{}) error {
+	if s.MinItems != nil && n < *s.MinItems {
+		return &Error{Path: path, Message: fmt.Sprintf("must have at least %d items", *s.MinItems)}
+	}
+	if s.MaxItems != nil && n > *s.MaxItems {
+		return &Error{Path: path, Message: fmt.Sprintf("must have at most %d items", *s.MaxItems)}
+	}
+	for i := 0; i < n; i++ {
+		if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}) error {
+	for _, key := range s.Required {
+		if val, ok := obj[key]; !ok || val == nil {
+			return &Error{Path: path + "." + key, Message: "is required"}
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		prop, ok := s.Properties[key]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return &Error{Path: path + "." + key, Message: "is not a known param"}
+			}
+			continue
+		}
+		if obj[key] == nil && len(prop.Type) > 0 && !prop.Type.match(nil) {
+			return &Error{Path: path + "." + key, Message: "must not be null"}
+		}
+		if err := prop.validate(path+"."+key, obj[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Types) match(val interface{}) bool {
+	for _, name := range t {
+		switch name {
+		case "string":
+			if _, ok := val.(string); ok {
+				return true
+			}
+		case "integer":
+			switch v := val.(type) {
+			case int:
+				return true
+			case float64:
+				if v == math.Trunc(v) && !math.IsInf(v, 0) {
+					return true
+				}
+			}
+		case "number":
+			switch val.(type) {
+			case int, float64:
+				return true
+			}
+		case "boolean":
+			if _, ok := val.(bool); ok {
+				return true
+			}
+		case "array":
+			switch val.(type) {
+			case []interface{}, []string:
+				return true
+			}
+		case "object":
+			if _, ok := val.(map[string]interface{}); ok {
+				return true
+			}
+		case "null":
+			if val == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t Types) describe() string {
+	names := make([]string, len(t))
+	for i, name := range t {
+		switch name {
+		case "integer", "array", "object":
+			names[i] = "an " + name
+		case "null":
+			names[i] = name
+		default:
+			names[i] = "a " + name
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func inEnum(enum []interface{}, val interface{}) bool {
+	for _, allowed := range enum {
+		switch a := allowed.(type) {
+		case string:
+			if v, ok := val.(string); ok && v == a {
+				return true
+			}
+		case float64, int:
+			switch val.(type) {
+			case float64, int:
+				if toFloat(val) == toFloat(a) {
+					return true
+				}
+			}
+		case bool:
+			if v, ok := val.(bool); ok && v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeEnum(enum []interface{}) string {
+	parts := make([]string, len(enum))
+	for i, val := range enum {
+		parts[i] = fmt.Sprint(val)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func toFloat(val interface{}) float64 {
+	switch v := val.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+var patterns sync.Map
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// CheckPattern reports whether pattern compiles, for validating specs at
+// load time.
+func CheckPattern(pattern string) error {
+	_, err := compile(pattern)
+	return err
+}
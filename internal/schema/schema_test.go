@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateNested(t *testing.T) {
+	var s Schema
+	raw := `{
+  "type": "object",
+  "required": ["ids"],
+  "additionalProperties": false,
+  "properties": {
+    "ids": {"type": ["string", "array"], "maxItems": 2, "items": {"type": "string", "minLength": 1}},
+    "mode": {"type": "string", "enum": ["a", "b"]}
+  }
+}`
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, tc := range []struct {
+		val  string
+		want string
+	}{
+		{`{"ids": ["x"]}`, ""},
+		{`{"ids": "x,y", "mode": "b"}`, ""},
+		{`{}`, "params.ids: is required"},
+		{`{"ids": ["x", ""]}`, "params.ids[1]: must be at least 1 characters"},
+		{`{"ids": ["x", "y", "z"]}`, "params.ids: must have at most 2 items"},
+		{`{"ids": 3}`, "params.ids: must be a string or an array"},
+		{`{"ids": "x", "mode": "c"}`, "params.mode: must be one of a, b"},
+		{`{"ids": "x", "extra": true}`, "params.extra: is not a known param"},
+		{`{"ids": "x", "mode": null}`, "params.mode: must not be null"},
+		{`{"ids": null}`, "params.ids: is required"},
+	} {
+		var val interface{}
+		if err := json.Unmarshal([]byte(tc.val), &val); err != nil {
+			t.Fatalf("unmarshal %s: %v", tc.val, err)
+		}
+		err := s.Validate("params", val)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || err.Error() != tc.want) {
+			t.Fatalf("%s: expected %q, got %v", tc.val, tc.want, err)
+		}
+	}
+
+	out, err := json.Marshal(Schema{Type: Types{"string"}})
+	if err != nil || !strings.Contains(string(out), `"type":"string"`) {
+		t.Fatalf("unexpected marshal %s (%v)", out, err)
+	}
+}
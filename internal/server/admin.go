@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gogcli-sandbox/internal/actions"
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/outbox"
+	"gogcli-sandbox/internal/token"
+)
+
+// Admin serves the operator socket: a runtime view of the broker and
+// controls that take effect without a restart. It is never exposed to
+// agents, so it lives on its own socket with owner-only permissions.
+type Admin struct {
+	Broker *broker.Broker
+	Cache  *gog.Cache
+	Tokens *token.Store
+	Reload func() error
+	Logger broker.Logger
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+type switchRequest struct {
+	Account string `json:"account,omitempty"`
+	Action  string `json:"action,omitempty"`
+	For     string `json:"for,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type lockdownRequest struct {
+	Account string `json:"account,omitempty"`
+	Enabled *bool  `json:"enabled"`
+}
+
+type flushRequest struct {
+	Account string `json:"account,omitempty"`
+}
+
+func ServeAdmin(ctx context.Context, socketPath string, a *Admin) error {
+	listener, err := listenUnix(socketPath, 0o600)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:      a.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	a.log("admin_listening", map[string]any{"socket": socketPath})
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (a *Admin) Handler() http.Handler {
+	b := a.Broker
+	mux := http.NewServeMux()
+	get := func(path string, view func() any) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, http.StatusOK, view())
+		})
+	}
+	post := func(path string, do func(r *http.Request) (any, error)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			result, err := do(r)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, adminError{Error: err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+		})
+	}
+
+	get("/policy", func() any {
+		set := b.PolicySet()
+		accounts := []string{}
+		clients := []string{}
+		defaultAccount := ""
+		if set != nil {
+			for account := range set.Accounts {
+				accounts = append(accounts, account)
+			}
+			for name := range set.Clients {
+				clients = append(clients, name)
+			}
+			defaultAccount = set.DefaultAccount
+		}
+		sort.Strings(accounts)
+		sort.Strings(clients)
+		return map[string]any{"policy": b.PolicyInfo(), "default_account": defaultAccount, "accounts": accounts, "clients": clients}
+	})
+	get("/labels", func() any {
+		return map[string]any{"accounts": b.LabelCacheStatus(), "labels": b.LabelCacheContents()}
+	})
+	get("/ratelimits", func() any {
+		usage := []token.Usage{}
+		if a.Tokens != nil {
+			usage = a.Tokens.Usage(time.Now())
+		}
+		return map[string]any{"tokens": usage}
+	})
+	get("/outbox", func() any {
+		pending := []outbox.Summary{}
+		if b.Outbox != nil {
+			for _, entry := range b.Outbox.List() {
+				pending = append(pending, entry.Summary())
+			}
+		}
+		return map[string]any{"pending": pending}
+	})
+	get("/denials", func() any {
+		return map[string]any{"denials": b.RecentDenials()}
+	})
+	get("/runners", func() any {
+		return map[string]any{"limiter": b.Limiter.Stats(), "breakers": b.Breaker.Status(), "cache": a.Cache.Stats()}
+	})
+	get("/switches", func() any {
+		return map[string]any{"switches": b.Switches()}
+	})
+	mux.HandleFunc("/lockdown", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"lockdown": b.Lockdown()})
+		case http.MethodPost:
+			var req lockdownRequest
+			if err := decodeBody(r.Body, &req); err != nil {
+				writeJSON(w, http.StatusBadRequest, adminError{Error: err.Error()})
+				return
+			}
+			if req.Enabled == nil {
+				writeJSON(w, http.StatusBadRequest, adminError{Error: "enabled is required"})
+				return
+			}
+			b.SetLockdown(req.Account, *req.Enabled, "admin")
+			writeJSON(w, http.StatusOK, map[string]any{"lockdown": b.Lockdown()})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	post("/reload", func(*http.Request) (any, error) {
+		if a.Reload == nil {
+			return nil, errors.New("reload is not available")
+		}
+		if err := a.Reload(); err != nil {
+			a.log("policy_reload_failed", map[string]any{"error": err.Error()})
+			return nil, err
+		}
+		info := b.PolicyInfo()
+		a.log("policy_reloaded", map[string]any{"source": info.Source, "hash": info.Hash})
+		return map[string]any{"policy": info}, nil
+	})
+	post("/flush", func(r *http.Request) (any, error) {
+		var req flushRequest
+		if err := decodeBody(r.Body, &req); err != nil {
+			return nil, err
+		}
+		account := strings.ToLower(strings.TrimSpace(req.Account))
+		if account == "" {
+			a.Cache.Flush()
+		} else {
+			a.Cache.InvalidateAccount(account)
+		}
+		b.FlushLabels(account)
+		a.log("caches_flushed", map[string]any{"account": account})
+		return map[string]any{"flushed": true}, nil
+	})
+	post("/disable", func(r *http.Request) (any, error) {
+		var req switchRequest
+		if err := decodeBody(r.Body, &req); err != nil {
+			return nil, err
+		}
+		s, err := parseSwitch(req)
+		if err != nil {
+			return nil, err
+		}
+		if req.For != "" {
+			d, err := time.ParseDuration(req.For)
+			if err != nil || d <= 0 {
+				return nil, errors.New("for must be a positive duration")
+			}
+			s.Until = time.Now().Add(d).UTC()
+		}
+		s.Reason = req.Reason
+		b.Disable(s)
+		a.log("kill_switch_on", map[string]any{"kind": s.Kind, "name": s.Name, "reason": s.Reason})
+		return map[string]any{"switches": b.Switches()}, nil
+	})
+	post("/enable", func(r *http.Request) (any, error) {
+		var req switchRequest
+		if err := decodeBody(r.Body, &req); err != nil {
+			return nil, err
+		}
+		s, err := parseSwitch(req)
+		if err != nil {
+			return nil, err
+		}
+		if !b.Enable(s.Kind, s.Name) {
+			return nil, errors.New(s.Kind + " " + s.Name + " is not disabled")
+		}
+		a.log("kill_switch_off", map[string]any{"kind": s.Kind, "name": s.Name})
+		return map[string]any{"switches": b.Switches()}, nil
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	return mux
+}
+
+// decodeBody reads an optional JSON body; an empty body leaves v as is.
+func decodeBody(body io.Reader, v any) error {
+	if err := json.NewDecoder(io.LimitReader(body, maxBodyBytes)).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return errors.New("invalid json: " + err.Error())
+	}
+	return nil
+}
+
+func parseSwitch(req switchRequest) (broker.Switch, error) {
+	account := strings.ToLower(strings.TrimSpace(req.Account))
+	action := strings.TrimSpace(req.Action)
+	switch {
+	case account != "" && action != "":
+		return broker.Switch{}, errors.New("set one of account and action")
+	case account != "":
+		return broker.Switch{Kind: "account", Name: account}, nil
+	case action != "":
+		if _, ok := actions.Lookup(action); !ok {
+			return broker.Switch{}, errors.New("unknown action " + action)
+		}
+		return broker.Switch{Kind: "action", Name: action}, nil
+	}
+	return broker.Switch{}, errors.New("account or action is required")
+}
+
+func (a *Admin) log(msg string, fields map[string]any) {
+	if a.Logger != nil {
+		a.Logger.Info(msg, fields)
+	}
+}
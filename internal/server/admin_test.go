@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/policy"
+)
+
+func TestAdminControls(t *testing.T) {
+	pol := &policy.Policy{AllowedActions: []string{"calendar.list"}, Calendar: &policy.CalendarPolicy{}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	b := &broker.Broker{RunnerProvider: stubRunner{}}
+	b.SetPolicies(&policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol}}, broker.PolicyInfo{Source: "policy.json", Hash: "sha256:1"})
+	reloads := 0
+	admin := &Admin{Broker: b, Cache: gog.NewCache(nil, 0), Reload: func() error {
+		reloads++
+		b.SetPolicies(b.PolicySet(), broker.PolicyInfo{Source: "policy.json", Hash: "sha256:2"})
+		return nil
+	}}
+	handler := admin.Handler()
+	do := func(method, path, body string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var out map[string]any
+		_ = json.NewDecoder(rec.Body).Decode(&out)
+		return rec.Code, out
+	}
+
+	if status, out := do(http.MethodGet, "/policy", ""); status != http.StatusOK || out["policy"].(map[string]any)["hash"] != "sha256:1" {
+		t.Fatalf("unexpected policy view: %d %v", status, out)
+	}
+	if status, _ := do(http.MethodPost, "/disable", `{"action":"calendar.list","for":"10m","reason":"incident"}`); status != http.StatusOK {
+		t.Fatalf("disable failed: %d", status)
+	}
+	if status, _ := do(http.MethodPost, "/disable", `{"action":"no.such.action"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected unknown action to be rejected, got %d", status)
+	}
+	if _, out := do(http.MethodGet, "/switches", ""); len(out["switches"].([]any)) != 1 {
+		t.Fatalf("expected one switch: %v", out)
+	}
+	if status, _ := do(http.MethodPost, "/enable", `{"action":"calendar.list"}`); status != http.StatusOK {
+		t.Fatalf("enable failed: %d", status)
+	}
+	if status, _ := do(http.MethodPost, "/enable", `{"action":"calendar.list"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected enabling twice to fail, got %d", status)
+	}
+	if status, out := do(http.MethodPost, "/reload", ""); status != http.StatusOK || reloads != 1 || out["policy"].(map[string]any)["hash"] != "sha256:2" {
+		t.Fatalf("unexpected reload: %d %v", status, out)
+	}
+	if status, _ := do(http.MethodPost, "/flush", ""); status != http.StatusOK {
+		t.Fatalf("flush failed: %d", status)
+	}
+	if status, out := do(http.MethodPost, "/lockdown", `{"account":"a@example.com","enabled":true}`); status != http.StatusOK || len(out["lockdown"].(map[string]any)["accounts"].([]any)) != 1 {
+		t.Fatalf("unexpected lockdown: %d %v", status, out)
+	}
+	if status, _ := do(http.MethodPost, "/lockdown", `{}`); status != http.StatusBadRequest {
+		t.Fatalf("expected missing enabled to be rejected, got %d", status)
+	}
+	for _, path := range []string{"/lockdown", "/labels", "/ratelimits", "/outbox", "/denials", "/runners"} {
+		if status, _ := do(http.MethodGet, path, ""); status != http.StatusOK {
+			t.Fatalf("%s: %d", path, status)
+		}
+	}
+}
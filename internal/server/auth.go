@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/token"
+	"gogcli-sandbox/internal/types"
+)
+
+// requireToken rejects requests without a valid bearer token and scopes the
+// rest to the token's account, actions and rate limits. /healthz and
+// /metrics stay open. A nil store disables token checks.
+func requireToken(tokens *token.Store, logger broker.Logger, next http.Handler) http.Handler {
+	if tokens == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		raw, ok := bearer(r.Header.Get("Authorization"))
+		if !ok {
+			unauthorized(w, logger, "token_missing", "bearer token required")
+			return
+		}
+		t, err := tokens.Authenticate(raw, time.Now())
+		switch {
+		case errors.Is(err, token.ErrExpired):
+			unauthorized(w, logger, "token_expired", "token expired")
+			return
+		case errors.Is(err, token.ErrInvalid):
+			unauthorized(w, logger, "token_invalid", "invalid token")
+			return
+		case err != nil:
+			if logger != nil {
+				logger.Error("token_store_error", map[string]any{"error": err.Error()})
+			}
+			unauthorized(w, logger, "token_unavailable", "tokens are unavailable")
+			return
+		}
+		principal := &broker.Principal{
+			Name:     "token:" + t.ID,
+			Accounts: []string{t.Account},
+			Actions:  t.Actions,
+			Allow:    func() bool { return tokens.Allow(t, time.Now()) },
+		}
+		next.ServeHTTP(w, r.WithContext(broker.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func bearer(header string) (string, bool) {
+	scheme, value, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+func unauthorized(w http.ResponseWriter, logger broker.Logger, msg, message string) {
+	if logger != nil {
+		logger.Info(msg, map[string]any{"decision": "deny"})
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeJSON(w, http.StatusUnauthorized, &types.Response{Ok: false, Error: types.NewError("unauthorized", message, "")})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/token"
+	"gogcli-sandbox/internal/types"
+)
+
+func TestRequireTokenScopesRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	f := &token.File{}
+	now := time.Now()
+	raw, minted, err := f.Mint(token.Token{Account: "a@example.com", Limits: token.Limits{PerHour: 1}, ExpiresAt: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if err := token.Save(path, f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	tokens, err := token.NewStore(path)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	pol := &policy.Policy{AllowedActions: []string{"calendar.list"}, Calendar: &policy.CalendarPolicy{}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	b := &broker.Broker{
+		Policies:       &policy.PolicySet{Accounts: map[string]*policy.Policy{"a@example.com": pol, "b@example.com": pol}},
+		RunnerProvider: stubRunner{},
+	}
+	mux := http.NewServeMux()
+	registerAPI(mux, b)
+	handler := requireToken(tokens, nil, mux)
+
+	do := func(auth string, req *types.Request) (int, *types.Response) {
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/v1/request", bytes.NewReader(body))
+		if auth != "" {
+			httpReq.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httpReq)
+		var resp types.Response
+		_ = json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, &resp
+	}
+
+	if status, _ := do("", &types.Request{ID: "1", Action: "calendar.list"}); status != http.StatusUnauthorized {
+		t.Fatalf("expected missing token to be unauthorized, got %d", status)
+	}
+	if status, resp := do("Bearer "+raw, &types.Request{ID: "2", Action: "calendar.list"}); status != http.StatusOK || !resp.Ok {
+		t.Fatalf("expected token to default to its account, got %d %+v", status, resp)
+	}
+	if status, _ := do("Bearer "+raw, &types.Request{ID: "3", Action: "calendar.list", Account: "b@example.com"}); status != http.StatusForbidden {
+		t.Fatalf("expected other account to be forbidden, got %d", status)
+	}
+	if status, resp := do("Bearer "+raw, &types.Request{ID: "4", Action: "calendar.list"}); status != http.StatusTooManyRequests || resp.Error.Code != "rate_limited" {
+		t.Fatalf("expected rate limit, got %d %+v", status, resp)
+	}
+
+	if _, err := f.Revoke(minted.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := token.Save(path, f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if status, _ := do("Bearer "+raw, &types.Request{ID: "5", Action: "calendar.list"}); status != http.StatusUnauthorized {
+		t.Fatalf("expected revoked token to be unauthorized, got %d", status)
+	}
+}
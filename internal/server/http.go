@@ -12,62 +12,40 @@ import (
 	"time"
 
 	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/metrics"
+	"gogcli-sandbox/internal/token"
+	"gogcli-sandbox/internal/trace"
 	"gogcli-sandbox/internal/types"
 )
 
-const maxBodyBytes = 1 << 20
+const (
+	maxBodyBytes      = 1 << 20
+	maxBatchBodyBytes = 4 << 20
+)
 
-func Serve(ctx context.Context, socketPath string, b *broker.Broker, logger broker.Logger) error {
+func Serve(ctx context.Context, socketPath string, b *broker.Broker, tokens *token.Store, logger broker.Logger) error {
 	listener, activated, err := systemdListener()
 	if err != nil {
 		return err
 	}
 	if !activated {
-		if socketPath == "" {
-			return errors.New("socket path is required")
-		}
-		if err := removeSocketIfExists(socketPath); err != nil {
-			return err
-		}
-		listener, err = net.Listen("unix", socketPath)
+		listener, err = listenUnix(socketPath, 0o660)
 		if err != nil {
 			return err
 		}
-		if err := os.Chmod(socketPath, 0o660); err != nil {
-			listener.Close()
-			return err
-		}
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
-	mux.HandleFunc("/v1/request", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
-		var req types.Request
-		if err := decoder.Decode(&req); err != nil {
-			writeJSON(w, http.StatusBadRequest, &types.Response{Ok: false, Error: types.NewError("bad_request", "invalid json", err.Error())})
-			return
-		}
-		resp := b.Handle(r.Context(), &req)
-		status := http.StatusOK
-		if !resp.Ok && resp.Error != nil {
-			status = statusForError(resp.Error.Code)
-		}
-		writeJSON(w, status, resp)
-	})
+	if b.Metrics != nil {
+		mux.Handle("/metrics", b.Metrics.Handler())
+	}
+	registerAPI(mux, b)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	})
 
 	srv := &http.Server{
-		Handler:      mux,
+		Handler:      requireToken(tokens, logger, mux),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
@@ -81,6 +59,9 @@ func Serve(ctx context.Context, socketPath string, b *broker.Broker, logger brok
 
 	if logger != nil {
 		fields := map[string]any{"socket": socketPath}
+		if tokens != nil {
+			fields["token_auth"] = true
+		}
 		if activated {
 			fields["systemd_activated"] = true
 		}
@@ -89,16 +70,142 @@ func Serve(ctx context.Context, socketPath string, b *broker.Broker, logger brok
 	return srv.Serve(listener)
 }
 
+// ServeMetrics exposes only /metrics on a TCP address, for scrapers that
+// cannot reach the unix socket.
+func ServeMetrics(ctx context.Context, addr string, reg *metrics.Registry, logger broker.Logger) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg.Handler())
+	srv := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	if logger != nil {
+		logger.Info("metrics_listening", map[string]any{"addr": listener.Addr().String()})
+	}
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// registerAPI adds the agent-facing endpoints, shared by the unix socket and
+// the TLS listener.
+func registerAPI(mux *http.ServeMux, b *broker.Broker) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b.Health())
+	})
+	mux.HandleFunc("/v1/request", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		var req types.Request
+		if err := decoder.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, &types.Response{Ok: false, Error: types.NewError("bad_request", "invalid json", err.Error())})
+			return
+		}
+		resp := b.Handle(requestContext(r), &req)
+		status := http.StatusOK
+		if !resp.Ok && resp.Error != nil {
+			status = statusForError(resp.Error.Code)
+		}
+		writeJSON(w, status, resp)
+	})
+	mux.HandleFunc("/v1/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes))
+		var reqs []*types.Request
+		if err := decoder.Decode(&reqs); err != nil {
+			writeJSON(w, http.StatusBadRequest, &types.Response{Ok: false, Error: types.NewError("bad_request", "invalid json", err.Error())})
+			return
+		}
+		responses, err := b.HandleBatch(requestContext(r), reqs)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, &types.Response{Ok: false, Error: types.NewError("bad_request", err.Error(), "")})
+			return
+		}
+		writeJSON(w, http.StatusOK, &types.BatchResponse{Responses: responses})
+	})
+	mux.HandleFunc("/v1/iterate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		var req types.IterateRequest
+		if err := decoder.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, &types.Response{Ok: false, Error: types.NewError("bad_request", "invalid json", err.Error())})
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		// The broker's iterate timeout bounds the stream instead of the
+		// server write timeout.
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		encoder := json.NewEncoder(w)
+		_ = b.Iterate(requestContext(r), &req, func(chunk *types.Chunk) error {
+			if err := encoder.Encode(chunk); err != nil {
+				return err
+			}
+			return rc.Flush()
+		})
+	})
+}
+
+// requestContext continues the caller's trace when it sends a W3C
+// traceparent header.
+func requestContext(r *http.Request) context.Context {
+	return trace.WithRemoteParent(r.Context(), r.Header.Get("traceparent"))
+}
+
 func statusForError(code string) int {
 	switch code {
 	case "bad_request":
 		return http.StatusBadRequest
+	case "unauthorized":
+		return http.StatusUnauthorized
 	case "forbidden":
 		return http.StatusForbidden
-	case "upstream_error":
+	case "not_found":
+		return http.StatusNotFound
+	case "conflict":
+		return http.StatusConflict
+	case "upstream_error", "output_too_large":
 		return http.StatusBadGateway
-	case "redaction_error":
+	case "busy", "network_error", "upstream_unavailable", "disabled":
+		return http.StatusServiceUnavailable
+	case "auth_expired":
+		return http.StatusFailedDependency
+	case "rate_limited":
+		return http.StatusTooManyRequests
+	case "permission_denied":
+		return http.StatusForbidden
+	case "timeout":
+		return http.StatusGatewayTimeout
+	case "redaction_error", "outbox_error", "cursor_error":
 		return http.StatusInternalServerError
+	case "action_disabled":
+		return http.StatusNotImplemented
+	case "lockdown":
+		return http.StatusLocked
 	default:
 		return http.StatusBadRequest
 	}
@@ -110,6 +217,24 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+func listenUnix(socketPath string, mode os.FileMode) (net.Listener, error) {
+	if socketPath == "" {
+		return nil, errors.New("socket path is required")
+	}
+	if err := removeSocketIfExists(socketPath); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
 func removeSocketIfExists(path string) error {
 	info, err := os.Stat(path)
 	if err != nil {
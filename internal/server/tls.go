@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/types"
+)
+
+// TLSFiles locates the TLS listener's material. Revoked is optional: a file
+// of SHA-256 client certificate fingerprints (hex, colons allowed), one per
+// line, refused even when the CA still vouches for them.
+type TLSFiles struct {
+	Cert     string
+	Key      string
+	ClientCA string
+	Revoked  string
+}
+
+// TLSServer serves the agent API over TCP with mutual TLS. Client
+// certificates map to accounts and actions through the policy file's
+// clients section.
+type TLSServer struct {
+	addr   string
+	broker *broker.Broker
+	logger broker.Logger
+
+	files   TLSFiles
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	revoked map[string]struct{}
+}
+
+func NewTLSServer(addr string, files TLSFiles, b *broker.Broker, logger broker.Logger) (*TLSServer, error) {
+	if files.Cert == "" || files.Key == "" || files.ClientCA == "" {
+		return nil, errors.New("tls listener requires a certificate, key and client CA")
+	}
+	s := &TLSServer{addr: addr, broker: b, logger: logger, files: files}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload rereads the certificate, client CA and revocation list. On error
+// the previous material stays in use. New connections see the result
+// immediately; revocations also apply to open connections.
+func (s *TLSServer) Reload() error {
+	cert, err := tls.LoadX509KeyPair(s.files.Cert, s.files.Key)
+	if err != nil {
+		return fmt.Errorf("tls certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(s.files.ClientCA)
+	if err != nil {
+		return fmt.Errorf("tls client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("tls client CA: no certificates in %s", s.files.ClientCA)
+	}
+	revoked := map[string]struct{}{}
+	if s.files.Revoked != "" {
+		if revoked, err = loadRevoked(s.files.Revoked); err != nil {
+			return fmt.Errorf("tls revoked list: %w", err)
+		}
+	}
+	s.mu.Lock()
+	s.cert, s.pool, s.revoked = &cert, pool, revoked
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *TLSServer) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ctx, listener)
+}
+
+func (s *TLSServer) serve(ctx context.Context, listener net.Listener) error {
+	listener = tls.NewListener(listener, &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) { return s.config(), nil },
+	})
+
+	mux := http.NewServeMux()
+	registerAPI(mux, s.broker)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	srv := &http.Server{
+		Handler:      s.authenticate(mux),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	if s.logger != nil {
+		s.logger.Info("tls_listening", map[string]any{"addr": listener.Addr().String()})
+	}
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *TLSServer) config() *tls.Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*s.cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    s.pool,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) > 0 && s.isRevoked(raw[0]) {
+				return errors.New("client certificate revoked")
+			}
+			return nil
+		},
+	}
+}
+
+func (s *TLSServer) isRevoked(der []byte) bool {
+	sum := sha256.Sum256(der)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[hex.EncodeToString(sum[:])]
+	return ok
+}
+
+// authenticate maps the client certificate to a principal. The revocation
+// list is checked again so a reload cuts off open keep-alive connections.
+func (s *TLSServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			writeJSON(w, http.StatusUnauthorized, &types.Response{Ok: false, Error: types.NewError("unauthorized", "client certificate required", "")})
+			return
+		}
+		leaf := r.TLS.PeerCertificates[0]
+		if s.isRevoked(leaf.Raw) {
+			s.deny(w, "client_revoked", leaf, "client certificate revoked")
+			return
+		}
+		name, client, ok := s.broker.PolicySet().Client(CertIdentities(leaf))
+		if !ok {
+			s.deny(w, "client_unmapped", leaf, "client certificate is not mapped to any account")
+			return
+		}
+		principal := &broker.Principal{Name: name, Accounts: client.Accounts, Actions: client.Actions}
+		next.ServeHTTP(w, r.WithContext(broker.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func (s *TLSServer) deny(w http.ResponseWriter, msg string, leaf *x509.Certificate, message string) {
+	if s.logger != nil {
+		s.logger.Info(msg, map[string]any{"decision": "deny", "subject": leaf.Subject.CommonName, "fingerprint": Fingerprint(leaf)})
+	}
+	writeJSON(w, http.StatusForbidden, &types.Response{Ok: false, Error: types.NewError("forbidden", message, "")})
+}
+
+// CertIdentities lists the names a client certificate can be mapped by, in
+// lookup order: subject common name, then DNS, URI, email and IP SANs.
+func CertIdentities(cert *x509.Certificate) []string {
+	ids := []string{}
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	ids = append(ids, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	return ids
+}
+
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadRevoked(path string) (map[string]struct{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	revoked := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		// Accept openssl's "sha256 Fingerprint=AB:CD:..." output as is.
+		if i := strings.LastIndex(text, "="); i >= 0 {
+			text = text[i+1:]
+		}
+		fp := strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(text), "sha256:"), ":", "")
+		if raw, err := hex.DecodeString(fp); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-256 fingerprint", line)
+		}
+		revoked[fp] = struct{}{}
+	}
+	return revoked, scanner.Err()
+}
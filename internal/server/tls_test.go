@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gogcli-sandbox/internal/broker"
+	"gogcli-sandbox/internal/gog"
+	"gogcli-sandbox/internal/policy"
+	"gogcli-sandbox/internal/types"
+)
+
+type stubRunner struct{}
+
+func (stubRunner) RunnerFor(string) gog.Runner { return stubRunner{} }
+
+func (stubRunner) Run(context.Context, string, map[string]interface{}) (any, error) {
+	return map[string]interface{}{"calendars": []interface{}{}}, nil
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, usage x509.ExtKeyUsage, ips ...net.IP) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, certPEM, keyPEM
+}
+
+func TestTLSServerMapsAndRevokesClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	_, serverCert, serverKey := ca.issue(t, 2, "broker", x509.ExtKeyUsageServerAuth, net.ParseIP("127.0.0.1"))
+	agent, _, _ := ca.issue(t, 3, "agent-1", x509.ExtKeyUsageClientAuth)
+	stranger, _, _ := ca.issue(t, 4, "agent-2", x509.ExtKeyUsageClientAuth)
+	files := TLSFiles{
+		Cert:     filepath.Join(dir, "server.pem"),
+		Key:      filepath.Join(dir, "server.key"),
+		ClientCA: filepath.Join(dir, "ca.pem"),
+		Revoked:  filepath.Join(dir, "revoked.txt"),
+	}
+	for path, data := range map[string][]byte{files.Cert: serverCert, files.Key: serverKey, files.ClientCA: ca.pem, files.Revoked: []byte("# none yet\n")} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pol := &policy.Policy{AllowedActions: []string{"calendar.list", "gmail.search"}, Calendar: &policy.CalendarPolicy{}, Gmail: &policy.GmailPolicy{}}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	b := &broker.Broker{
+		Policies: &policy.PolicySet{
+			Accounts: map[string]*policy.Policy{"a@example.com": pol},
+			Clients:  map[string]*policy.ClientPolicy{"agent-1": {Accounts: []string{"a@example.com"}, Actions: []string{"calendar.list"}}},
+		},
+		RunnerProvider: stubRunner{},
+	}
+	s, err := NewTLSServer("", files, b, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = s.serve(ctx, listener) }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	post := func(cert tls.Certificate, req *types.Request) (int, *types.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}}}}
+		defer client.CloseIdleConnections()
+		body, _ := json.Marshal(req)
+		httpResp, err := client.Post("https://"+listener.Addr().String()+"/v1/request", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		defer httpResp.Body.Close()
+		var resp types.Response
+		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+			return 0, nil, err
+		}
+		return httpResp.StatusCode, &resp, nil
+	}
+
+	status, resp, err := post(agent, &types.Request{ID: "1", Action: "calendar.list"})
+	if err != nil || status != http.StatusOK || !resp.Ok {
+		t.Fatalf("expected mapped client to default to its account, got %d %+v %v", status, resp, err)
+	}
+	status, resp, err = post(agent, &types.Request{ID: "2", Action: "gmail.search", Params: map[string]interface{}{"query": "x"}})
+	if err != nil || status != http.StatusForbidden || resp.Error.Code != "forbidden" {
+		t.Fatalf("expected action outside the client scope to be forbidden, got %d %+v %v", status, resp, err)
+	}
+	status, resp, err = post(stranger, &types.Request{ID: "3", Action: "calendar.list", Account: "a@example.com"})
+	if err != nil || status != http.StatusForbidden {
+		t.Fatalf("expected unmapped client to be forbidden, got %d %+v %v", status, resp, err)
+	}
+
+	leaf, _ := x509.ParseCertificate(agent.Certificate[0])
+	if err := os.WriteFile(files.Revoked, []byte("sha256:"+Fingerprint(leaf)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, _, err := post(agent, &types.Request{ID: "4", Action: "calendar.list"}); err == nil {
+		t.Fatalf("expected revoked client to fail the handshake")
+	}
+}
+
+func TestLoadRevoked(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	colons := strings.ToUpper(strings.TrimSuffix(strings.Repeat("AB:", 32), ":"))
+	path := filepath.Join(t.TempDir(), "revoked.txt")
+	data := "# comment\n\nsha256 Fingerprint=" + colons + "\n" + fp + " # agent-3\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := loadRevoked(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := revoked[fp]; !ok || len(revoked) != 1 {
+		t.Fatalf("unexpected revoked set: %v", revoked)
+	}
+	if err := os.WriteFile(path, []byte("not-a-fingerprint\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRevoked(path); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,279 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefix = "gcs_"
+
+var (
+	ErrInvalid = errors.New("invalid token")
+	ErrExpired = errors.New("token expired")
+)
+
+// Token is a minted agent token as stored on disk. Only the SHA-256 of the
+// secret is kept; the secret itself is shown once when minting.
+type Token struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	Name      string    `json:"name,omitempty"`
+	Account   string    `json:"account"`
+	Actions   []string  `json:"actions,omitempty"`
+	Limits    Limits    `json:"limits"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Limits caps how many requests a token may make per fixed window. Zero
+// means unlimited.
+type Limits struct {
+	PerMinute int `json:"per_minute,omitempty"`
+	PerHour   int `json:"per_hour,omitempty"`
+}
+
+type File struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+// Load reads a token file. A missing file is an empty set.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &File{}, nil
+		}
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("token file %s: %w", path, err)
+	}
+	for i, t := range f.Tokens {
+		if t == nil || t.ID == "" || t.Account == "" {
+			return nil, fmt.Errorf("token file %s: entry %d needs id and account", path, i)
+		}
+		if raw, err := hex.DecodeString(t.Hash); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("token file %s: token %s has an invalid hash", path, t.ID)
+		}
+	}
+	return &f, nil
+}
+
+// Save writes the token file atomically with owner-only permissions, so a
+// running broker never sees a partial file.
+func Save(path string, f *File) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Mint creates a token and returns its secret, which is not stored.
+func (f *File) Mint(t Token, now time.Time) (string, *Token, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	raw := prefix + base64.RawURLEncoding.EncodeToString(secret)
+	t.Hash = hashOf(raw)
+	t.ID = t.Hash[:12]
+	t.CreatedAt = now.UTC()
+	t.ExpiresAt = t.ExpiresAt.UTC()
+	minted := &t
+	f.Tokens = append(f.Tokens, minted)
+	return raw, minted, nil
+}
+
+// Revoke removes the token with the given id (or unique id prefix).
+func (f *File) Revoke(id string) (*Token, error) {
+	match := -1
+	for i, t := range f.Tokens {
+		if strings.HasPrefix(t.ID, id) && id != "" {
+			if match >= 0 {
+				return nil, fmt.Errorf("token id %q is ambiguous", id)
+			}
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("no token with id %q", id)
+	}
+	t := f.Tokens[match]
+	f.Tokens = append(f.Tokens[:match], f.Tokens[match+1:]...)
+	return t, nil
+}
+
+// Sorted returns the tokens ordered by creation time.
+func (f *File) Sorted() []*Token {
+	out := append([]*Token{}, f.Tokens...)
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func hashOf(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store authenticates tokens against a token file. The file is checked for
+// changes on every call, so minted and revoked tokens apply to the next
+// request without a restart.
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	info   os.FileInfo
+	byHash map[string]*Token
+	usage  map[string]*usage
+}
+
+type usage struct {
+	minute, hour           time.Time
+	minuteCount, hourCount int
+}
+
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, usage: map[string]*usage{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) refresh() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		s.info, s.byHash = nil, map[string]*Token{}
+		return nil
+	}
+	if s.info != nil && os.SameFile(s.info, info) && s.info.ModTime().Equal(info.ModTime()) && s.info.Size() == info.Size() {
+		return nil
+	}
+	f, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	byHash := make(map[string]*Token, len(f.Tokens))
+	for _, t := range f.Tokens {
+		byHash[t.Hash] = t
+	}
+	s.info, s.byHash = info, byHash
+	return nil
+}
+
+// Authenticate returns the token record for a presented secret. If the token
+// file cannot be read, every token is refused.
+func (s *Store) Authenticate(raw string, now time.Time) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		s.info, s.byHash = nil, map[string]*Token{}
+		return nil, err
+	}
+	t, ok := s.byHash[hashOf(raw)]
+	if !ok {
+		return nil, ErrInvalid
+	}
+	if !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return t, nil
+}
+
+// Allow counts one request against the token's limits and reports whether
+// it is within them.
+func (s *Store) Allow(t *Token, now time.Time) bool {
+	if t.Limits.PerMinute <= 0 && t.Limits.PerHour <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usage[t.ID]
+	if u == nil {
+		u = &usage{}
+		s.usage[t.ID] = u
+	}
+	if minute := now.Truncate(time.Minute); !u.minute.Equal(minute) {
+		u.minute, u.minuteCount = minute, 0
+	}
+	if hour := now.Truncate(time.Hour); !u.hour.Equal(hour) {
+		u.hour, u.hourCount = hour, 0
+	}
+	if (t.Limits.PerMinute > 0 && u.minuteCount >= t.Limits.PerMinute) || (t.Limits.PerHour > 0 && u.hourCount >= t.Limits.PerHour) {
+		return false
+	}
+	u.minuteCount++
+	u.hourCount++
+	return true
+}
+
+// Usage is a token's request count in the current rate-limit windows.
+type Usage struct {
+	ID        string `json:"id"`
+	Account   string `json:"account"`
+	Limits    Limits `json:"limits"`
+	PerMinute int    `json:"per_minute"`
+	PerHour   int    `json:"per_hour"`
+}
+
+// Usage reports the current window counts of every rate-limited token that
+// is still in the token file.
+func (s *Store) Usage(now time.Time) []Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Usage{}
+	for _, t := range s.byHash {
+		if t.Limits.PerMinute <= 0 && t.Limits.PerHour <= 0 {
+			continue
+		}
+		u := Usage{ID: t.ID, Account: t.Account, Limits: t.Limits}
+		if c := s.usage[t.ID]; c != nil {
+			if c.minute.Equal(now.Truncate(time.Minute)) {
+				u.PerMinute = c.minuteCount
+			}
+			if c.hour.Equal(now.Truncate(time.Hour)) {
+				u.PerHour = c.hourCount
+			}
+		}
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,91 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreSeesMintAndRevokeImmediately(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	now := time.Now()
+
+	f, _ := Load(path)
+	raw, minted, err := f.Mint(Token{Account: "a@example.com", ExpiresAt: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if err := Save(path, f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), strings.TrimPrefix(raw, prefix)) {
+		t.Fatalf("token secret stored in plain text")
+	}
+	if got, err := store.Authenticate(raw, now); err != nil || got.ID != minted.ID {
+		t.Fatalf("expected minted token to authenticate, got %+v %v", got, err)
+	}
+	if _, err := store.Authenticate(raw+"x", now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid token, got %v", err)
+	}
+	if _, err := store.Authenticate(raw, now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+
+	f, _ = Load(path)
+	if _, err := f.Revoke(minted.ID[:6]); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := Save(path, f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := store.Authenticate(raw, now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected revoked token to be refused, got %v", err)
+	}
+}
+
+func TestStoreRefusesAllWhenFileIsCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	f := &File{}
+	raw, _, _ := f.Mint(Token{Account: "a@example.com"}, time.Now())
+	if err := Save(path, f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(raw, time.Now()); err == nil {
+		t.Fatalf("expected corrupt token file to refuse every token")
+	}
+}
+
+func TestAllowEnforcesLimits(t *testing.T) {
+	store := &Store{usage: map[string]*usage{}}
+	tok := &Token{ID: "t1", Limits: Limits{PerMinute: 2, PerHour: 3}}
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, want := range []bool{true, true, false} {
+		if got := store.Allow(tok, now); got != want {
+			t.Fatalf("call %d: expected %v", i, want)
+		}
+	}
+	if !store.Allow(tok, now.Add(time.Minute)) {
+		t.Fatalf("expected a new minute to allow again")
+	}
+	if store.Allow(tok, now.Add(2*time.Minute)) {
+		t.Fatalf("expected the hourly limit to hold")
+	}
+	if !store.Allow(&Token{ID: "t2"}, now) {
+		t.Fatalf("expected tokens without limits to be allowed")
+	}
+}
@@ -0,0 +1,245 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	serviceName   = "gogcli-sandbox"
+	batchSize     = 256
+	queueSize     = 2048
+	flushInterval = 2 * time.Second
+)
+
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON
+// encoding. Endpoint is the collector base URL, e.g. http://127.0.0.1:4318.
+type OTLPExporter struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(e.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	return nil
+}
+
+// FileExporter appends each batch to Path as one line of OTLP JSON, so the
+// file can be replayed into a collector later.
+type FileExporter struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (e *FileExporter) Export(ctx context.Context, spans []*Span) error {
+	line, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, err := os.OpenFile(e.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+func encodeSpans(spans []*Span) map[string]any {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if !s.Parent.IsZero() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		keys := make([]string, 0, len(s.Attrs))
+		for key := range s.Attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			span.Attributes = append(span.Attributes, otlpAttr{Key: key, Value: otlpValue{StringValue: s.Attrs[key]}})
+		}
+		if s.Err != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.Err} // STATUS_CODE_ERROR
+		}
+		out = append(out, span)
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: serviceName}}}},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": serviceName},
+			"spans": out,
+		}},
+	}}}
+}
+
+// batcher queues finished spans and exports them in the background so a
+// slow collector never delays a request. Spans are dropped when the queue
+// is full.
+type batcher struct {
+	exporter Exporter
+	queue    chan *Span
+	flush    chan chan struct{}
+	onError  func(error)
+	once     sync.Once
+	done     chan struct{}
+}
+
+func newBatcher(exporter Exporter, onError func(error)) *batcher {
+	b := &batcher{
+		exporter: exporter,
+		queue:    make(chan *Span, queueSize),
+		flush:    make(chan chan struct{}),
+		onError:  onError,
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(s *Span) {
+	select {
+	case b.queue <- s:
+	default:
+	}
+}
+
+func (b *batcher) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	pending := []*Span{}
+	export := func() {
+		if len(pending) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := b.exporter.Export(ctx, pending)
+		cancel()
+		if err != nil && b.onError != nil {
+			b.onError(err)
+		}
+		pending = []*Span{}
+	}
+	for {
+		select {
+		case s := <-b.queue:
+			pending = append(pending, s)
+			if len(pending) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-b.flush:
+			for drained := false; !drained; {
+				select {
+				case s := <-b.queue:
+					pending = append(pending, s)
+				default:
+					drained = true
+				}
+			}
+			export()
+			close(ack)
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *batcher) close(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case <-b.done:
+		return nil
+	default:
+	}
+	select {
+	case b.flush <- ack:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
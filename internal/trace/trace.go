@@ -0,0 +1,186 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsZero() bool { return id == TraceID{} }
+func (id SpanID) IsZero() bool  { return id == SpanID{} }
+
+// Span is one timed stage of a request. A nil *Span is a valid no-op span,
+// so code can trace unconditionally.
+type Span struct {
+	tracer  *Tracer
+	TraceID TraceID
+	SpanID  SpanID
+	Parent  SpanID
+	Name    string
+	Start   time.Time
+	End     time.Time
+	Attrs   map[string]string
+	Err     string
+
+	mu    sync.Mutex
+	ended bool
+}
+
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attrs == nil {
+		s.Attrs = map[string]string{}
+	}
+	s.Attrs[key] = value
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err.Error()
+}
+
+// Finish ends the span and hands it to the exporter. Later calls are
+// ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+// Tracer starts root spans and exports finished spans.
+type Tracer struct {
+	exporter *batcher
+}
+
+// NewTracer exports spans in the background; onError (optional) sees
+// failed exports.
+func NewTracer(exporter Exporter, onError func(error)) *Tracer {
+	return &Tracer{exporter: newBatcher(exporter, onError)}
+}
+
+// Close flushes pending spans.
+func (t *Tracer) Close(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.close(ctx)
+}
+
+func (t *Tracer) export(s *Span) {
+	if t != nil {
+		t.exporter.add(s)
+	}
+}
+
+// Start begins a span under the span in ctx, or under the remote parent from
+// WithRemoteParent, or as a new trace. A nil tracer starts nothing.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, Name: name, Start: time.Now(), SpanID: newSpanID()}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.Parent = parent.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		span.TraceID = remote.trace
+		span.Parent = remote.span
+	} else {
+		span.TraceID = newTraceID()
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Start begins a child of the span in ctx. Without one it is a no-op, so
+// helpers deep in the call chain need no tracer of their own.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+type remoteParent struct {
+	trace TraceID
+	span  SpanID
+}
+
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// WithRemoteParent continues the trace from a W3C traceparent header
+// ("00-<trace id>-<span id>-<flags>"). Malformed values are ignored.
+func WithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+	var remote remoteParent
+	if !decodeHex(parts[1], remote.trace[:]) || !decodeHex(parts[2], remote.span[:]) {
+		return ctx
+	}
+	if remote.trace.IsZero() || remote.span.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+// Traceparent formats the span for a W3C traceparent header.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-01"
+}
+
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
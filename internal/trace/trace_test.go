@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpansFollowContextAndRemoteParent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	tracer := NewTracer(&FileExporter{Path: path}, nil)
+
+	ctx := WithRemoteParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.Start(ctx, "broker.Handle")
+	root.SetAttr("action", "gmail.search")
+	_, child := Start(ctx, "runner.Run")
+	child.SetError(errors.New("gog failed"))
+	child.Finish()
+	root.Finish()
+
+	if _, span := Start(context.Background(), "orphan"); span != nil {
+		t.Fatalf("expected no span without a parent")
+	}
+	if err := tracer.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var doc struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	spans := doc.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	runner, handle := spans[0], spans[1]
+	if handle.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || handle.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("root span did not continue the remote trace: %+v", handle)
+	}
+	if runner.TraceID != handle.TraceID || runner.ParentSpanID != handle.SpanID || runner.Status.Code != 2 {
+		t.Fatalf("unexpected child span: %+v", runner)
+	}
+	if len(handle.Attributes) != 1 || handle.Attributes[0].Value.StringValue != "gmail.search" {
+		t.Fatalf("unexpected attributes: %+v", handle.Attributes)
+	}
+}
+
+func TestWithRemoteParentIgnoresMalformedHeaders(t *testing.T) {
+	for _, header := range []string{"", "garbage", "00-0000-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		ctx := WithRemoteParent(context.Background(), header)
+		if ctx.Value(remoteKey{}) != nil {
+			t.Fatalf("%q: expected the header to be ignored", header)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(&OTLPExporter{Endpoint: srv.URL}, func(err error) { t.Errorf("export: %v", err) })
+	_, span := tracer.Start(context.Background(), "broker.Handle")
+	span.Finish()
+	if err := tracer.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !strings.Contains(body, `"name":"broker.Handle"`) || !strings.Contains(body, `"service.name"`) {
+		t.Fatalf("unexpected export body: %s", body)
+	}
+}
@@ -15,6 +15,27 @@ type Response struct {
 	Error    *Error   `json:"error,omitempty"`
 }
 
+type BatchResponse struct {
+	Responses []*Response `json:"responses"`
+}
+
+type IterateRequest struct {
+	Request
+	Cursor   string `json:"cursor,omitempty"`
+	MaxItems int    `json:"max_items,omitempty"`
+}
+
+type Chunk struct {
+	ID       string   `json:"id"`
+	Page     int      `json:"page,omitempty"`
+	Data     any      `json:"data,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Done     bool     `json:"done,omitempty"`
+	Count    int      `json:"count,omitempty"`
+	Cursor   string   `json:"cursor,omitempty"`
+	Error    *Error   `json:"error,omitempty"`
+}
+
 type Error struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`